@@ -4,15 +4,15 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
-	"norex/database"
+	"norex/config"
 	"norex/email"
 	"norex/models"
+	"norex/store"
 	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go/v4"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 func generateVerificationCode() string {
@@ -45,9 +45,8 @@ func RequestCode(c *fiber.Ctx) error {
 	emailAddress := body.Email
 	fmt.Println(emailAddress)
 	// Check if user exists, if not, create a new user
-	collection := database.GetCollection("users")
-	var user models.User
-	err := collection.FindOne(context.TODO(), bson.M{"email": emailAddress}).Decode(&user)
+	users := store.Users()
+	user, err := users.FindByEmail(context.TODO(), emailAddress)
 
 	if err != nil {
 		// New user, generate a new record
@@ -58,7 +57,7 @@ func RequestCode(c *fiber.Ctx) error {
 			CodeExpiryTime:   time.Now().UTC().Add(5 * time.Minute),
 			AttemptCount:     0,
 		}
-		_, err := collection.InsertOne(context.TODO(), user)
+		err := users.Create(context.TODO(), user)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user"})
 		}
@@ -75,7 +74,7 @@ func RequestCode(c *fiber.Ctx) error {
 		user.VerificationCode = generateVerificationCode()
 		user.CodeExpiryTime = time.Now().UTC().Add(5 * time.Minute)
 		user.AttemptCount = 0 // Reset attempts
-		_, err := collection.UpdateOne(context.TODO(), bson.M{"email": emailAddress}, bson.M{"$set": user})
+		err := users.Update(context.TODO(), emailAddress, user)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update code"})
 		}
@@ -106,11 +105,10 @@ func VerifyCode(c *fiber.Ctx) error {
 	userEmail := body.Email
 	code := body.Code
 
-	collection := database.GetCollection("users")
-	var user models.User
+	users := store.Users()
 
 	// Find the user by email
-	err := collection.FindOne(context.TODO(), bson.M{"email": userEmail}).Decode(&user)
+	user, err := users.FindByEmail(context.TODO(), userEmail)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid email"})
 	}
@@ -131,7 +129,7 @@ func VerifyCode(c *fiber.Ctx) error {
 		if user.AttemptCount >= 5 {
 			user.BanUntil = time.Now().Add(2 * time.Hour) // Ban for 2 hours
 		}
-		_, _ = collection.UpdateOne(context.TODO(), bson.M{"email": userEmail}, bson.M{"$set": user})
+		_ = users.Update(context.TODO(), userEmail, user)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid code"})
 	}
 
@@ -145,7 +143,7 @@ func VerifyCode(c *fiber.Ctx) error {
 	}
 
 	// Update user in the database with reset attempts and role if needed
-	_, _ = collection.UpdateOne(context.TODO(), bson.M{"email": userEmail}, bson.M{"$set": user})
+	_ = users.Update(context.TODO(), userEmail, user)
 
 	// Generate JWT token
 	token, err := generateToken(user.Email)
@@ -154,9 +152,7 @@ func VerifyCode(c *fiber.Ctx) error {
 	}
 
 	// Fetch the user's role from the database
-	roleCollection := database.GetCollection("roles")
-	var role models.Role
-	err = roleCollection.FindOne(context.TODO(), bson.M{"name": user.Role}).Decode(&role)
+	role, err := store.Roles().FindByName(context.TODO(), user.Role)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve user role"})
 	}
@@ -185,7 +181,12 @@ func updateBanStatus(user *models.User) {
 	}
 }
 
-var JWTSecret = []byte("your_jwt_secret_key")
+var JWTSecret []byte
+
+// Configure sets the secret used to sign and verify JWT tokens.
+func Configure(cfg config.JWTConfig) {
+	JWTSecret = []byte(cfg.Secret)
+}
 
 func generateToken(email string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -234,8 +235,6 @@ func JWTProtected() fiber.Handler {
 }
 
 func CreateSession(user models.User, role models.Role, token string, ipAddress string, device string) error {
-	collection := database.GetCollection("sessions")
-
 	session := models.Session{
 		UserID:    user.ID,
 		Token:     token,
@@ -246,7 +245,7 @@ func CreateSession(user models.User, role models.Role, token string, ipAddress s
 		Role:      role.Name,
 	}
 
-	_, err := collection.InsertOne(context.TODO(), session)
+	err := store.Sessions().Create(context.TODO(), session)
 	if err != nil {
 		return fmt.Errorf("failed to create session: %v", err)
 	}
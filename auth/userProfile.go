@@ -4,12 +4,12 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
-	"norex/database"
+	"norex/catalog"
 	"norex/models"
+	"norex/store"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 func UpdateProfile(c *fiber.Ctx) error {
@@ -35,34 +35,23 @@ func UpdateProfile(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Name and gender are required"})
 	}
 
-	defaultGames := map[string]models.GameStats{
-		"uno":         {Wins: 0, Level: 1},
-		"spades":      {Wins: 0, Level: 1},
-		"go_fish":     {Wins: 0, Level: 1},
-		"euchre":      {Wins: 0, Level: 1},
-		"hearts":      {Wins: 0, Level: 1},
-		"crazy_eight": {Wins: 0, Level: 1},
-		"chess":       {Wins: 0, Level: 1},
-		"othello":     {Wins: 0, Level: 1},
-		"go":          {Wins: 0, Level: 1},
-		"checkers":    {Wins: 0, Level: 1},
-		"battleship":  {Wins: 0, Level: 1},
-		"image_match": {Wins: 0, Level: 1},
+	user, err := store.Users().FindByEmail(context.TODO(), email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to find user"})
+	}
+	if err := EnsureGameStats(context.TODO(), &user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update profile"})
 	}
 
-	collection := database.GetCollection("users")
-	update := bson.M{
-		"$set": bson.M{
-			"name":         name,
-			"gender":       gender,
-			"avatar":       generateAvatar(gender),
-			"games":        defaultGames,
-			"premium":      false,
-			"premium_ends": nil,
-		},
+	update := map[string]interface{}{
+		"name":         name,
+		"gender":       gender,
+		"avatar":       generateAvatar(gender),
+		"premium":      false,
+		"premium_ends": nil,
 	}
 
-	_, err := collection.UpdateOne(context.TODO(), bson.M{"email": email}, update)
+	err = store.Users().UpdateFields(context.TODO(), email, update)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update profile"})
 	}
@@ -70,6 +59,31 @@ func UpdateProfile(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Profile updated successfully"})
 }
 
+// EnsureGameStats gives the user starting stats for every catalog game they
+// have none for yet, so games added later show up for existing users. Only
+// the missing entries are written, never the stats already earned.
+func EnsureGameStats(ctx context.Context, user *models.User) error {
+	fields := make(map[string]interface{})
+	if user.Games == nil {
+		user.Games = make(map[string]models.GameStats)
+	}
+	for _, key := range catalog.Keys() {
+		if _, ok := user.Games[key]; !ok {
+			user.Games[key] = models.GameStats{Wins: 0, Level: catalog.MinLevel}
+			fields["games."+key] = user.Games[key]
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	if len(fields) == len(user.Games) {
+		// A user without any stats may have a null games field, which
+		// MongoDB can not set paths inside of
+		fields = map[string]interface{}{"games": user.Games}
+	}
+	return store.Users().UpdateFields(ctx, user.Email, fields)
+}
+
 func generateAvatar(gender string) string {
 	if gender == "Male" {
 		return fmt.Sprintf("man-%d.jpg", rand.Intn(10)+1)
@@ -0,0 +1,192 @@
+// Package catalog is the registry of every game a room can be created for.
+// Each game declares how it is shown to players, how many players it seats,
+// which chat modes its rooms may use, the range of levels a room may
+// require, the house rules a room may set (see Option) and, once its rules
+// are implemented, its engine. Room settings
+// and user stats are driven from it, so adding a game only takes a
+// Register call.
+package catalog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"norex/engine"
+	"norex/models"
+)
+
+// Level bounds shared by every game. Every player starts at level 1.
+const (
+	MinLevel = 1
+	MaxLevel = 100
+)
+
+// MaxPasswordLength bounds the password of a locked room.
+const MaxPasswordLength = 64
+
+// Game is the catalog entry of one game.
+type Game struct {
+	Key         string `json:"key"` // the key used in rooms and models.User.Games
+	DisplayName string `json:"displayName"`
+	Icon        string `json:"icon"` // file name of the icon shipped with the client
+	MinPlayers  int    `json:"minPlayers"`
+	MaxPlayers  int    `json:"maxPlayers"`
+	VoiceChat   bool   `json:"voiceChat"` // whether rooms may turn voice chat on; off for partnership games, where partners could share their hands
+	TextChat    bool   `json:"textChat"`  // whether rooms may turn text chat on
+	MinLevel    int    `json:"minLevel"`  // MinLevel of the package when left out
+	MaxLevel    int    `json:"maxLevel"`  // MaxLevel of the package when left out
+	// Options are the house rules a room of the game may set
+	Options []Option `json:"options,omitempty"`
+
+	// New returns the rule set of the game, nil while the game can be
+	// listed but not played yet
+	New func() engine.Game `json:"-"`
+	// Playable is set by Register when the game has an engine
+	Playable bool `json:"playable"`
+}
+
+// DefaultCapacity is the capacity of rooms the server opens by itself,
+// e.g. for quick-join: four players, or as close to it as the game allows.
+func (g Game) DefaultCapacity() int {
+	switch {
+	case g.MaxPlayers < 4:
+		return g.MaxPlayers
+	case g.MinPlayers > 4:
+		return g.MinPlayers
+	}
+	return 4
+}
+
+var (
+	mu    sync.RWMutex
+	games = make(map[string]Game)
+)
+
+// Register adds a game to the catalog and, when it has one, its rule set
+// to the engine. It is meant to be called from the init function of the
+// game's package and panics on an invalid or duplicate entry.
+func Register(game Game) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	switch {
+	case game.Key == "" || game.Key != strings.ToLower(game.Key):
+		panic(fmt.Sprintf("catalog: game key %q must be lowercase and not empty", game.Key))
+	case game.MinPlayers < 1 || game.MaxPlayers < game.MinPlayers:
+		panic(fmt.Sprintf("catalog: invalid player range for %q", game.Key))
+	}
+	for _, option := range game.Options {
+		if !validKind(option.Kind) {
+			panic(fmt.Sprintf("catalog: option %q of %q has unknown kind %q", option.Key, game.Key, option.Kind))
+		}
+	}
+	if _, exists := games[game.Key]; exists {
+		panic(fmt.Sprintf("catalog: game %q registered twice", game.Key))
+	}
+	if game.DisplayName == "" {
+		game.DisplayName = game.Key
+	}
+	if game.MinLevel == 0 {
+		game.MinLevel = MinLevel
+	}
+	if game.MaxLevel == 0 {
+		game.MaxLevel = MaxLevel
+	}
+	if game.New != nil {
+		engine.Register(game.Key, game.New())
+		game.Playable = true
+	}
+	games[game.Key] = game
+}
+
+// Lookup returns the catalog entry of a game key. Keys are case-insensitive.
+func Lookup(key string) (Game, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	game, ok := games[strings.ToLower(key)]
+	return game, ok
+}
+
+// Keys returns every game key in alphabetical order.
+func Keys() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	keys := make([]string, 0, len(games))
+	for key := range games {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// List returns every game ordered by display name.
+func List() []Game {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]Game, 0, len(games))
+	for _, game := range games {
+		list = append(list, game)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DisplayName < list[j].DisplayName })
+	return list
+}
+
+// FieldErrors maps the JSON name of each invalid room setting to what is
+// wrong with it.
+type FieldErrors map[string]string
+
+// ValidateRoom checks the settings of a room against its game. participants
+// is the number of players already seated, which the capacity may not go
+// below. It returns nil when the settings are valid.
+func ValidateRoom(room models.Room, participants int) FieldErrors {
+	errs := FieldErrors{}
+
+	game, ok := Lookup(room.GameName)
+	if !ok {
+		errs["gameName"] = fmt.Sprintf("%q is not a supported game", room.GameName)
+	} else {
+		switch {
+		case room.Capacity < game.MinPlayers || room.Capacity > game.MaxPlayers:
+			if game.MinPlayers == game.MaxPlayers {
+				errs["capacity"] = fmt.Sprintf("must be %d for %s", game.MinPlayers, game.Key)
+			} else {
+				errs["capacity"] = fmt.Sprintf("must be between %d and %d for %s", game.MinPlayers, game.MaxPlayers, game.Key)
+			}
+		case room.Capacity < participants:
+			errs["capacity"] = fmt.Sprintf("must be at least %d, the number of seated players", participants)
+		}
+		// 0 means no level requirement
+		if room.MinLevel != 0 && (room.MinLevel < game.MinLevel || room.MinLevel > game.MaxLevel) {
+			errs["minLevel"] = fmt.Sprintf("must be 0 or between %d and %d", game.MinLevel, game.MaxLevel)
+		}
+		if room.VoiceChatOn && !game.VoiceChat {
+			errs["voiceChatOn"] = fmt.Sprintf("voice chat is not available for %s", game.Key)
+		}
+		if room.TextChatOn && !game.TextChat {
+			errs["textChatOn"] = fmt.Sprintf("text chat is not available for %s", game.Key)
+		}
+		game.validateOptions(room.Options, errs)
+	}
+
+	if room.IsLocked && room.RoomPassword == "" {
+		errs["roomPassword"] = "is required for a locked room"
+	} else if len(room.RoomPassword) > MaxPasswordLength {
+		errs["roomPassword"] = fmt.Sprintf("must be at most %d characters", MaxPasswordLength)
+	}
+
+	if room.TimeControl != nil {
+		if err := room.TimeControl.Validate(); err != nil {
+			errs["timeControl"] = err.Error()
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
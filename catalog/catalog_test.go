@@ -0,0 +1,75 @@
+package catalog_test
+
+import (
+	"testing"
+
+	"norex/catalog"
+	_ "norex/games/chess"
+	"norex/models"
+	"norex/settings"
+)
+
+func TestValidateRoom(t *testing.T) {
+	tests := []struct {
+		name   string
+		room   models.Room
+		fields []string // fields expected to be rejected
+	}{
+		{
+			name: "valid chess room",
+			room: models.Room{GameName: "chess", Capacity: 2},
+		},
+		{
+			name:   "unknown game",
+			room:   models.Room{GameName: "tiddlywinks", Capacity: 2},
+			fields: []string{"gameName"},
+		},
+		{
+			name:   "capacity out of range",
+			room:   models.Room{GameName: "chess", Capacity: 3},
+			fields: []string{"capacity"},
+		},
+		{
+			name:   "locked without password",
+			room:   models.Room{GameName: "chess", Capacity: 2, IsLocked: true},
+			fields: []string{"roomPassword"},
+		},
+		{
+			name:   "unknown option",
+			room:   models.Room{GameName: "chess", Capacity: 2, Options: settings.Options{"targetScore": 10}},
+			fields: []string{"options.targetScore"},
+		},
+		{
+			name:   "option of the wrong kind",
+			room:   models.Room{GameName: "chess", Capacity: 2, Options: settings.Options{"fen": 7.0}},
+			fields: []string{"options.fen"},
+		},
+		{
+			name:   "invalid FEN",
+			room:   models.Room{GameName: "chess", Capacity: 2, Options: settings.Options{"fen": "8/8/8 w - - 0 1"}},
+			fields: []string{"options.fen"},
+		},
+		{
+			name: "custom FEN",
+			room: models.Room{GameName: "chess", Capacity: 2, Options: settings.Options{"fen": "8/8/4k3/8/8/3K4/8/7R w - - 0 1"}},
+		},
+		{
+			name:   "bad time control",
+			room:   models.Room{GameName: "chess", Capacity: 2, TimeControl: &settings.TimeControl{IncrementSeconds: 5}},
+			fields: []string{"timeControl"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := catalog.ValidateRoom(tt.room, 1)
+			if len(errs) != len(tt.fields) {
+				t.Fatalf("errors = %v, want %v", errs, tt.fields)
+			}
+			for _, field := range tt.fields {
+				if _, ok := errs[field]; !ok {
+					t.Errorf("no error for %s in %v", field, errs)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package catalog
+
+import (
+	"fmt"
+
+	"norex/engine"
+)
+
+// Kinds of option values.
+const (
+	OptionBool   = "bool"
+	OptionInt    = "int"
+	OptionString = "string"
+)
+
+// Option is a house rule a game reads from its engine.Options, e.g.
+// the score that ends the game.
+type Option struct {
+	Key     string      `json:"key"`
+	Kind    string      `json:"kind"` // OptionBool, OptionInt or OptionString
+	Default interface{} `json:"default"`
+	// Bounds of OptionInt values
+	Min int `json:"min,omitempty"`
+	Max int `json:"max,omitempty"`
+	// Validate, when set, checks a value of the right kind further, e.g.
+	// that a string is a position the game can start from
+	Validate func(value interface{}) error `json:"-"`
+}
+
+// validate returns what is wrong with value, or "" when the option may
+// take it. nil resets the option to its default.
+func (o Option) validate(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	switch o.Kind {
+	case OptionBool:
+		if _, ok := value.(bool); !ok {
+			return "must be true or false"
+		}
+	case OptionString:
+		if _, ok := value.(string); !ok {
+			return "must be a string"
+		}
+	case OptionInt:
+		var n float64
+		switch v := value.(type) {
+		case int:
+			n = float64(v)
+		case int64:
+			n = float64(v)
+		case float64:
+			n = v
+		default:
+			return "must be a number"
+		}
+		if n != float64(int(n)) || int(n) < o.Min || int(n) > o.Max {
+			return fmt.Sprintf("must be a whole number between %d and %d", o.Min, o.Max)
+		}
+	}
+	if o.Validate != nil {
+		if err := o.Validate(value); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// Option returns the option of the game with the given key.
+func (g Game) Option(key string) (Option, bool) {
+	for _, option := range g.Options {
+		if option.Key == key {
+			return option, true
+		}
+	}
+	return Option{}, false
+}
+
+func validKind(kind string) bool {
+	return kind == OptionBool || kind == OptionInt || kind == OptionString
+}
+
+// validateOptions adds to errs what is wrong with the options of a room of
+// the game, keyed "options.<key>".
+func (g Game) validateOptions(options engine.Options, errs FieldErrors) {
+	for key, value := range options {
+		option, ok := g.Option(key)
+		if !ok {
+			errs["options."+key] = fmt.Sprintf("is not an option of %s", g.Key)
+		} else if problem := option.validate(value); problem != "" {
+			errs["options."+key] = problem
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package catalog
+
+// Games listed in the lobby whose rules are not implemented yet. Rooms can
+// be created for them but not started. Each one moves to its own package
+// under games/ together with its engine.
+func init() {
+	Register(Game{Key: "othello", DisplayName: "Othello", Icon: "othello.png", MinPlayers: 2, MaxPlayers: 2, VoiceChat: true, TextChat: true})
+	Register(Game{Key: "go", DisplayName: "Go", Icon: "go.png", MinPlayers: 2, MaxPlayers: 2, VoiceChat: true, TextChat: true})
+	Register(Game{Key: "checkers", DisplayName: "Checkers", Icon: "checkers.png", MinPlayers: 2, MaxPlayers: 2, VoiceChat: true, TextChat: true})
+	Register(Game{Key: "battleship", DisplayName: "Battleship", Icon: "battleship.png", MinPlayers: 2, MaxPlayers: 2, VoiceChat: true, TextChat: true})
+}
@@ -0,0 +1,306 @@
+// Package changefeed runs a single RethinkDB changefeed per table and fans
+// its changes out to every subscriber as typed events, instead of each
+// watcher opening and decoding its own cursor.
+//
+// A failed cursor is reopened with exponential backoff. Tables marked with
+// Backfill keep a copy of their documents, so after an outage the changes
+// that were missed are replayed as ordinary events and subscribers converge
+// on the current state of the table.
+package changefeed
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"reflect"
+	"sync"
+	"time"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v6"
+	"gopkg.in/rethinkdb/rethinkdb-go.v6/encoding"
+	"norex/database"
+)
+
+// Delays between attempts to reopen a failed cursor. The delay doubles
+// after every failed attempt and goes back to the minimum once the feed is
+// healthy again.
+const (
+	minRetryDelay = 500 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+)
+
+// Kind is what happened to a document.
+type Kind int
+
+const (
+	Insert Kind = iota + 1
+	Update
+	Delete
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Insert:
+		return "insert"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event is one change of one document. Old is nil for inserts and New is
+// nil for deletes.
+type Event struct {
+	Table string
+	Kind  Kind
+	Old   map[string]interface{}
+	New   map[string]interface{}
+}
+
+// Doc returns the document after the change, or before it for deletes.
+func (e Event) Doc() map[string]interface{} {
+	if e.New != nil {
+		return e.New
+	}
+	return e.Old
+}
+
+// ID returns the primary key of the changed document.
+func (e Event) ID() string {
+	id, _ := e.Doc()["id"].(string)
+	return id
+}
+
+// String reads a string field of the changed document.
+func (e Event) String(field string) string {
+	s, _ := e.Doc()[field].(string)
+	return s
+}
+
+// Decode decodes the changed document into v, e.g. a *models.Room.
+func (e Event) Decode(v interface{}) error {
+	return encoding.Decode(v, e.Doc())
+}
+
+// Handler receives the events of a table. Handlers of a table run one at a
+// time, in the order the changes happened, on the goroutine reading the
+// feed, so they must not block: database queries and other I/O belong on
+// a goroutine of the subscriber.
+type Handler func(Event)
+
+var (
+	mu         sync.Mutex
+	handlers   = make(map[string][]Handler)
+	started    = make(map[string]bool)
+	backfilled = make(map[string]bool)
+)
+
+// Backfill makes the feed of table replay what it missed while it was
+// disconnected. It keeps every document of the table in memory, so it is
+// meant for small tables such as rooms. Call it before Start.
+func Backfill(table string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	backfilled[table] = true
+}
+
+// Subscribe registers handler for the changes of table. Feeds of tables
+// subscribed after Start are opened right away.
+func Subscribe(table string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	handlers[table] = append(handlers[table], handler)
+	if len(started) > 0 && !started[table] {
+		started[table] = true
+		go run(table)
+	}
+}
+
+// Start opens one changefeed for every table that has subscribers.
+func Start() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for table := range handlers {
+		if !started[table] {
+			started[table] = true
+			go run(table)
+		}
+	}
+}
+
+func subscribers(table string) []Handler {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return append([]Handler(nil), handlers[table]...)
+}
+
+func dispatch(event Event) {
+	for _, handler := range subscribers(event.Table) {
+		handler(event)
+	}
+}
+
+// run keeps the changefeed of a table open, reopening it with exponential
+// backoff whenever the cursor fails.
+func run(table string) {
+	mu.Lock()
+	f := &feed{table: table}
+	if backfilled[table] {
+		f.docs = make(map[string]map[string]interface{})
+	}
+	mu.Unlock()
+
+	delay := minRetryDelay
+	for {
+		healthy, err := f.consume()
+		if healthy {
+			delay = minRetryDelay
+		}
+		log.Printf("Changefeed on %s failed, reconnecting in %s: %v", table, delay, err)
+
+		// Jitter keeps every feed from hitting a recovering server at once
+		time.Sleep(delay + time.Duration(rand.Int63n(int64(delay)/2)))
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// feed is the state of one table's changefeed across reconnects.
+type feed struct {
+	table string
+	// docs holds the last known version of every document of a backfilled
+	// table, nil for other tables
+	docs map[string]map[string]interface{}
+	// synced is set once docs has been loaded for the first time
+	synced bool
+
+	// documents seen while the current cursor was initializing
+	seen map[string]bool
+}
+
+// change is one message of a changefeed opened with include_types.
+type change struct {
+	Type  string                 `rethinkdb:"type"`
+	State string                 `rethinkdb:"state"`
+	Old   map[string]interface{} `rethinkdb:"old_val"`
+	New   map[string]interface{} `rethinkdb:"new_val"`
+}
+
+// consume reads the changefeed until the cursor fails. healthy reports
+// whether the cursor was opened and, for backfilled tables, got through
+// its initial snapshot.
+func (f *feed) consume() (healthy bool, err error) {
+	opts := rethinkdb.ChangesOpts{IncludeTypes: true}
+	if f.docs != nil {
+		opts.IncludeInitial = true
+		opts.IncludeStates = true
+	}
+	cursor, err := rethinkdb.Table(f.table).Changes(opts).Run(database.GetRethinkSession())
+	if err != nil {
+		return false, err
+	}
+	defer cursor.Close()
+
+	healthy = f.docs == nil
+	f.seen = make(map[string]bool)
+
+	var c change
+	for cursor.Next(&c) {
+		if f.apply(c) {
+			healthy = true
+		}
+		c = change{}
+	}
+	if err := cursor.Err(); err != nil {
+		return healthy, err
+	}
+	return healthy, errors.New("cursor closed")
+}
+
+// apply handles one message and reports whether the initial snapshot of a
+// backfilled table has just been completed.
+func (f *feed) apply(c change) bool {
+	switch c.Type {
+	case "state":
+		if c.State == "ready" && f.docs != nil {
+			f.finishBackfill()
+			return true
+		}
+		return false
+
+	case "initial":
+		if f.docs == nil || c.New == nil {
+			return false
+		}
+		id, _ := c.New["id"].(string)
+		f.seen[id] = true
+		old, known := f.docs[id]
+		f.docs[id] = c.New
+		if !f.synced {
+			// The first snapshot only fills the cache
+			return false
+		}
+		switch {
+		case !known:
+			dispatch(Event{Table: f.table, Kind: Insert, New: c.New})
+		case !reflect.DeepEqual(old, c.New):
+			dispatch(Event{Table: f.table, Kind: Update, Old: old, New: c.New})
+		}
+		return false
+
+	case "uninitial":
+		// A document of the snapshot was deleted before the snapshot ended
+		if f.docs != nil && c.Old != nil {
+			id, _ := c.Old["id"].(string)
+			delete(f.seen, id)
+		}
+		return false
+	}
+
+	event := Event{Table: f.table, Old: c.Old, New: c.New}
+	switch {
+	case c.Old == nil && c.New != nil:
+		event.Kind = Insert
+	case c.Old != nil && c.New == nil:
+		event.Kind = Delete
+	case c.Old != nil && c.New != nil:
+		event.Kind = Update
+	default:
+		return false
+	}
+	if f.docs != nil {
+		if event.Kind == Delete {
+			delete(f.docs, event.ID())
+		} else {
+			f.docs[event.ID()] = c.New
+			f.seen[event.ID()] = true
+		}
+	}
+	dispatch(event)
+	return false
+}
+
+// finishBackfill replays the deletes missed while the feed was down: every
+// cached document the new snapshot did not contain is gone.
+func (f *feed) finishBackfill() {
+	for id, doc := range f.docs {
+		if f.seen[id] {
+			continue
+		}
+		delete(f.docs, id)
+		if f.synced {
+			dispatch(Event{Table: f.table, Kind: Delete, Old: doc})
+		}
+	}
+	if f.synced {
+		log.Printf("Changefeed on %s caught up after reconnecting", f.table)
+	}
+	f.synced = true
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the server needs at startup.
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Mongo     MongoConfig     `yaml:"mongo" toml:"mongo"`
+	RethinkDB RethinkDBConfig `yaml:"rethinkdb" toml:"rethinkdb"`
+	SMTP      SMTPConfig      `yaml:"smtp" toml:"smtp"`
+	JWT       JWTConfig       `yaml:"jwt" toml:"jwt"`
+}
+
+type ServerConfig struct {
+	Address string `yaml:"address" toml:"address"` // e.g. ":9990"
+}
+
+type MongoConfig struct {
+	URI      string `yaml:"uri" toml:"uri"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	Database string `yaml:"database" toml:"database"`
+}
+
+type RethinkDBConfig struct {
+	Address  string `yaml:"address" toml:"address"`
+	Database string `yaml:"database" toml:"database"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	From     string `yaml:"from" toml:"from"`
+}
+
+type JWTConfig struct {
+	Secret string `yaml:"secret" toml:"secret"`
+}
+
+// Default returns the settings used when neither the config file nor the
+// environment provide a value. Credentials and hosts have no defaults.
+func Default() Config {
+	return Config{
+		Server:    ServerConfig{Address: ":9990"},
+		Mongo:     MongoConfig{Database: "norex_db"},
+		RethinkDB: RethinkDBConfig{Database: "norex-real-time"},
+		SMTP:      SMTPConfig{Host: "smtp.gmail.com", Port: 587},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML or TOML file
+// named by NOREX_CONFIG_FILE (if set) and finally the NOREX_* environment variables,
+// each layer overriding the previous one. The result is validated.
+func Load() (Config, error) {
+	cfg := Default()
+
+	if path := os.Getenv("NOREX_CONFIG_FILE"); path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := loadEnv(&cfg); err != nil {
+		return cfg, err
+	}
+
+	// The sender defaults to the SMTP account itself
+	if cfg.SMTP.From == "" {
+		cfg.SMTP.From = cfg.SMTP.Username
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile decodes a YAML or TOML file, picked by its extension, into cfg.
+// Unknown keys are rejected so that typos do not go unnoticed.
+func loadFile(path string, cfg *Config) error {
+	var decode func(file *os.File) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decode = func(file *os.File) error {
+			decoder := yaml.NewDecoder(file)
+			decoder.KnownFields(true)
+			return decoder.Decode(cfg)
+		}
+	case ".toml":
+		decode = func(file *os.File) error {
+			meta, err := toml.NewDecoder(file).Decode(cfg)
+			if err != nil {
+				return err
+			}
+			if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+				return fmt.Errorf("unknown keys %v", undecoded)
+			}
+			return nil
+		}
+	default:
+		return fmt.Errorf("config: unsupported config file type %q (use .yaml, .yml or .toml)", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: reading %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := decode(file); err != nil {
+		return fmt.Errorf("config: parsing %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func loadEnv(cfg *Config) error {
+	fields := map[string]*string{
+		"NOREX_SERVER_ADDRESS":     &cfg.Server.Address,
+		"NOREX_MONGO_URI":          &cfg.Mongo.URI,
+		"NOREX_MONGO_USERNAME":     &cfg.Mongo.Username,
+		"NOREX_MONGO_PASSWORD":     &cfg.Mongo.Password,
+		"NOREX_MONGO_DATABASE":     &cfg.Mongo.Database,
+		"NOREX_RETHINKDB_ADDRESS":  &cfg.RethinkDB.Address,
+		"NOREX_RETHINKDB_DATABASE": &cfg.RethinkDB.Database,
+		"NOREX_RETHINKDB_USERNAME": &cfg.RethinkDB.Username,
+		"NOREX_RETHINKDB_PASSWORD": &cfg.RethinkDB.Password,
+		"NOREX_SMTP_HOST":          &cfg.SMTP.Host,
+		"NOREX_SMTP_USERNAME":      &cfg.SMTP.Username,
+		"NOREX_SMTP_PASSWORD":      &cfg.SMTP.Password,
+		"NOREX_SMTP_FROM":          &cfg.SMTP.From,
+		"NOREX_JWT_SECRET":         &cfg.JWT.Secret,
+	}
+	for key, field := range fields {
+		if value, ok := os.LookupEnv(key); ok {
+			*field = value
+		}
+	}
+
+	if value, ok := os.LookupEnv("NOREX_SMTP_PORT"); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("config: NOREX_SMTP_PORT must be a number, got %q", value)
+		}
+		cfg.SMTP.Port = port
+	}
+
+	return nil
+}
+
+// Validate reports every missing or invalid setting at once so a broken
+// deployment can be fixed in a single pass.
+func (c Config) Validate() error {
+	var problems []string
+
+	if c.Server.Address == "" {
+		problems = append(problems, "server.address (NOREX_SERVER_ADDRESS) is required")
+	}
+	if c.Mongo.URI == "" {
+		problems = append(problems, "mongo.uri (NOREX_MONGO_URI) is required")
+	}
+	if c.Mongo.Database == "" {
+		problems = append(problems, "mongo.database (NOREX_MONGO_DATABASE) is required")
+	}
+	if c.RethinkDB.Address == "" {
+		problems = append(problems, "rethinkdb.address (NOREX_RETHINKDB_ADDRESS) is required")
+	}
+	if c.RethinkDB.Database == "" {
+		problems = append(problems, "rethinkdb.database (NOREX_RETHINKDB_DATABASE) is required")
+	}
+	if c.SMTP.Host == "" {
+		problems = append(problems, "smtp.host (NOREX_SMTP_HOST) is required")
+	}
+	if c.SMTP.Port <= 0 || c.SMTP.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("smtp.port (NOREX_SMTP_PORT) must be between 1 and 65535, got %d", c.SMTP.Port))
+	}
+	if c.SMTP.Username == "" {
+		problems = append(problems, "smtp.username (NOREX_SMTP_USERNAME) is required")
+	}
+	if c.SMTP.Password == "" {
+		problems = append(problems, "smtp.password (NOREX_SMTP_PASSWORD) is required")
+	}
+	if len(c.JWT.Secret) < 32 {
+		problems = append(problems, "jwt.secret (NOREX_JWT_SECRET) must be at least 32 characters")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("config: invalid configuration:\n  - " + strings.Join(problems, "\n  - "))
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{"yaml", "norex.yaml", "server:\n  address: \":8080\"\nsmtp:\n  port: 465\n", ""},
+		{"toml", "norex.toml", "[server]\naddress = \":8080\"\n\n[smtp]\nport = 465\n", ""},
+		{"unknown yaml key", "norex.yml", "server:\n  adress: \":8080\"\n", "adress"},
+		{"unknown toml key", "norex.toml", "[server]\nadress = \":8080\"\n", "adress"},
+		{"unsupported type", "norex.json", "{}", "unsupported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			cfg := Default()
+			err := loadFile(path, &cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadFile: %v, want an error about %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Address != ":8080" || cfg.SMTP.Port != 465 || cfg.SMTP.Host != "smtp.gmail.com" {
+				t.Fatalf("config = %+v, want the file over the defaults", cfg)
+			}
+		})
+	}
+}
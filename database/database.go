@@ -7,19 +7,25 @@ import (
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"norex/config"
 )
 
 var Client *mongo.Client
 
-func Connect() {
+var databaseName string
+
+func Connect(cfg config.MongoConfig) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// MongoDB connection string
-	clientOptions := options.Client().ApplyURI("mongodb://services.frn2.chabokan.net:47161").SetAuth(options.Credential{
-		Username: "root",             // Replace with your MongoDB username
-		Password: "cfEU9De2uPsghDsi", // Replace with your MongoDB password
-	})
+	clientOptions := options.Client().ApplyURI(cfg.URI)
+	if cfg.Username != "" {
+		clientOptions.SetAuth(options.Credential{
+			Username: cfg.Username,
+			Password: cfg.Password,
+		})
+	}
 
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
@@ -31,9 +37,10 @@ func Connect() {
 	}
 
 	Client = client
+	databaseName = cfg.Database
 	log.Println("Connected to MongoDB!")
 }
 
 func GetCollection(collectionName string) *mongo.Collection {
-	return Client.Database("norex_db").Collection(collectionName)
+	return Client.Database(databaseName).Collection(collectionName)
 }
@@ -4,18 +4,19 @@ import (
 	"log"
 
 	rethink "gopkg.in/rethinkdb/rethinkdb-go.v6"
+	"norex/config"
 )
 
 var session *rethink.Session
 
 // ConnectRethinkDB establishes a connection to RethinkDB with username and password.
-func ConnectRethinkDB() {
+func ConnectRethinkDB(cfg config.RethinkDBConfig) {
 	var err error
 	session, err = rethink.Connect(rethink.ConnectOpts{
-		Address:  "services.frn2.chabokan.net:23188", // Change if your RethinkDB is hosted elsewhere
-		Database: "norex-real-time",                  // Replace with your database name
-		Username: "admin",                            // Replace with your username
-		Password: "XRNnCq8fAFZ727yz",                 // Replace with your password
+		Address:  cfg.Address,
+		Database: cfg.Database,
+		Username: cfg.Username,
+		Password: cfg.Password,
 	})
 	if err != nil {
 		log.Fatalf("Failed to connect to RethinkDB: %v", err)
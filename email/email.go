@@ -3,21 +3,21 @@ package email
 import (
 	"fmt"
 	"github.com/go-mail/mail"
+	"norex/config"
 )
 
-const (
-	smtpHost     = "smtp.gmail.com"
-	smtpPort     = 587
-	smtpUsername = "thisisprofnajafi@gmail.com"
-	smtpPassword = "jstt whdr yluf uccz"
-	fromEmail    = "thisisprofnajafi@gmail.com"
-)
+var smtp config.SMTPConfig
+
+// Configure sets the SMTP account used to send emails.
+func Configure(cfg config.SMTPConfig) {
+	smtp = cfg
+}
 
 func SendVerificationEmail(toEmail, subject, body string) error {
 	m := mail.NewMessage()
 
 	// Set the sender email
-	m.SetHeader("From", fromEmail)
+	m.SetHeader("From", smtp.From)
 
 	// Set the recipient email (dynamic)
 	m.SetHeader("To", toEmail)
@@ -29,7 +29,7 @@ func SendVerificationEmail(toEmail, subject, body string) error {
 	m.SetBody("text/html", GenerateVerificationEmailBody(body))
 
 	// Create a new dialer with SMTP credentials
-	d := mail.NewDialer(smtpHost, smtpPort, smtpUsername, smtpPassword)
+	d := mail.NewDialer(smtp.Host, smtp.Port, smtp.Username, smtp.Password)
 
 	// Send the email
 	if err := d.DialAndSend(m); err != nil {
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"time"
+
+	"norex/settings"
+)
+
+// What happens to a player who runs out of time.
+const (
+	TimeoutForfeit  = settings.TimeoutForfeit
+	TimeoutAutoPlay = settings.TimeoutAutoPlay
+)
+
+// TimeControl is the time limit of a room.
+type TimeControl = settings.TimeControl
+
+// AutoPlayer is implemented by games that can pick a move for a player who
+// ran out of time, e.g. drawing a card in Uno.
+type AutoPlayer interface {
+	AutoMove(state State, player string) (Move, bool)
+}
+
+// Forfeiter is implemented by games that know how to end (or continue)
+// when a player loses on time. Games without it end with every other
+// player winning.
+type Forfeiter interface {
+	Forfeit(state State, player string) (State, error)
+}
+
+// clock keeps the time of every player in a game. Only the player whose
+// turn it is uses up time; the clock is paused while nobody can move.
+type clock struct {
+	tc        TimeControl
+	remaining map[string]time.Duration // bank left per player
+
+	current   string    // player being timed, "" while paused
+	turnStart time.Time // when the current player's turn began
+	chargedAt time.Time // up to when their bank has been charged
+}
+
+func newClock(tc TimeControl, players []string) *clock {
+	c := &clock{tc: tc, remaining: make(map[string]time.Duration)}
+	for _, player := range players {
+		c.remaining[player] = time.Duration(tc.BankSeconds) * time.Second
+	}
+	return c
+}
+
+// charge takes the time used since it was last charged from the current
+// player's bank. The turn itself keeps running: moves that do not hand the
+// turn over, like drawing in Uno or an opponent's out of turn move, do not
+// restart the turn limit.
+func (c *clock) charge(now time.Time) {
+	if c.current == "" {
+		return
+	}
+	if c.tc.BankSeconds > 0 {
+		c.remaining[c.current] -= now.Sub(c.chargedAt)
+		if c.remaining[c.current] < 0 {
+			c.remaining[c.current] = 0
+		}
+	}
+	c.chargedAt = now
+}
+
+// increment adds the Fischer increment to a player's bank.
+func (c *clock) increment(player string) {
+	if c.tc.BankSeconds > 0 {
+		c.remaining[player] += time.Duration(c.tc.IncrementSeconds) * time.Second
+	}
+}
+
+// switchTo starts timing player, or pauses the clock when player is "".
+func (c *clock) switchTo(player string, now time.Time) {
+	c.charge(now)
+	c.current = player
+	c.turnStart = now
+	c.chargedAt = now
+}
+
+// deadline returns how long the current player has left to move.
+func (c *clock) deadline(now time.Time) (time.Duration, bool) {
+	if c.current == "" {
+		return 0, false
+	}
+	left := time.Duration(-1)
+	if c.tc.BankSeconds > 0 {
+		left = c.remaining[c.current] - now.Sub(c.chargedAt)
+	}
+	if c.tc.TurnSeconds > 0 {
+		turnLeft := time.Duration(c.tc.TurnSeconds)*time.Second - now.Sub(c.turnStart)
+		if left < 0 || turnLeft < left {
+			left = turnLeft
+		}
+	}
+	if left < 0 {
+		left = 0
+	}
+	return left, true
+}
+
+// snapshot is the clock as sent to clients, in milliseconds.
+func (c *clock) snapshot(now time.Time) map[string]interface{} {
+
+	snapshot := map[string]interface{}{
+		"current": c.current,
+	}
+	if c.tc.BankSeconds > 0 {
+		banks := make(map[string]int64, len(c.remaining))
+		for player, left := range c.remaining {
+			if player == c.current {
+				left -= now.Sub(c.chargedAt)
+			}
+			if left < 0 {
+				left = 0
+			}
+			banks[player] = left.Milliseconds()
+		}
+		snapshot["remaining"] = banks
+	}
+	if c.tc.TurnSeconds > 0 && c.current != "" {
+		turnLeft := time.Duration(c.tc.TurnSeconds)*time.Second - now.Sub(c.turnStart)
+		if turnLeft < 0 {
+			turnLeft = 0
+		}
+		snapshot["turnRemaining"] = turnLeft.Milliseconds()
+	}
+	return snapshot
+}
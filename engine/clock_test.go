@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockTurnSpansMoves(t *testing.T) {
+	start := time.Now()
+	c := newClock(TimeControl{BankSeconds: 60, TurnSeconds: 10}, []string{"a", "b"})
+	c.switchTo("a", start)
+
+	// A move that keeps the turn, e.g. drawing in Uno, charges the bank
+	// but does not restart the turn limit
+	c.charge(start.Add(4 * time.Second))
+	left, running := c.deadline(start.Add(6 * time.Second))
+	if !running || left != 4*time.Second {
+		t.Fatalf("deadline = %v, %v; want 4s of the turn left", left, running)
+	}
+	if got := c.remaining["a"]; got != 56*time.Second {
+		t.Fatalf("bank = %v, want 56s", got)
+	}
+
+	// Handing the turn over charges the rest and starts a fresh turn
+	c.switchTo("b", start.Add(8*time.Second))
+	if got := c.remaining["a"]; got != 52*time.Second {
+		t.Fatalf("bank = %v, want 52s", got)
+	}
+	left, _ = c.deadline(start.Add(9 * time.Second))
+	if left != 9*time.Second {
+		t.Fatalf("deadline = %v, want 9s", left)
+	}
+}
+
+func TestClockBankDeadline(t *testing.T) {
+	start := time.Now()
+	c := newClock(TimeControl{BankSeconds: 5, TurnSeconds: 30}, []string{"a"})
+	c.switchTo("a", start)
+	c.charge(start.Add(2 * time.Second))
+
+	left, _ := c.deadline(start.Add(3 * time.Second))
+	if left != 2*time.Second {
+		t.Fatalf("deadline = %v, want the 2s left in the bank", left)
+	}
+
+	c.switchTo("", start.Add(10*time.Second))
+	if got := c.remaining["a"]; got != 0 {
+		t.Fatalf("bank = %v, want it to stop at 0", got)
+	}
+	if _, running := c.deadline(start.Add(11 * time.Second)); running {
+		t.Fatal("paused clock is running")
+	}
+}
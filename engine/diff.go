@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// normalize turns a view into plain JSON values (maps, slices, strings,
+// float64, bool, nil) so two views can be compared field by field.
+func normalize(view interface{}) (interface{}, error) {
+	data, err := json.Marshal(view)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// mergePatch returns a JSON Merge Patch (RFC 7386) that turns old into new:
+// changed keys carry their new value, removed keys are set to null and
+// arrays are always replaced as a whole. ok is false when nothing changed.
+func mergePatch(old, new interface{}) (patch interface{}, ok bool) {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if !oldIsMap || !newIsMap {
+		if reflect.DeepEqual(old, new) {
+			return nil, false
+		}
+		return new, true
+	}
+
+	out := make(map[string]interface{})
+	for key, newValue := range newMap {
+		oldValue, exists := oldMap[key]
+		if !exists {
+			out[key] = newValue
+			continue
+		}
+		if _, newIsObject := newValue.(map[string]interface{}); newIsObject {
+			if _, oldIsObject := oldValue.(map[string]interface{}); !oldIsObject {
+				out[key] = newValue
+				continue
+			}
+		}
+		if sub, changed := mergePatch(oldValue, newValue); changed {
+			out[key] = sub
+		}
+	}
+	for key := range oldMap {
+		if _, exists := newMap[key]; !exists {
+			out[key] = nil
+		}
+	}
+
+	if len(out) == 0 {
+		return nil, false
+	}
+	return out, true
+}
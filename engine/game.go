@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"time"
+
+	"norex/settings"
+)
+
+var (
+	// ErrNotYourTurn is returned when a player moves out of turn.
+	ErrNotYourTurn = errors.New("it is not your turn")
+	// ErrIllegalMove is returned by games when a move breaks the rules.
+	ErrIllegalMove = errors.New("illegal move")
+	// ErrGameOver is returned when a move is sent after the game ended.
+	ErrGameOver = errors.New("the game is over")
+	// ErrNotPlayer is returned when someone who is not seated tries to move.
+	ErrNotPlayer = errors.New("you are not playing in this game")
+	// ErrUnknownGame is returned when no rule set is registered for a game key.
+	ErrUnknownGame = errors.New("no engine is registered for this game")
+	// ErrGameInProgress is returned when starting a room that is already playing.
+	ErrGameInProgress = errors.New("a game is already in progress in this room")
+	// ErrPlayerCount is returned by NewState when the number of players is not supported.
+	ErrPlayerCount = errors.New("unsupported number of players")
+)
+
+// State is the full, authoritative state of one game. Each Game decides
+// its concrete type; the engine only passes it back to the same Game.
+type State interface{}
+
+// Options holds per-room house rules, e.g. {"stickTheDealer": true}.
+type Options = settings.Options
+
+// Setup is everything a Game needs to deal a new game.
+type Setup struct {
+	Players []string // player IDs in seat order
+	Options Options
+	Rand    *rand.Rand
+}
+
+// Move is a single player action as it arrives over the socket, e.g.
+// {"action": "play", "data": {"card": "r7"}}.
+type Move struct {
+	Action string          `json:"action"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// NewMove builds a move whose data is the JSON encoding of data.
+func NewMove(action string, data interface{}) Move {
+	move := Move{Action: action}
+	if data != nil {
+		move.Data, _ = json.Marshal(data)
+	}
+	return move
+}
+
+// Decode unmarshals the move data into v.
+func (m Move) Decode(v interface{}) error {
+	if len(m.Data) == 0 {
+		return ErrIllegalMove
+	}
+	if err := json.Unmarshal(m.Data, v); err != nil {
+		return ErrIllegalMove
+	}
+	return nil
+}
+
+// Game is a rule set that can be played by a Runner. Implementations must
+// not keep any state of their own: everything lives in the State value.
+type Game interface {
+	// NewState deals a new game for the given players.
+	NewState(setup Setup) (State, error)
+	// LegalMoves lists the moves player may make now. It may return nil for
+	// games where the move space is too large to enumerate.
+	LegalMoves(state State, player string) []Move
+	// ApplyMove validates and applies a move, returning the new state. It may
+	// update state in place, but a rejected move must leave it untouched.
+	ApplyMove(state State, player string, move Move) (State, error)
+	// CurrentPlayer returns whose turn it is, or "" while every player
+	// may act at once (e.g. passing cards in Hearts).
+	CurrentPlayer(state State) string
+	IsTerminal(state State) bool
+	// Winners returns the winning players once the game is over.
+	Winners(state State) []string
+	// PublicView is what spectators see.
+	PublicView(state State) interface{}
+	// PlayerView is what a seated player sees, including their own hidden
+	// information but nobody else's.
+	PlayerView(state State, player string) interface{}
+}
+
+// OutOfTurnGame is implemented by games that accept some moves from players
+// whose turn it is not, such as resigning.
+type OutOfTurnGame interface {
+	AllowsOutOfTurn(state State, player string, move Move) bool
+}
+
+// TimedGame is implemented by games that change on their own after a
+// delay, such as turning unmatched cards face down again.
+type TimedGame interface {
+	// Timer returns how long to wait before calling Timeout, or false when
+	// nothing is pending in this state.
+	Timer(state State) (time.Duration, bool)
+	Timeout(state State) (State, error)
+}
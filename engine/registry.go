@@ -0,0 +1,32 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	gamesMu sync.RWMutex
+	games   = make(map[string]Game)
+)
+
+// Register makes a rule set available under the given game key (the same
+// keys used in models.User.Games, e.g. "uno" or "chess").
+func Register(key string, game Game) {
+	gamesMu.Lock()
+	defer gamesMu.Unlock()
+
+	if _, exists := games[key]; exists {
+		panic(fmt.Sprintf("engine: game %q registered twice", key))
+	}
+	games[key] = game
+}
+
+// Lookup returns the rule set registered for a game key.
+func Lookup(key string) (Game, bool) {
+	gamesMu.RLock()
+	defer gamesMu.RUnlock()
+
+	game, ok := games[key]
+	return game, ok
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Ranker is implemented by games that rank every player when the game is
+// over instead of only naming the winners, e.g. by score.
+type Ranker interface {
+	// Standings groups the players from first place to last. Players
+	// sharing a place share a group.
+	Standings(state State) [][]string
+}
+
+// RankByScore ranks players by score, highest first, with equal scores
+// sharing a place. scores is indexed like players.
+func RankByScore(players []string, scores []int) [][]string {
+	seats := make([]int, len(players))
+	for i := range seats {
+		seats[i] = i
+	}
+	sort.SliceStable(seats, func(a, b int) bool { return scores[seats[a]] > scores[seats[b]] })
+
+	var standings [][]string
+	for i, seat := range seats {
+		if i > 0 && scores[seat] == scores[seats[i-1]] {
+			standings[len(standings)-1] = append(standings[len(standings)-1], players[seat])
+			continue
+		}
+		standings = append(standings, []string{players[seat]})
+	}
+	return standings
+}
+
+// Result is the outcome of a finished game.
+type Result struct {
+	RoomID    string
+	GameID    string // see Start
+	GameKey   string
+	Players   []string // in seat order
+	Winners   []string
+	Standings [][]string // from first place to last, see Ranker
+	// Moves counts the changes of the state after the deal: moves, moves
+	// played on timeout and forfeits
+	Moves     int
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// Duration is how long the game lasted.
+func (r Result) Duration() time.Duration {
+	return r.EndedAt.Sub(r.StartedAt)
+}
+
+var (
+	resultMu       sync.RWMutex
+	resultHandlers []func(Result)
+)
+
+// OnGameOver registers fn to be called once with the result of every game
+// that ends. Handlers run on their own goroutine, after the runner has
+// released its lock.
+func OnGameOver(fn func(Result)) {
+	resultMu.Lock()
+	defer resultMu.Unlock()
+
+	resultHandlers = append(resultHandlers, fn)
+}
+
+func reportResult(result Result) {
+	resultMu.RLock()
+	handlers := append([]func(Result){}, resultHandlers...)
+	resultMu.RUnlock()
+
+	for _, fn := range handlers {
+		fn(result)
+	}
+}
+
+// standingsLocked ranks the players of a finished game. Games that are not
+// a Ranker put the winners first and everyone else second; without
+// winners, e.g. after a draw, every player shares first place.
+func (r *Runner) standingsLocked() [][]string {
+	if ranker, ok := r.game.(Ranker); ok && !r.forfeited {
+		return ranker.Standings(r.state)
+	}
+
+	winners := r.winnersLocked()
+	won := make(map[string]bool, len(winners))
+	for _, winner := range winners {
+		won[winner] = true
+	}
+	var rest []string
+	for _, player := range r.players {
+		if !won[player] {
+			rest = append(rest, player)
+		}
+	}
+	if len(winners) == 0 || len(rest) == 0 {
+		return [][]string{append([]string(nil), r.players...)}
+	}
+	return [][]string{append([]string(nil), winners...), rest}
+}
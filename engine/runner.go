@@ -0,0 +1,513 @@
+package engine
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Broadcaster delivers engine events to the sockets of a room.
+type Broadcaster interface {
+	// Broadcast sends an event to every connection in the room.
+	Broadcast(roomID, event string, data interface{})
+	// SendTo sends an event to every connection of one user in the room.
+	SendTo(roomID, userID, event string, data interface{})
+	// SendToSpectators sends an event to every connection in the room
+	// whose user is not one of players.
+	SendToSpectators(roomID string, players []string, event string, data interface{})
+}
+
+// clockTick is how often the remaining time is broadcast while a clock runs.
+const clockTick = time.Second
+
+// Runner plays one game in one room. It owns the authoritative state,
+// applies moves one at a time in the order they arrive and pushes every
+// change to the room's sockets.
+type Runner struct {
+	mu sync.Mutex
+
+	roomID    string
+	gameID    string // the stored game record, reported in the Result
+	gameKey   string
+	game      Game
+	state     State
+	players   []string
+	seq       int
+	startedAt time.Time
+
+	// set when the runner itself ended the game, e.g. on time
+	forfeited bool
+	winners   []string
+	// set once the result has been reported to OnGameOver
+	reported bool
+
+	broadcaster Broadcaster
+	// last view sent to each player; "" holds the public view
+	lastViews map[string]interface{}
+
+	// pending TimedGame timer; bumping timerGen invalidates it
+	timer    *time.Timer
+	timerGen int
+
+	// nil when the room has no time control
+	clock      *clock
+	clockTimer *time.Timer
+	clockGen   int
+	ticker     *time.Ticker
+	stopTicks  chan struct{}
+}
+
+// NewRunner deals a new game and sends every player their initial view.
+func NewRunner(roomID, gameID, gameKey string, game Game, players []string, options Options, timeControl TimeControl, broadcaster Broadcaster) (*Runner, error) {
+	if options == nil {
+		options = Options{}
+	}
+	state, err := game.NewState(Setup{
+		Players: players,
+		Options: options,
+		Rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Runner{
+		roomID:      roomID,
+		gameID:      gameID,
+		gameKey:     gameKey,
+		game:        game,
+		state:       state,
+		players:     append([]string(nil), players...),
+		startedAt:   time.Now().UTC(),
+		broadcaster: broadcaster,
+		lastViews:   make(map[string]interface{}),
+	}
+	if timeControl.Enabled() {
+		r.clock = newClock(timeControl, r.players)
+		r.startTicksLocked()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.publishLocked()
+
+	return r, nil
+}
+
+func (r *Runner) RoomID() string {
+	return r.roomID
+}
+
+func (r *Runner) GameKey() string {
+	return r.gameKey
+}
+
+// Players returns the seated players in seat order.
+func (r *Runner) Players() []string {
+	return append([]string(nil), r.players...)
+}
+
+func (r *Runner) isPlayer(userID string) bool {
+	for _, player := range r.players {
+		if player == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) terminalLocked() bool {
+	return r.forfeited || r.game.IsTerminal(r.state)
+}
+
+func (r *Runner) winnersLocked() []string {
+	if r.forfeited {
+		return r.winners
+	}
+	return r.game.Winners(r.state)
+}
+
+// Submit applies a move from a player. Moves are serialized, so two moves
+// arriving at the same time are applied one after the other.
+func (r *Runner) Submit(player string, move Move) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.isPlayer(player) {
+		return ErrNotPlayer
+	}
+	if r.terminalLocked() {
+		return ErrGameOver
+	}
+	if current := r.game.CurrentPlayer(r.state); current != "" && current != player {
+		outOfTurn, ok := r.game.(OutOfTurnGame)
+		if !ok || !outOfTurn.AllowsOutOfTurn(r.state, player, move) {
+			return ErrNotYourTurn
+		}
+	}
+
+	return r.applyLocked(player, move)
+}
+
+// applyLocked applies a validated move, charges the mover's clock and
+// publishes the new state.
+func (r *Runner) applyLocked(player string, move Move) error {
+	before := r.game.CurrentPlayer(r.state)
+
+	state, err := r.game.ApplyMove(r.state, player, move)
+	if err != nil {
+		return err
+	}
+	r.state = state
+
+	if r.clock != nil {
+		r.clock.charge(time.Now())
+		// Fischer increment once the player's turn is over
+		if before == player && r.game.CurrentPlayer(r.state) != player {
+			r.clock.increment(player)
+		}
+	}
+
+	r.broadcaster.Broadcast(r.roomID, "game_move", map[string]interface{}{
+		"seq":    r.seq + 1,
+		"player": player,
+		"action": move.Action,
+	})
+	r.publishLocked()
+
+	return nil
+}
+
+// Snapshot returns the full view userID is allowed to see, with the
+// sequence number of the last published change.
+func (r *Runner) Snapshot(userID string) map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := map[string]interface{}{
+		"seq":     r.seq,
+		"gameKey": r.gameKey,
+		"view":    r.viewLocked(userID),
+	}
+	if r.clock != nil {
+		snapshot["clock"] = r.clock.snapshot(time.Now())
+	}
+	return snapshot
+}
+
+// LegalMoves lists the moves a player can make right now.
+func (r *Runner) LegalMoves(player string) []Move {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.isPlayer(player) || r.terminalLocked() {
+		return nil
+	}
+	return r.game.LegalMoves(r.state, player)
+}
+
+// Finished reports whether the game has reached a terminal state.
+func (r *Runner) Finished() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.terminalLocked()
+}
+
+func (r *Runner) viewLocked(userID string) interface{} {
+	if r.isPlayer(userID) {
+		return r.game.PlayerView(r.state, userID)
+	}
+	return r.game.PublicView(r.state)
+}
+
+// publishLocked sends each player the diff between their previous view and
+// the current one, then announces the end of the game if it is over.
+func (r *Runner) publishLocked() {
+	r.seq++
+
+	audiences := append([]string{""}, r.players...)
+	for _, userID := range audiences {
+		view, err := normalize(r.viewLocked(userID))
+		if err != nil {
+			log.Println("Error encoding game view:", err)
+			continue
+		}
+
+		previous, seen := r.lastViews[userID]
+		r.lastViews[userID] = view
+
+		event, payload := "game_state", map[string]interface{}{"seq": r.seq, "view": view}
+		if seen {
+			patch, changed := mergePatch(previous, view)
+			if !changed {
+				continue
+			}
+			event, payload = "game_state_diff", map[string]interface{}{"seq": r.seq, "patch": patch}
+		}
+
+		if userID == "" {
+			r.broadcaster.SendToSpectators(r.roomID, r.players, event, payload)
+		} else {
+			r.broadcaster.SendTo(r.roomID, userID, event, payload)
+		}
+	}
+
+	if r.terminalLocked() {
+		r.stopTicksLocked()
+		r.broadcaster.Broadcast(r.roomID, "game_over", map[string]interface{}{
+			"seq":     r.seq,
+			"winners": r.winnersLocked(),
+		})
+		if !r.reported {
+			r.reported = true
+			go reportResult(Result{
+				RoomID:    r.roomID,
+				GameID:    r.gameID,
+				GameKey:   r.gameKey,
+				Players:   append([]string(nil), r.players...),
+				Winners:   r.winnersLocked(),
+				Standings: r.standingsLocked(),
+				Moves:     r.seq - 1, // the deal was published first
+				StartedAt: r.startedAt,
+				EndedAt:   time.Now().UTC(),
+			})
+		}
+	}
+
+	r.scheduleLocked()
+	r.scheduleClockLocked()
+}
+
+// scheduleLocked replaces any pending timer with the one the game asks for.
+func (r *Runner) scheduleLocked() {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.timerGen++
+
+	timed, ok := r.game.(TimedGame)
+	if !ok || r.terminalLocked() {
+		return
+	}
+	delay, pending := timed.Timer(r.state)
+	if !pending {
+		return
+	}
+
+	gen := r.timerGen
+	r.timer = time.AfterFunc(delay, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		// A move or Stop got here first
+		if gen != r.timerGen {
+			return
+		}
+		state, err := timed.Timeout(r.state)
+		if err != nil {
+			log.Println("Error applying game timeout:", err)
+			return
+		}
+		r.state = state
+		r.publishLocked()
+	})
+}
+
+// scheduleClockLocked starts timing whoever has to move now and arms the
+// timer that fires when they run out of time. The clock is paused while
+// the game is over or the current player has nothing to do, e.g. while
+// memory cards are being shown.
+func (r *Runner) scheduleClockLocked() {
+	if r.clock == nil {
+		return
+	}
+	if r.clockTimer != nil {
+		r.clockTimer.Stop()
+		r.clockTimer = nil
+	}
+	r.clockGen++
+
+	now := time.Now()
+	current := r.game.CurrentPlayer(r.state)
+	if r.terminalLocked() || (current != "" && len(r.game.LegalMoves(r.state, current)) == 0) {
+		current = ""
+	}
+	if current != r.clock.current {
+		r.clock.switchTo(current, now)
+	}
+	r.broadcaster.Broadcast(r.roomID, "clock", r.clock.snapshot(now))
+
+	left, running := r.clock.deadline(now)
+	if !running {
+		return
+	}
+
+	gen := r.clockGen
+	r.clockTimer = time.AfterFunc(left, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if gen != r.clockGen {
+			return
+		}
+		r.timeoutLocked(current)
+	})
+}
+
+// timeoutLocked handles a player running out of time: their move is made
+// for them when the room allows it and the game supports it, otherwise
+// they forfeit.
+func (r *Runner) timeoutLocked(player string) {
+	r.clock.charge(time.Now())
+
+	if r.clock.tc.OnTimeout == TimeoutAutoPlay {
+		if auto, ok := r.game.(AutoPlayer); ok {
+			if move, ok := auto.AutoMove(r.state, player); ok {
+				r.broadcaster.Broadcast(r.roomID, "clock_timeout", map[string]interface{}{
+					"player": player,
+					"result": TimeoutAutoPlay,
+				})
+				// Restart the turn so the auto move is not charged again
+				r.clock.switchTo("", time.Now())
+				if err := r.applyLocked(player, move); err == nil {
+					return
+				}
+				log.Println("Error auto playing for", player)
+			}
+		}
+	}
+
+	r.broadcaster.Broadcast(r.roomID, "clock_timeout", map[string]interface{}{
+		"player": player,
+		"result": TimeoutForfeit,
+	})
+	r.clock.switchTo("", time.Now())
+	if forfeiter, ok := r.game.(Forfeiter); ok {
+		state, err := forfeiter.Forfeit(r.state, player)
+		if err == nil {
+			r.state = state
+			r.publishLocked()
+			return
+		}
+		log.Println("Error forfeiting game:", err)
+	}
+
+	// The game cannot continue without the player: everyone else wins
+	r.forfeited = true
+	r.winners = nil
+	for _, other := range r.players {
+		if other != player {
+			r.winners = append(r.winners, other)
+		}
+	}
+	r.publishLocked()
+}
+
+// startTicksLocked broadcasts the clock every second until the game is
+// over or the runner halts.
+func (r *Runner) startTicksLocked() {
+	r.ticker = time.NewTicker(clockTick)
+	r.stopTicks = make(chan struct{})
+	ticker, stop := r.ticker, r.stopTicks
+
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r.mu.Lock()
+				if r.clock.current != "" {
+					r.broadcaster.Broadcast(r.roomID, "clock", r.clock.snapshot(time.Now()))
+				}
+				r.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// halt cancels any pending timer so a discarded runner stops publishing.
+func (r *Runner) halt() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.timerGen++
+
+	if r.clockTimer != nil {
+		r.clockTimer.Stop()
+		r.clockTimer = nil
+	}
+	r.clockGen++
+	r.stopTicksLocked()
+}
+
+// stopTicksLocked ends the clock broadcasts, once the game is over or the
+// runner halts.
+func (r *Runner) stopTicksLocked() {
+	if r.ticker != nil {
+		r.ticker.Stop()
+		close(r.stopTicks)
+		r.ticker = nil
+	}
+}
+
+var (
+	runnersMu sync.RWMutex
+	runners   = make(map[string]*Runner)
+)
+
+// Start deals a new game of gameKey in a room and keeps its runner until
+// Stop is called. gameID names the stored record of the game, which has to
+// exist before the deal since a game may be over right away. Starting a
+// room that already has an unfinished game fails.
+func Start(roomID, gameID, gameKey string, players []string, options Options, timeControl TimeControl, broadcaster Broadcaster) (*Runner, error) {
+	game, ok := Lookup(gameKey)
+	if !ok {
+		return nil, ErrUnknownGame
+	}
+
+	runnersMu.Lock()
+	defer runnersMu.Unlock()
+
+	if existing, ok := runners[roomID]; ok && !existing.Finished() {
+		return nil, ErrGameInProgress
+	}
+
+	runner, err := NewRunner(roomID, gameID, gameKey, game, players, options, timeControl, broadcaster)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := runners[roomID]; ok {
+		existing.halt()
+	}
+	runners[roomID] = runner
+	return runner, nil
+}
+
+// RunnerFor returns the runner of a room, if a game was started in it.
+func RunnerFor(roomID string) (*Runner, bool) {
+	runnersMu.RLock()
+	defer runnersMu.RUnlock()
+
+	runner, ok := runners[roomID]
+	return runner, ok
+}
+
+// Stop forgets the runner of a room, e.g. when the room is deleted.
+func Stop(roomID string) {
+	runnersMu.Lock()
+	runner, ok := runners[roomID]
+	delete(runners, roomID)
+	runnersMu.Unlock()
+
+	if ok {
+		runner.halt()
+	}
+}
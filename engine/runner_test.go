@@ -0,0 +1,252 @@
+package engine
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a Broadcaster that keeps the events sent to the room.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (b *recorder) record(event string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, event)
+}
+
+func (b *recorder) Broadcast(_, event string, _ interface{}) { b.record(event) }
+func (b *recorder) SendTo(_, _, event string, _ interface{}) { b.record(event) }
+func (b *recorder) SendToSpectators(_ string, _ []string, event string, _ interface{}) {
+	b.record(event)
+}
+
+func (b *recorder) count(event string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, e := range b.events {
+		if e == event {
+			n++
+		}
+	}
+	return n
+}
+
+// turnGame takes turns around the table until limit moves were made; the
+// last player to move wins.
+type turnGame struct{}
+
+type turnState struct {
+	players  []string
+	turn     int
+	moves    int
+	limit    int
+	timeouts int // TimedGame timeouts applied
+}
+
+func (turnGame) NewState(setup Setup) (State, error) {
+	return &turnState{players: setup.Players, limit: setup.Options.Int("limit", 4)}, nil
+}
+
+func (turnGame) LegalMoves(st State, player string) []Move {
+	s := st.(*turnState)
+	if s.moves >= s.limit || s.players[s.turn] != player {
+		return nil
+	}
+	return []Move{NewMove("move", nil)}
+}
+
+func (turnGame) ApplyMove(st State, player string, move Move) (State, error) {
+	s := st.(*turnState)
+	if move.Action != "move" {
+		return nil, ErrIllegalMove
+	}
+	s.moves++
+	s.turn = (s.turn + 1) % len(s.players)
+	return s, nil
+}
+
+func (turnGame) CurrentPlayer(st State) string {
+	s := st.(*turnState)
+	return s.players[s.turn]
+}
+
+func (turnGame) IsTerminal(st State) bool {
+	s := st.(*turnState)
+	return s.moves >= s.limit
+}
+
+func (turnGame) Winners(st State) []string {
+	s := st.(*turnState)
+	if s.moves < s.limit {
+		return nil
+	}
+	return []string{s.players[(s.turn+len(s.players)-1)%len(s.players)]}
+}
+
+func (turnGame) PublicView(st State) interface{} {
+	s := st.(*turnState)
+	return map[string]int{"turn": s.turn, "moves": s.moves, "timeouts": s.timeouts}
+}
+
+func (g turnGame) PlayerView(st State, _ string) interface{} {
+	return g.PublicView(st)
+}
+
+// autoTurnGame moves for a player who runs out of time.
+type autoTurnGame struct{ turnGame }
+
+func (autoTurnGame) AutoMove(st State, player string) (Move, bool) {
+	return NewMove("move", nil), true
+}
+
+// timedTurnGame times out a few milliseconds after every move.
+type timedTurnGame struct{ turnGame }
+
+func (timedTurnGame) Timer(st State) (time.Duration, bool) {
+	s := st.(*turnState)
+	return 5 * time.Millisecond, s.moves > s.timeouts
+}
+
+func (timedTurnGame) Timeout(st State) (State, error) {
+	s := st.(*turnState)
+	s.timeouts++
+	return s, nil
+}
+
+func TestRunnerSubmit(t *testing.T) {
+	r, err := NewRunner("room", "game", "turns", turnGame{}, []string{"a", "b"}, Options{"limit": 2}, TimeControl{}, &recorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		player string
+		want   error
+	}{
+		{"c", ErrNotPlayer},
+		{"b", ErrNotYourTurn},
+		{"a", nil},
+		{"b", nil},
+		{"a", ErrGameOver},
+	}
+	for _, tt := range tests {
+		if err := r.Submit(tt.player, NewMove("move", nil)); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: Submit = %v, want %v", tt.player, err, tt.want)
+		}
+	}
+	if winners := r.winnersLocked(); len(winners) != 1 || winners[0] != "b" {
+		t.Fatalf("winners = %v, want [b]", winners)
+	}
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		game        Game
+		onTimeout   string
+		wantMoves   int
+		wantWinners []string
+	}{
+		{"forfeit", turnGame{}, TimeoutForfeit, 0, []string{"b", "c"}},
+		{"auto play", autoTurnGame{}, TimeoutAutoPlay, 1, nil},
+		{"auto play unsupported", turnGame{}, TimeoutAutoPlay, 0, []string{"b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := TimeControl{TurnSeconds: 60, OnTimeout: tt.onTimeout}
+			r, err := NewRunner("room", "game", "turns", tt.game, []string{"a", "b", "c"}, nil, tc, &recorder{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.halt()
+
+			r.mu.Lock()
+			r.timeoutLocked("a")
+			moves, winners, terminal := r.state.(*turnState).moves, r.winnersLocked(), r.terminalLocked()
+			current := r.clock.current
+			r.mu.Unlock()
+
+			if moves != tt.wantMoves {
+				t.Fatalf("moves = %d, want %d", moves, tt.wantMoves)
+			}
+			if terminal != (tt.wantWinners != nil) {
+				t.Fatalf("terminal = %v, want %v", terminal, tt.wantWinners != nil)
+			}
+			if len(winners) != len(tt.wantWinners) {
+				t.Fatalf("winners = %v, want %v", winners, tt.wantWinners)
+			}
+			for i := range winners {
+				if winners[i] != tt.wantWinners[i] {
+					t.Fatalf("winners = %v, want %v", winners, tt.wantWinners)
+				}
+			}
+			if !terminal && current != "b" {
+				t.Fatalf("clock runs for %q, want b after the auto move", current)
+			}
+		})
+	}
+}
+
+func TestRunnerClockRunsOut(t *testing.T) {
+	b := &recorder{}
+	r, err := NewRunner("room", "game", "turns", turnGame{}, []string{"a", "b"}, nil, TimeControl{TurnSeconds: 1}, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.halt()
+
+	for deadline := time.Now().Add(3 * time.Second); !r.Finished(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the game did not end on time")
+		}
+	}
+	if b.count("clock_timeout") != 1 || b.count("game_over") != 1 {
+		t.Fatalf("events = %v, want one clock_timeout and one game_over", b.events)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ticker != nil {
+		t.Fatal("the clock still ticks after the game is over")
+	}
+}
+
+func TestRunnerTimedGame(t *testing.T) {
+	r, err := NewRunner("room", "game", "turns", timedTurnGame{}, []string{"a", "b"}, nil, TimeControl{}, &recorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.halt()
+
+	if err := r.Submit("a", NewMove("move", nil)); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		r.mu.Lock()
+		timeouts := r.state.(*turnState).timeouts
+		r.mu.Unlock()
+		if timeouts == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the game timer did not fire")
+		}
+	}
+
+	// Halting cancels the timer scheduled by the next move
+	if err := r.Submit("b", NewMove("move", nil)); err != nil {
+		t.Fatal(err)
+	}
+	r.halt()
+	time.Sleep(20 * time.Millisecond)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if timeouts := r.state.(*turnState).timeouts; timeouts != 1 {
+		t.Fatalf("timeouts = %d after halt, want 1", timeouts)
+	}
+}
@@ -0,0 +1,158 @@
+// Package cards is the standard 52-card deck shared by the card games:
+// cards, decks, card codes used in moves and sorting of hands.
+package cards
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Suits in the order hands are sorted in.
+const (
+	Clubs    = "clubs"
+	Diamonds = "diamonds"
+	Spades   = "spades"
+	Hearts   = "hearts"
+)
+
+// Suits lists every suit in sorting order.
+var Suits = []string{Clubs, Diamonds, Spades, Hearts}
+
+// Ranks lists every rank from lowest to highest, aces high.
+var Ranks = []string{"2", "3", "4", "5", "6", "7", "8", "9", "10", "J", "Q", "K", "A"}
+
+// Card is a playing card.
+type Card struct {
+	Suit string `json:"suit"`
+	Rank string `json:"rank"`
+}
+
+// Code identifies the card in moves: its rank followed by the first
+// letter of its suit, e.g. "QS", "10H" or "2C".
+func (c Card) Code() string {
+	return c.Rank + strings.ToUpper(c.Suit[:1])
+}
+
+// Value orders the ranks from 2 for a two to 14 for an ace.
+func (c Card) Value() int {
+	for i, rank := range Ranks {
+		if rank == c.Rank {
+			return i + 2
+		}
+	}
+	return 0
+}
+
+func (c Card) String() string {
+	return c.Code()
+}
+
+// Parse reads a card code produced by Code. It is case-insensitive.
+func Parse(code string) (Card, bool) {
+	code = strings.ToUpper(code)
+	if len(code) < 2 {
+		return Card{}, false
+	}
+	rank, letter := code[:len(code)-1], code[len(code)-1:]
+	for _, suit := range Suits {
+		if strings.ToUpper(suit[:1]) != letter {
+			continue
+		}
+		for _, r := range Ranks {
+			if r == rank {
+				return Card{Suit: suit, Rank: rank}, true
+			}
+		}
+	}
+	return Card{}, false
+}
+
+// MustParse parses every code like Parse and panics on an invalid one.
+// It is meant for tests and fixed tables of cards.
+func MustParse(codes ...string) []Card {
+	parsed := make([]Card, 0, len(codes))
+	for _, code := range codes {
+		card, ok := Parse(code)
+		if !ok {
+			panic("cards: invalid card code " + strconv.Quote(code))
+		}
+		parsed = append(parsed, card)
+	}
+	return parsed
+}
+
+// NewDeck returns the 52 cards, or only those of the given ranks when
+// ranks is not empty, e.g. the 24 cards of Euchre.
+func NewDeck(ranks ...string) []Card {
+	if len(ranks) == 0 {
+		ranks = Ranks
+	}
+	deck := make([]Card, 0, len(Suits)*len(ranks))
+	for _, suit := range Suits {
+		for _, rank := range ranks {
+			deck = append(deck, Card{Suit: suit, Rank: rank})
+		}
+	}
+	return deck
+}
+
+// Shuffle shuffles cards in place.
+func Shuffle(cards []Card, rng *rand.Rand) {
+	rng.Shuffle(len(cards), func(i, j int) {
+		cards[i], cards[j] = cards[j], cards[i]
+	})
+}
+
+// Deal deals n cards to each of players hands, one at a time, and returns
+// the hands and what is left of the deck.
+func Deal(deck []Card, players, n int) ([][]Card, []Card) {
+	hands := make([][]Card, players)
+	for i := 0; i < n; i++ {
+		for p := range hands {
+			hands[p] = append(hands[p], deck[len(deck)-1])
+			deck = deck[:len(deck)-1]
+		}
+	}
+	return hands, deck
+}
+
+// Index returns the position of card in hand, or -1.
+func Index(hand []Card, card Card) int {
+	for i, held := range hand {
+		if held == card {
+			return i
+		}
+	}
+	return -1
+}
+
+// Remove returns hand without the card at index i.
+func Remove(hand []Card, i int) []Card {
+	return append(hand[:i:i], hand[i+1:]...)
+}
+
+// HasSuit reports whether hand holds a card of suit.
+func HasSuit(hand []Card, suit string) bool {
+	for _, card := range hand {
+		if card.Suit == suit {
+			return true
+		}
+	}
+	return false
+}
+
+// Sort orders a hand by suit, then by rank.
+func Sort(hand []Card) {
+	suitOrder := make(map[string]int, len(Suits))
+	for i, suit := range Suits {
+		suitOrder[suit] = i
+	}
+	sort.SliceStable(hand, func(i, j int) bool {
+		if hand[i].Suit != hand[j].Suit {
+			return suitOrder[hand[i].Suit] < suitOrder[hand[j].Suit]
+		}
+		return hand[i].Value() < hand[j].Value()
+	})
+}
@@ -0,0 +1,675 @@
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StartFEN is the standard starting position.
+const StartFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// Squares are numbered a1=0, b1=1, ..., h8=63. Pieces use FEN letters:
+// uppercase for white, lowercase for black and 0 for an empty square.
+type position struct {
+	board     [64]byte
+	white     bool // white to move
+	castling  string
+	epSquare  int // en passant target square, -1 if none
+	halfmoves int // half moves since the last capture or pawn move
+	fullmoves int
+}
+
+type move struct {
+	from, to  int
+	promotion byte // lowercase piece letter, 0 if none
+}
+
+// uci returns the move in UCI notation, e.g. "e2e4" or "e7e8q".
+func (m move) uci() string {
+	s := squareName(m.from) + squareName(m.to)
+	if m.promotion != 0 {
+		s += string(m.promotion)
+	}
+	return s
+}
+
+func squareName(sq int) string {
+	return string([]byte{byte('a' + sq%8), byte('1' + sq/8)})
+}
+
+func parseSquare(name string) (int, bool) {
+	if len(name) != 2 || name[0] < 'a' || name[0] > 'h' || name[1] < '1' || name[1] > '8' {
+		return 0, false
+	}
+	return int(name[1]-'1')*8 + int(name[0]-'a'), true
+}
+
+func parseUCI(s string) (move, bool) {
+	if len(s) != 4 && len(s) != 5 {
+		return move{}, false
+	}
+	from, ok1 := parseSquare(s[0:2])
+	to, ok2 := parseSquare(s[2:4])
+	if !ok1 || !ok2 {
+		return move{}, false
+	}
+	m := move{from: from, to: to}
+	if len(s) == 5 {
+		switch p := s[4] | 0x20; p {
+		case 'q', 'r', 'b', 'n':
+			m.promotion = p
+		default:
+			return move{}, false
+		}
+	}
+	return m, true
+}
+
+func isWhite(piece byte) bool {
+	return piece >= 'A' && piece <= 'Z'
+}
+
+// lower returns the piece letter without its color.
+func lower(piece byte) byte {
+	return piece | 0x20
+}
+
+var errInvalidFEN = errors.New("invalid FEN")
+
+// parseFEN reads a position in Forsyth-Edwards Notation.
+func parseFEN(fen string) (*position, error) {
+	fields := strings.Fields(fen)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("%w: expected at least 4 fields", errInvalidFEN)
+	}
+
+	p := &position{epSquare: -1, fullmoves: 1}
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return nil, fmt.Errorf("%w: expected 8 ranks", errInvalidFEN)
+	}
+	kings := map[byte]int{}
+	for i, rank := range ranks {
+		file := 0
+		for _, ch := range []byte(rank) {
+			switch {
+			case ch >= '1' && ch <= '8':
+				file += int(ch - '0')
+			case strings.IndexByte("PNBRQKpnbrqk", ch) >= 0:
+				if file > 7 {
+					return nil, fmt.Errorf("%w: rank %d is too long", errInvalidFEN, 8-i)
+				}
+				if lower(ch) == 'p' && (i == 0 || i == 7) {
+					return nil, fmt.Errorf("%w: pawn on the back rank", errInvalidFEN)
+				}
+				p.board[(7-i)*8+file] = ch
+				kings[ch]++
+				file++
+			default:
+				return nil, fmt.Errorf("%w: unexpected %q", errInvalidFEN, ch)
+			}
+		}
+		if file != 8 {
+			return nil, fmt.Errorf("%w: rank %d does not have 8 squares", errInvalidFEN, 8-i)
+		}
+	}
+	if kings['K'] != 1 || kings['k'] != 1 {
+		return nil, fmt.Errorf("%w: each side needs exactly one king", errInvalidFEN)
+	}
+
+	switch fields[1] {
+	case "w":
+		p.white = true
+	case "b":
+	default:
+		return nil, fmt.Errorf("%w: side to move must be w or b", errInvalidFEN)
+	}
+
+	if fields[2] != "-" {
+		for _, ch := range []byte(fields[2]) {
+			if strings.IndexByte("KQkq", ch) < 0 || strings.IndexByte(p.castling, ch) >= 0 {
+				return nil, fmt.Errorf("%w: bad castling rights %q", errInvalidFEN, fields[2])
+			}
+			p.castling += string(ch)
+		}
+		p.castling = normalizeCastling(p.castling)
+		p.dropImpossibleCastling()
+	}
+
+	if fields[3] != "-" {
+		sq, ok := parseSquare(fields[3])
+		if !ok || (sq/8 != 2 && sq/8 != 5) {
+			return nil, fmt.Errorf("%w: bad en passant square %q", errInvalidFEN, fields[3])
+		}
+		p.epSquare = sq
+	}
+
+	if len(fields) > 4 {
+		n, err := strconv.Atoi(fields[4])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%w: bad halfmove clock", errInvalidFEN)
+		}
+		p.halfmoves = n
+	}
+	if len(fields) > 5 {
+		n, err := strconv.Atoi(fields[5])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%w: bad fullmove number", errInvalidFEN)
+		}
+		p.fullmoves = n
+	}
+
+	// The side that just moved may not be in check
+	if p.attacked(p.kingSquare(!p.white), p.white) {
+		return nil, fmt.Errorf("%w: the side not to move is in check", errInvalidFEN)
+	}
+
+	return p, nil
+}
+
+func normalizeCastling(rights string) string {
+	out := ""
+	for _, ch := range "KQkq" {
+		if strings.ContainsRune(rights, ch) {
+			out += string(ch)
+		}
+	}
+	return out
+}
+
+// dropImpossibleCastling removes rights whose king or rook has left its square.
+func (p *position) dropImpossibleCastling() {
+	keep := ""
+	for _, ch := range []byte(p.castling) {
+		var king, rook int
+		var piece byte = 'K'
+		switch ch {
+		case 'K':
+			king, rook = 4, 7
+		case 'Q':
+			king, rook = 4, 0
+		case 'k':
+			king, rook, piece = 60, 63, 'k'
+		case 'q':
+			king, rook, piece = 60, 56, 'k'
+		}
+		rookPiece := byte('R')
+		if piece == 'k' {
+			rookPiece = 'r'
+		}
+		if p.board[king] == piece && p.board[rook] == rookPiece {
+			keep += string(ch)
+		}
+	}
+	p.castling = keep
+}
+
+// fen writes the position in Forsyth-Edwards Notation.
+func (p *position) fen() string {
+	return fmt.Sprintf("%s %d %d", p.key(), p.halfmoves, p.fullmoves)
+}
+
+// key is the FEN without the move counters. Two positions with the same key
+// count as the same position for threefold repetition.
+func (p *position) key() string {
+	var sb strings.Builder
+	for rank := 7; rank >= 0; rank-- {
+		empty := 0
+		for file := 0; file < 8; file++ {
+			piece := p.board[rank*8+file]
+			if piece == 0 {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			sb.WriteByte(piece)
+		}
+		if empty > 0 {
+			sb.WriteByte(byte('0' + empty))
+		}
+		if rank > 0 {
+			sb.WriteByte('/')
+		}
+	}
+
+	if p.white {
+		sb.WriteString(" w ")
+	} else {
+		sb.WriteString(" b ")
+	}
+	if p.castling == "" {
+		sb.WriteString("-")
+	} else {
+		sb.WriteString(p.castling)
+	}
+
+	// Only record en passant when a capture is actually possible
+	if p.epSquare >= 0 && p.canCaptureEnPassant() {
+		sb.WriteString(" " + squareName(p.epSquare))
+	} else {
+		sb.WriteString(" -")
+	}
+	return sb.String()
+}
+
+func (p *position) canCaptureEnPassant() bool {
+	for _, m := range p.legalMoves() {
+		if m.to == p.epSquare && lower(p.board[m.from]) == 'p' {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *position) kingSquare(white bool) int {
+	king := byte('k')
+	if white {
+		king = 'K'
+	}
+	for sq, piece := range p.board {
+		if piece == king {
+			return sq
+		}
+	}
+	return -1
+}
+
+var (
+	knightSteps = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingSteps   = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	rookDirs    = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	bishopDirs  = [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
+
+// offset returns the square df files and dr ranks away from sq, or -1 if
+// that falls off the board.
+func offset(sq, df, dr int) int {
+	file, rank := sq%8+df, sq/8+dr
+	if file < 0 || file > 7 || rank < 0 || rank > 7 {
+		return -1
+	}
+	return rank*8 + file
+}
+
+// attacked reports whether sq is attacked by the given side.
+func (p *position) attacked(sq int, byWhite bool) bool {
+	own := func(piece byte, letter byte) bool {
+		return piece != 0 && lower(piece) == letter && isWhite(piece) == byWhite
+	}
+
+	// Pawns attack diagonally forward, so look backwards from sq
+	dr := -1
+	if !byWhite {
+		dr = 1
+	}
+	for _, df := range []int{-1, 1} {
+		if from := offset(sq, df, dr); from >= 0 && own(p.board[from], 'p') {
+			return true
+		}
+	}
+	for _, step := range knightSteps {
+		if from := offset(sq, step[0], step[1]); from >= 0 && own(p.board[from], 'n') {
+			return true
+		}
+	}
+	for _, step := range kingSteps {
+		if from := offset(sq, step[0], step[1]); from >= 0 && own(p.board[from], 'k') {
+			return true
+		}
+	}
+	slide := func(dirs [][2]int, letters string) bool {
+		for _, dir := range dirs {
+			for from := offset(sq, dir[0], dir[1]); from >= 0; from = offset(from, dir[0], dir[1]) {
+				piece := p.board[from]
+				if piece == 0 {
+					continue
+				}
+				if isWhite(piece) == byWhite && strings.IndexByte(letters, lower(piece)) >= 0 {
+					return true
+				}
+				break
+			}
+		}
+		return false
+	}
+	return slide(rookDirs, "rq") || slide(bishopDirs, "bq")
+}
+
+func (p *position) inCheck() bool {
+	return p.attacked(p.kingSquare(p.white), !p.white)
+}
+
+// pseudoMoves generates every move of the side to move, ignoring whether it
+// leaves that side's king in check.
+func (p *position) pseudoMoves() []move {
+	var moves []move
+	for from, piece := range p.board {
+		if piece == 0 || isWhite(piece) != p.white {
+			continue
+		}
+		enemy := func(sq int) bool {
+			return p.board[sq] != 0 && isWhite(p.board[sq]) != p.white
+		}
+		add := func(to int) {
+			moves = append(moves, move{from: from, to: to})
+		}
+
+		switch lower(piece) {
+		case 'p':
+			dir, startRank, lastRank := 1, 1, 7
+			if !p.white {
+				dir, startRank, lastRank = -1, 6, 0
+			}
+			addPawn := func(to int) {
+				if to/8 == lastRank {
+					for _, promo := range []byte("qrbn") {
+						moves = append(moves, move{from: from, to: to, promotion: promo})
+					}
+					return
+				}
+				add(to)
+			}
+			if to := offset(from, 0, dir); to >= 0 && p.board[to] == 0 {
+				addPawn(to)
+				if from/8 == startRank {
+					if to2 := offset(from, 0, 2*dir); p.board[to2] == 0 {
+						add(to2)
+					}
+				}
+			}
+			for _, df := range []int{-1, 1} {
+				to := offset(from, df, dir)
+				if to < 0 {
+					continue
+				}
+				if enemy(to) {
+					addPawn(to)
+				} else if to == p.epSquare {
+					add(to)
+				}
+			}
+		case 'n', 'k':
+			steps := knightSteps
+			if lower(piece) == 'k' {
+				steps = kingSteps
+			}
+			for _, step := range steps {
+				if to := offset(from, step[0], step[1]); to >= 0 && (p.board[to] == 0 || enemy(to)) {
+					add(to)
+				}
+			}
+		case 'b', 'r', 'q':
+			var dirs [][2]int
+			switch lower(piece) {
+			case 'b':
+				dirs = bishopDirs
+			case 'r':
+				dirs = rookDirs
+			default:
+				dirs = append(append([][2]int{}, rookDirs...), bishopDirs...)
+			}
+			for _, dir := range dirs {
+				for to := offset(from, dir[0], dir[1]); to >= 0; to = offset(to, dir[0], dir[1]) {
+					if p.board[to] == 0 {
+						add(to)
+						continue
+					}
+					if enemy(to) {
+						add(to)
+					}
+					break
+				}
+			}
+		}
+	}
+
+	moves = append(moves, p.castlingMoves()...)
+	return moves
+}
+
+// castlingMoves returns the castling moves allowed by the castling rights:
+// the squares between king and rook must be empty and the king may not
+// start on, cross or land on an attacked square.
+func (p *position) castlingMoves() []move {
+	var moves []move
+	type castle struct {
+		right          byte
+		king, rook, to int
+		between        []int
+		crossed        []int
+	}
+	options := []castle{
+		{'K', 4, 7, 6, []int{5, 6}, []int{4, 5, 6}},
+		{'Q', 4, 0, 2, []int{1, 2, 3}, []int{4, 3, 2}},
+	}
+	if !p.white {
+		options = []castle{
+			{'k', 60, 63, 62, []int{61, 62}, []int{60, 61, 62}},
+			{'q', 60, 56, 58, []int{57, 58, 59}, []int{60, 59, 58}},
+		}
+	}
+
+	for _, c := range options {
+		if strings.IndexByte(p.castling, c.right) < 0 {
+			continue
+		}
+		clear := true
+		for _, sq := range c.between {
+			if p.board[sq] != 0 {
+				clear = false
+			}
+		}
+		for _, sq := range c.crossed {
+			if clear && p.attacked(sq, !p.white) {
+				clear = false
+			}
+		}
+		if clear {
+			moves = append(moves, move{from: c.king, to: c.to})
+		}
+	}
+	return moves
+}
+
+// legalMoves generates every move that does not leave the mover in check.
+func (p *position) legalMoves() []move {
+	var legal []move
+	for _, m := range p.pseudoMoves() {
+		next := p.play(m)
+		if !next.attacked(next.kingSquare(p.white), !p.white) {
+			legal = append(legal, m)
+		}
+	}
+	return legal
+}
+
+func (p *position) isLegal(m move) bool {
+	for _, legal := range p.legalMoves() {
+		if legal == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *position) isCapture(m move) bool {
+	return p.board[m.to] != 0 || (lower(p.board[m.from]) == 'p' && m.to == p.epSquare)
+}
+
+func (p *position) isCastle(m move) bool {
+	return lower(p.board[m.from]) == 'k' && (m.to-m.from == 2 || m.from-m.to == 2)
+}
+
+// play returns the position after m. It does not check legality.
+func (p *position) play(m move) *position {
+	next := *p
+	piece := p.board[m.from]
+	capture := p.isCapture(m)
+
+	next.board[m.from] = 0
+	next.board[m.to] = piece
+	if m.promotion != 0 {
+		if isWhite(piece) {
+			next.board[m.to] = m.promotion - 0x20
+		} else {
+			next.board[m.to] = m.promotion
+		}
+	}
+
+	switch {
+	case lower(piece) == 'p' && m.to == p.epSquare:
+		// En passant removes the pawn behind the target square
+		if isWhite(piece) {
+			next.board[m.to-8] = 0
+		} else {
+			next.board[m.to+8] = 0
+		}
+	case p.isCastle(m):
+		rookFrom, rookTo := m.from+3, m.from+1
+		if m.to < m.from {
+			rookFrom, rookTo = m.from-4, m.from-1
+		}
+		next.board[rookTo] = next.board[rookFrom]
+		next.board[rookFrom] = 0
+	}
+
+	next.epSquare = -1
+	if lower(piece) == 'p' && (m.to-m.from == 16 || m.from-m.to == 16) {
+		next.epSquare = (m.from + m.to) / 2
+	}
+
+	next.castling = p.castling
+	if next.castling != "" {
+		next.dropImpossibleCastling()
+	}
+
+	if capture || lower(piece) == 'p' {
+		next.halfmoves = 0
+	} else {
+		next.halfmoves = p.halfmoves + 1
+	}
+	if !p.white {
+		next.fullmoves = p.fullmoves + 1
+	}
+	next.white = !p.white
+	return &next
+}
+
+// san returns the move in Standard Algebraic Notation, e.g. "Nbd7",
+// "exd6", "e8=Q+" or "O-O-O#". m must be legal.
+func (p *position) san(m move) string {
+	piece := p.board[m.from]
+	var sb strings.Builder
+
+	switch {
+	case p.isCastle(m):
+		if m.to > m.from {
+			sb.WriteString("O-O")
+		} else {
+			sb.WriteString("O-O-O")
+		}
+	case lower(piece) == 'p':
+		if p.isCapture(m) {
+			sb.WriteByte(squareName(m.from)[0])
+			sb.WriteByte('x')
+		}
+		sb.WriteString(squareName(m.to))
+		if m.promotion != 0 {
+			sb.WriteByte('=')
+			sb.WriteByte(m.promotion - 0x20)
+		}
+	default:
+		sb.WriteByte(lower(piece) - 0x20)
+
+		// Disambiguate between identical pieces that can reach the same square
+		sameFile, sameRank, ambiguous := false, false, false
+		for _, other := range p.legalMoves() {
+			if other.to != m.to || other.from == m.from || p.board[other.from] != piece {
+				continue
+			}
+			ambiguous = true
+			if other.from%8 == m.from%8 {
+				sameFile = true
+			}
+			if other.from/8 == m.from/8 {
+				sameRank = true
+			}
+		}
+		name := squareName(m.from)
+		switch {
+		case ambiguous && !sameFile:
+			sb.WriteByte(name[0])
+		case ambiguous && !sameRank:
+			sb.WriteByte(name[1])
+		case ambiguous:
+			sb.WriteString(name)
+		}
+
+		if p.isCapture(m) {
+			sb.WriteByte('x')
+		}
+		sb.WriteString(squareName(m.to))
+	}
+
+	next := p.play(m)
+	if next.inCheck() {
+		if len(next.legalMoves()) == 0 {
+			sb.WriteByte('#')
+		} else {
+			sb.WriteByte('+')
+		}
+	}
+	return sb.String()
+}
+
+// insufficientMaterial reports positions where neither side can ever mate:
+// king against king, king and one minor piece against king, or kings with
+// bishops that all stand on squares of the same color.
+func (p *position) insufficientMaterial() bool {
+	minors := 0
+	bishopColors := map[int]bool{}
+	for sq, piece := range p.board {
+		if piece == 0 {
+			continue
+		}
+		switch lower(piece) {
+		case 'k':
+		case 'n':
+			minors++
+		case 'b':
+			minors++
+			bishopColors[(sq/8+sq%8)%2] = true
+		default:
+			return false
+		}
+	}
+	if minors <= 1 {
+		return true
+	}
+	// Only bishops left, all on the same color
+	knights := 0
+	for _, piece := range p.board {
+		if lower(piece) == 'n' {
+			knights++
+		}
+	}
+	return knights == 0 && len(bishopColors) == 1
+}
+
+// loneKing reports whether one side has nothing left but its king.
+func (p *position) loneKing(white bool) bool {
+	for _, piece := range p.board {
+		if piece == 0 || lower(piece) == 'k' {
+			continue
+		}
+		if isWhite(piece) == white {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package chess
+
+import "testing"
+
+func perft(p *position, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+	nodes := 0
+	for _, m := range p.legalMoves() {
+		nodes += perft(p.play(m), depth-1)
+	}
+	return nodes
+}
+
+func TestPerft(t *testing.T) {
+	tests := []struct {
+		name  string
+		fen   string
+		depth int
+		nodes int
+	}{
+		{"start", StartFEN, 3, 8902},
+		{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 2, 2039},
+		{"en passant and promotions", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", 3, 2812},
+		{"castling through check", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", 3, 9467},
+		{"promotion with check", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", 2, 1486},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseFEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := perft(p, tt.depth); got != tt.nodes {
+				t.Errorf("perft(%d) = %d, want %d", tt.depth, got, tt.nodes)
+			}
+		})
+	}
+}
+
+func TestInsufficientMaterial(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		want bool
+	}{
+		{"king v king", "8/8/4k3/8/8/3K4/8/8 w - - 0 1", true},
+		{"king and knight v king", "8/8/4k3/8/8/3KN3/8/8 w - - 0 1", true},
+		{"king and bishop v king", "8/8/4k3/8/8/3K4/5B2/8 b - - 0 1", true},
+		{"bishops on one color", "8/8/4k3/2b5/8/3K4/5B2/8 w - - 0 1", true},
+		{"bishops on both colors", "8/8/4k3/1b6/8/3K4/5B2/8 w - - 0 1", false},
+		{"two knights", "8/8/4k3/8/8/3KNN2/8/8 w - - 0 1", false},
+		{"king and pawn v king", "8/8/4k3/8/8/3K4/4P3/8 w - - 0 1", false},
+		{"king and rook v king", "8/8/4k3/8/8/3K4/8/7R w - - 0 1", false},
+		{"start", StartFEN, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseFEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.insufficientMaterial(); got != tt.want {
+				t.Errorf("insufficientMaterial() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFEN(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		want string // "" when the FEN is rejected
+	}{
+		{"start", StartFEN, StartFEN},
+		{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"},
+		{"counters default", "8/8/4k3/8/8/3K4/8/8 b - -", "8/8/4k3/8/8/3K4/8/8 b - - 0 1"},
+		{"castling sorted", "r3k2r/8/8/8/8/8/8/R3K2R w qkQK - 0 1", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"},
+		{"impossible castling dropped", "r3k3/8/8/8/8/8/8/4K2R w KQkq - 0 1", "r3k3/8/8/8/8/8/8/4K2R w Kq - 0 1"},
+		{"en passant capturable", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 2", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 2"},
+		{"en passant not capturable", "4k3/8/8/3p4/8/8/8/4K3 w - d6 0 2", "4k3/8/8/3p4/8/8/8/4K3 w - - 0 2"},
+		{"too few fields", "8/8/8/8/8/8/8/8 w", ""},
+		{"seven ranks", "8/8/8/8/8/8/4K2k w - - 0 1", ""},
+		{"long rank", "9/8/4k3/8/8/3K4/8/8 w - - 0 1", ""},
+		{"two white kings", "8/8/4k3/8/8/3K4/8/K7 w - - 0 1", ""},
+		{"pawn on the back rank", "P7/8/4k3/8/8/3K4/8/8 w - - 0 1", ""},
+		{"bad side to move", "8/8/4k3/8/8/3K4/8/8 x - - 0 1", ""},
+		{"bad en passant square", "8/8/4k3/8/8/3K4/8/8 w - e4 0 1", ""},
+		{"side not to move in check", "4k3/8/8/8/8/8/8/4RK2 w - - 0 1", ""},
+		{"bad fullmove number", "8/8/4k3/8/8/3K4/8/8 w - - 0 0", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseFEN(tt.fen)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("parseFEN accepted %q", tt.fen)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.fen(); got != tt.want {
+				t.Fatalf("fen = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSAN(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		uci  string
+		want string
+	}{
+		{"pawn push", StartFEN, "e2e4", "e4"},
+		{"knight", StartFEN, "g1f3", "Nf3"},
+		{"kingside castling", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"queenside castling", "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", "O-O-O"},
+		{"pawn capture", "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", "e4d5", "exd5"},
+		{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 2", "e5d6", "exd6"},
+		{"promotion with check", "8/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e7e8q", "e8=Q"},
+		{"underpromotion", "3r4/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e7d8n", "exd8=N"},
+		{"file disambiguation", "4k3/8/8/8/8/8/6K1/R6R w - - 0 1", "a1d1", "Rad1"},
+		{"rank disambiguation", "4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "a1a3", "R1a3"},
+		{"check", "4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", "Ra8+"},
+		{"mate", "6k1/5ppp/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", "Ra8#"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseFEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, ok := parseUCI(tt.uci)
+			if !ok || !p.isLegal(m) {
+				t.Fatalf("%s is not legal", tt.uci)
+			}
+			if got := p.san(m); got != tt.want {
+				t.Fatalf("san = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
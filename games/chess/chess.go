@@ -0,0 +1,394 @@
+// Package chess implements the rules of chess for the game engine, with
+// FEN import and export and PGN export of finished games.
+package chess
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"norex/catalog"
+	"norex/engine"
+)
+
+// Results in PGN notation.
+const (
+	whiteWins = "1-0"
+	blackWins = "0-1"
+	draw      = "1/2-1/2"
+)
+
+// state is the authoritative state of a chess game. The first player plays
+// white and the second black.
+type state struct {
+	players   [2]string
+	startFEN  string
+	startedAt time.Time
+
+	pos         *position
+	sanMoves    []string
+	uciMoves    []string
+	repetitions map[string]int
+
+	drawOffer   string // player who offered a draw, "" if none
+	result      string // "" while the game is running
+	termination string
+}
+
+// Game is the chess rule set.
+type Game struct{}
+
+func init() {
+	catalog.Register(catalog.Game{
+		Key:         "chess",
+		DisplayName: "Chess",
+		Icon:        "chess.png",
+		MinPlayers:  2,
+		MaxPlayers:  2,
+		VoiceChat:   true,
+		TextChat:    true,
+		Options: []catalog.Option{
+			{Key: "fen", Kind: catalog.OptionString, Default: StartFEN, Validate: validateFEN},
+		},
+		New: func() engine.Game { return Game{} },
+	})
+}
+
+// validateFEN checks the "fen" option of a room when it is saved.
+func validateFEN(value interface{}) error {
+	_, err := parseFEN(value.(string))
+	return err
+}
+
+// NewState sets up the board for exactly two players. The "fen" option
+// starts the game from a custom position instead of the initial one.
+func (Game) NewState(setup engine.Setup) (engine.State, error) {
+	if len(setup.Players) != 2 {
+		return nil, engine.ErrPlayerCount
+	}
+
+	fen := setup.Options.String("fen", StartFEN)
+	pos, err := parseFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &state{
+		players:     [2]string{setup.Players[0], setup.Players[1]},
+		startFEN:    pos.fen(),
+		startedAt:   time.Now().UTC(),
+		pos:         pos,
+		repetitions: map[string]int{pos.key(): 1},
+	}
+	s.checkGameOver()
+	return s, nil
+}
+
+func (s *state) colorOf(player string) (white bool, ok bool) {
+	switch player {
+	case s.players[0]:
+		return true, true
+	case s.players[1]:
+		return false, true
+	}
+	return false, false
+}
+
+func (s *state) toMove() string {
+	if s.pos.white {
+		return s.players[0]
+	}
+	return s.players[1]
+}
+
+type moveData struct {
+	Move string `json:"move"` // UCI notation, e.g. "e2e4" or "e7e8q"
+}
+
+func (Game) LegalMoves(st engine.State, player string) []engine.Move {
+	s := st.(*state)
+	if s.result != "" {
+		return nil
+	}
+	white, ok := s.colorOf(player)
+	if !ok {
+		return nil
+	}
+
+	moves := []engine.Move{engine.NewMove("resign", nil)}
+	if white != s.pos.white {
+		return moves
+	}
+	for _, m := range s.pos.legalMoves() {
+		moves = append(moves, engine.NewMove("move", moveData{Move: m.uci()}))
+	}
+	if s.drawOffer != "" && s.drawOffer != player {
+		moves = append(moves, engine.NewMove("accept_draw", nil))
+	} else if s.drawOffer == "" {
+		moves = append(moves, engine.NewMove("offer_draw", nil))
+	}
+	return moves
+}
+
+// AllowsOutOfTurn lets a player resign while their opponent is thinking.
+func (Game) AllowsOutOfTurn(_ engine.State, _ string, move engine.Move) bool {
+	return move.Action == "resign"
+}
+
+func (Game) ApplyMove(st engine.State, player string, mv engine.Move) (engine.State, error) {
+	s := st.(*state)
+	white, ok := s.colorOf(player)
+	if !ok {
+		return nil, engine.ErrNotPlayer
+	}
+	if s.result != "" {
+		return nil, engine.ErrGameOver
+	}
+
+	if mv.Action == "resign" {
+		if white {
+			s.finish(blackWins, "resignation")
+		} else {
+			s.finish(whiteWins, "resignation")
+		}
+		return s, nil
+	}
+	if white != s.pos.white {
+		return nil, engine.ErrNotYourTurn
+	}
+
+	switch mv.Action {
+	case "offer_draw":
+		if s.drawOffer != "" {
+			return nil, fmt.Errorf("%w: a draw has already been offered", engine.ErrIllegalMove)
+		}
+		s.drawOffer = player
+		return s, nil
+
+	case "accept_draw":
+		if s.drawOffer == "" || s.drawOffer == player {
+			return nil, fmt.Errorf("%w: there is no draw offer to accept", engine.ErrIllegalMove)
+		}
+		s.finish(draw, "draw agreement")
+		return s, nil
+
+	case "move":
+		var data moveData
+		if err := mv.Decode(&data); err != nil {
+			return nil, err
+		}
+		m, ok := parseUCI(strings.ToLower(data.Move))
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not a move in UCI notation", engine.ErrIllegalMove, data.Move)
+		}
+		if !s.pos.isLegal(m) {
+			return nil, fmt.Errorf("%w: %s is not legal here", engine.ErrIllegalMove, data.Move)
+		}
+
+		// Making a move declines the opponent's draw offer
+		if s.drawOffer != "" && s.drawOffer != player {
+			s.drawOffer = ""
+		}
+		s.sanMoves = append(s.sanMoves, s.pos.san(m))
+		s.uciMoves = append(s.uciMoves, m.uci())
+		s.pos = s.pos.play(m)
+		s.repetitions[s.pos.key()]++
+		s.checkGameOver()
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown action %q", engine.ErrIllegalMove, mv.Action)
+}
+
+// checkGameOver ends the game on checkmate, stalemate, threefold
+// repetition, the fifty-move rule or insufficient material.
+func (s *state) checkGameOver() {
+	if len(s.pos.legalMoves()) == 0 {
+		if !s.pos.inCheck() {
+			s.finish(draw, "stalemate")
+		} else if s.pos.white {
+			s.finish(blackWins, "checkmate")
+		} else {
+			s.finish(whiteWins, "checkmate")
+		}
+		return
+	}
+
+	switch {
+	case s.repetitions[s.pos.key()] >= 3:
+		s.finish(draw, "threefold repetition")
+	case s.pos.halfmoves >= 100:
+		s.finish(draw, "fifty-move rule")
+	case s.pos.insufficientMaterial():
+		s.finish(draw, "insufficient material")
+	}
+}
+
+// Forfeit ends the game when a player runs out of time. Their opponent
+// wins unless they only have a king left, in which case it is a draw.
+func (Game) Forfeit(st engine.State, player string) (engine.State, error) {
+	s := st.(*state)
+	white, ok := s.colorOf(player)
+	if !ok {
+		return nil, engine.ErrNotPlayer
+	}
+	if s.result != "" {
+		return nil, engine.ErrGameOver
+	}
+
+	switch {
+	case s.pos.loneKing(!white):
+		s.finish(draw, "timeout vs insufficient material")
+	case white:
+		s.finish(blackWins, "time forfeit")
+	default:
+		s.finish(whiteWins, "time forfeit")
+	}
+	return s, nil
+}
+
+func (s *state) finish(result, termination string) {
+	s.result = result
+	s.termination = termination
+	s.drawOffer = ""
+}
+
+func (Game) CurrentPlayer(st engine.State) string {
+	s := st.(*state)
+	if s.result != "" {
+		return ""
+	}
+	return s.toMove()
+}
+
+func (Game) IsTerminal(st engine.State) bool {
+	return st.(*state).result != ""
+}
+
+func (Game) Winners(st engine.State) []string {
+	switch s := st.(*state); s.result {
+	case whiteWins:
+		return []string{s.players[0]}
+	case blackWins:
+		return []string{s.players[1]}
+	}
+	return nil
+}
+
+// PGN exports the game in Portable Game Notation.
+func (s *state) PGN() string {
+	result := s.result
+	if result == "" {
+		result = "*"
+	}
+
+	var sb strings.Builder
+	tags := [][2]string{
+		{"Event", "Norex game"},
+		{"Site", "norex.app"},
+		{"Date", s.startedAt.Format("2006.01.02")},
+		{"Round", "-"},
+		{"White", s.players[0]},
+		{"Black", s.players[1]},
+		{"Result", result},
+	}
+	if s.startFEN != StartFEN {
+		tags = append(tags, [2]string{"SetUp", "1"}, [2]string{"FEN", s.startFEN})
+	}
+	if s.termination != "" {
+		tags = append(tags, [2]string{"Termination", s.termination})
+	}
+	for _, tag := range tags {
+		value := strings.ReplaceAll(strings.ReplaceAll(tag[1], `\`, `\\`), `"`, `\"`)
+		fmt.Fprintf(&sb, "[%s \"%s\"]\n", tag[0], value)
+	}
+	sb.WriteString("\n")
+
+	// Move text, wrapped at 80 columns
+	start, _ := parseFEN(s.startFEN)
+	number, white := start.fullmoves, start.white
+	var tokens []string
+	for i, san := range s.sanMoves {
+		if white {
+			tokens = append(tokens, fmt.Sprintf("%d.", number))
+		} else if i == 0 {
+			tokens = append(tokens, fmt.Sprintf("%d...", number))
+		}
+		tokens = append(tokens, san)
+		if !white {
+			number++
+		}
+		white = !white
+	}
+	tokens = append(tokens, result)
+
+	line := 0
+	for i, token := range tokens {
+		if i > 0 {
+			if line+1+len(token) > 80 {
+				sb.WriteString("\n")
+				line = 0
+			} else {
+				sb.WriteString(" ")
+				line++
+			}
+		}
+		sb.WriteString(token)
+		line += len(token)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+type view struct {
+	FEN         string   `json:"fen"`
+	White       string   `json:"white"`
+	Black       string   `json:"black"`
+	Turn        string   `json:"turn"` // "white" or "black"
+	InCheck     bool     `json:"inCheck"`
+	Moves       []string `json:"moves"` // SAN
+	LastMove    string   `json:"lastMove,omitempty"`
+	DrawOffer   string   `json:"drawOffer,omitempty"`
+	Result      string   `json:"result,omitempty"`
+	Termination string   `json:"termination,omitempty"`
+	PGN         string   `json:"pgn,omitempty"` // once the game is over
+
+	Color string `json:"color,omitempty"` // only in a player's own view
+}
+
+func (Game) PublicView(st engine.State) interface{} {
+	s := st.(*state)
+	v := view{
+		FEN:         s.pos.fen(),
+		White:       s.players[0],
+		Black:       s.players[1],
+		Turn:        "black",
+		InCheck:     s.pos.inCheck(),
+		Moves:       append([]string{}, s.sanMoves...),
+		DrawOffer:   s.drawOffer,
+		Result:      s.result,
+		Termination: s.termination,
+	}
+	if s.pos.white {
+		v.Turn = "white"
+	}
+	if len(s.uciMoves) > 0 {
+		v.LastMove = s.uciMoves[len(s.uciMoves)-1]
+	}
+	if s.result != "" {
+		v.PGN = s.PGN()
+	}
+	return v
+}
+
+func (g Game) PlayerView(st engine.State, player string) interface{} {
+	s := st.(*state)
+	v := g.PublicView(st).(view)
+	if white, ok := s.colorOf(player); ok {
+		v.Color = "black"
+		if white {
+			v.Color = "white"
+		}
+	}
+	return v
+}
@@ -0,0 +1,114 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+
+	"norex/engine"
+)
+
+func newGame(t *testing.T, fen string) *state {
+	t.Helper()
+	options := engine.Options{}
+	if fen != "" {
+		options["fen"] = fen
+	}
+	st, err := Game{}.NewState(engine.Setup{Players: []string{"white", "black"}, Options: options})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st.(*state)
+}
+
+func play(t *testing.T, s *state, moves ...string) {
+	t.Helper()
+	for _, uci := range moves {
+		if _, err := (Game{}).ApplyMove(s, s.toMove(), engine.NewMove("move", moveData{Move: uci})); err != nil {
+			t.Fatalf("%s: %v", uci, err)
+		}
+	}
+}
+
+func TestPGN(t *testing.T) {
+	tests := []struct {
+		name     string
+		fen      string
+		moves    []string
+		tags     []string
+		movetext string
+	}{
+		{
+			name:     "scholar's mate",
+			moves:    []string{"e2e4", "e7e5", "f1c4", "b8c6", "d1h5", "g8f6", "h5f7"},
+			tags:     []string{`[White "white"]`, `[Black "black"]`, `[Result "1-0"]`, `[Termination "checkmate"]`},
+			movetext: "1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qxf7# 1-0",
+		},
+		{
+			name:     "black to move in a set up position",
+			fen:      "4k3/8/8/8/8/8/4p3/4K3 b - - 0 40",
+			moves:    []string{"e8d7", "e1e2"},
+			tags:     []string{`[SetUp "1"]`, `[FEN "4k3/8/8/8/8/8/4p3/4K3 b - - 0 40"]`, `[Result "1/2-1/2"]`, `[Termination "insufficient material"]`},
+			movetext: "40... Kd7 41. Kxe2 1/2-1/2",
+		},
+		{
+			name:     "unfinished",
+			moves:    []string{"d2d4"},
+			tags:     []string{`[Result "*"]`},
+			movetext: "1. d4 *",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGame(t, tt.fen)
+			play(t, s, tt.moves...)
+
+			pgn := s.PGN()
+			headers, movetext, ok := strings.Cut(pgn, "\n\n")
+			if !ok {
+				t.Fatalf("no blank line after the tags:\n%s", pgn)
+			}
+			for _, tag := range tt.tags {
+				if !strings.Contains(headers, tag) {
+					t.Errorf("missing %s in\n%s", tag, headers)
+				}
+			}
+			if tt.fen == "" && strings.Contains(headers, "FEN") {
+				t.Errorf("FEN tag for the standard start:\n%s", headers)
+			}
+			if got := strings.TrimSpace(movetext); got != tt.movetext {
+				t.Errorf("movetext = %q, want %q", got, tt.movetext)
+			}
+		})
+	}
+}
+
+func TestPGNWrapsLines(t *testing.T) {
+	s := newGame(t, "")
+	// The closed Ruy Lopez, Chigorin variation
+	play(t, s, "e2e4", "e7e5", "g1f3", "b8c6", "f1b5", "a7a6", "b5a4", "g8f6", "e1g1", "f8e7", "f1e1",
+		"b7b5", "a4b3", "d7d6", "c2c3", "e8g8", "h2h3", "c6a5", "b3c2", "c7c5", "d2d4", "d8c7")
+
+	_, movetext, _ := strings.Cut(s.PGN(), "\n\n")
+	lines := strings.Split(strings.TrimSpace(movetext), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("movetext is not wrapped:\n%s", movetext)
+	}
+	for _, line := range lines {
+		if len(line) > 80 {
+			t.Errorf("line of %d columns: %q", len(line), line)
+		}
+	}
+}
+
+func TestCustomFENRejected(t *testing.T) {
+	_, err := Game{}.NewState(engine.Setup{
+		Players: []string{"white", "black"},
+		Options: engine.Options{"fen": "8/8/8/8/8/8/8/8 w - - 0 1"},
+	})
+	if err == nil {
+		t.Fatal("a board without kings was accepted")
+	}
+	if err := validateFEN("8/8/8/8/8/8/8/8 w - - 0 1"); err == nil {
+		t.Fatal("validateFEN accepted a board without kings")
+	}
+}
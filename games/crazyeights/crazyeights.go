@@ -0,0 +1,527 @@
+// Package crazyeights implements Crazy Eights for two to seven players for
+// the game engine.
+package crazyeights
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	"norex/catalog"
+	"norex/engine"
+	"norex/games/cards"
+)
+
+const (
+	minPlayers = 2
+	maxPlayers = 7
+	// Two players get seven cards, more players five
+	smallHandSize      = 7
+	largeHandSize      = 5
+	defaultTargetScore = 100
+
+	wildRank = "8"
+)
+
+// points is what a card left in a hand is worth to the player going out.
+func points(card cards.Card) int {
+	switch card.Rank {
+	case wildRank:
+		return 50
+	case "J", "Q", "K":
+		return 10
+	case "A":
+		return 1
+	}
+	n, _ := strconv.Atoi(card.Rank)
+	return n
+}
+
+func handPoints(hand []cards.Card) int {
+	total := 0
+	for _, card := range hand {
+		total += points(card)
+	}
+	return total
+}
+
+func validSuit(suit string) bool {
+	for _, s := range cards.Suits {
+		if s == suit {
+			return true
+		}
+	}
+	return false
+}
+
+// state is the authoritative state of a Crazy Eights game.
+type state struct {
+	rng *rand.Rand
+
+	players    []string
+	hands      [][]cards.Card
+	stock      []cards.Card
+	discard    []cards.Card
+	activeSuit string // suit to match, declared when an eight is played
+	turn       int
+	dealer     int
+
+	// drawn is the card the current player just drew and may still play
+	drawn *cards.Card
+	// passes counts the players in a row who could neither play nor draw;
+	// when everyone did, the hand is blocked
+	passes int
+
+	drawUntilPlayable bool
+	scores            []int
+	targetScore       int
+	round             int
+	lastRound         *roundResult
+	winner            int // -1 until someone reaches the target score
+}
+
+type roundResult struct {
+	Round   int    `json:"round"`
+	Winner  string `json:"winner"`
+	Points  int    `json:"points"`
+	Blocked bool   `json:"blocked,omitempty"` // nobody could go out
+}
+
+// Game is the Crazy Eights rule set.
+type Game struct{}
+
+func init() {
+	catalog.Register(catalog.Game{
+		Key:         "crazy_eight",
+		DisplayName: "Crazy Eights",
+		Icon:        "crazy_eight.png",
+		MinPlayers:  minPlayers,
+		MaxPlayers:  maxPlayers,
+		VoiceChat:   true,
+		TextChat:    true,
+		Options: []catalog.Option{
+			{Key: "targetScore", Kind: catalog.OptionInt, Default: defaultTargetScore, Min: 50, Max: 1000},
+			{Key: "drawUntilPlayable", Kind: catalog.OptionBool, Default: true},
+		},
+		New: func() engine.Game { return Game{} },
+	})
+}
+
+// NewState deals the first hand. The "targetScore" option sets the score
+// that ends the game (100 by default). With "drawUntilPlayable" (the
+// default) a player who draws keeps drawing until they get a card they
+// can play; turned off they draw a single card.
+func (Game) NewState(setup engine.Setup) (engine.State, error) {
+	if len(setup.Players) < minPlayers || len(setup.Players) > maxPlayers {
+		return nil, engine.ErrPlayerCount
+	}
+
+	s := &state{
+		rng:               setup.Rand,
+		players:           append([]string(nil), setup.Players...),
+		dealer:            len(setup.Players) - 1,
+		drawUntilPlayable: setup.Options.Bool("drawUntilPlayable", true),
+		scores:            make([]int, len(setup.Players)),
+		targetScore:       setup.Options.Int("targetScore", defaultTargetScore),
+		winner:            -1,
+	}
+	if s.targetScore <= 0 {
+		s.targetScore = defaultTargetScore
+	}
+	s.deal()
+	return s, nil
+}
+
+// deal shuffles and deals a new hand and turns up the starter card. An
+// eight may not start the discard pile: it goes back into the stock.
+func (s *state) deal() {
+	s.round++
+	deck := cards.NewDeck()
+	cards.Shuffle(deck, s.rng)
+	handSize := smallHandSize
+	if len(s.players) > 2 {
+		handSize = largeHandSize
+	}
+	s.hands, s.stock = cards.Deal(deck, len(s.players), handSize)
+	for _, hand := range s.hands {
+		cards.Sort(hand)
+	}
+
+	for {
+		starter := s.stock[len(s.stock)-1]
+		s.stock = s.stock[:len(s.stock)-1]
+		if starter.Rank != wildRank {
+			s.discard = []cards.Card{starter}
+			s.activeSuit = starter.Suit
+			break
+		}
+		at := s.rng.Intn(len(s.stock))
+		s.stock = append(s.stock[:at], append([]cards.Card{starter}, s.stock[at:]...)...)
+	}
+
+	s.drawn = nil
+	s.passes = 0
+	s.turn = (s.dealer + 1) % len(s.players)
+}
+
+func (s *state) top() cards.Card {
+	return s.discard[len(s.discard)-1]
+}
+
+func (s *state) seatOf(player string) int {
+	for i, p := range s.players {
+		if p == player {
+			return i
+		}
+	}
+	return -1
+}
+
+// playable reports whether card may be played on the discard pile: an
+// eight, or a card matching the active suit or the rank on top.
+func (s *state) playable(card cards.Card) bool {
+	return card.Rank == wildRank || card.Suit == s.activeSuit || card.Rank == s.top().Rank
+}
+
+// canPlay reports whether seat holds a card they may play.
+func (s *state) canPlay(seat int) bool {
+	for _, card := range s.hands[seat] {
+		if s.playable(card) {
+			return true
+		}
+	}
+	return false
+}
+
+// canDraw reports whether a card is left to draw, in the stock or under
+// the top of the discard pile.
+func (s *state) canDraw() bool {
+	return len(s.stock) > 0 || len(s.discard) > 1
+}
+
+// drawOne takes the top card of the stock, reshuffling the discard pile
+// (except its top card) into it when it runs out.
+func (s *state) drawOne(seat int) (cards.Card, bool) {
+	if len(s.stock) == 0 {
+		if len(s.discard) <= 1 {
+			return cards.Card{}, false
+		}
+		top := s.top()
+		s.stock = append(s.stock, s.discard[:len(s.discard)-1]...)
+		s.discard = []cards.Card{top}
+		cards.Shuffle(s.stock, s.rng)
+	}
+	card := s.stock[len(s.stock)-1]
+	s.stock = s.stock[:len(s.stock)-1]
+	s.hands[seat] = append(s.hands[seat], card)
+	cards.Sort(s.hands[seat])
+	return card, true
+}
+
+type playData struct {
+	Card string `json:"card"`
+	Suit string `json:"suit,omitempty"` // declared suit for an eight
+}
+
+func (Game) LegalMoves(st engine.State, player string) []engine.Move {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat != s.turn || s.winner >= 0 {
+		return nil
+	}
+
+	candidates := s.hands[seat]
+	if s.drawn != nil {
+		candidates = []cards.Card{*s.drawn}
+	}
+	var moves []engine.Move
+	for _, card := range candidates {
+		if !s.playable(card) {
+			continue
+		}
+		if card.Rank == wildRank {
+			for _, suit := range cards.Suits {
+				moves = append(moves, engine.NewMove("play", playData{Card: card.Code(), Suit: suit}))
+			}
+		} else {
+			moves = append(moves, engine.NewMove("play", playData{Card: card.Code()}))
+		}
+	}
+	// Without a drawn card, pass only when there is neither a card to draw
+	// nor one to play
+	switch {
+	case s.drawn == nil && s.canDraw():
+		moves = append(moves, engine.NewMove("draw", nil))
+	case s.drawn != nil || !s.canPlay(seat):
+		moves = append(moves, engine.NewMove("pass", nil))
+	}
+	return moves
+}
+
+func (Game) ApplyMove(st engine.State, player string, move engine.Move) (engine.State, error) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 {
+		return nil, engine.ErrNotPlayer
+	}
+	if s.winner >= 0 {
+		return nil, engine.ErrGameOver
+	}
+	if seat != s.turn {
+		return nil, engine.ErrNotYourTurn
+	}
+
+	switch move.Action {
+	case "draw":
+		if s.drawn != nil {
+			return nil, fmt.Errorf("%w: you already drew this turn", engine.ErrIllegalMove)
+		}
+		if !s.canDraw() {
+			return nil, fmt.Errorf("%w: nothing left to draw, pass", engine.ErrIllegalMove)
+		}
+		s.passes = 0
+		for {
+			card, ok := s.drawOne(seat)
+			if !ok {
+				// Ran out of cards before drawing a playable one
+				s.endTurn()
+				return s, nil
+			}
+			if s.playable(card) {
+				s.drawn = &card
+				return s, nil
+			}
+			if !s.drawUntilPlayable {
+				s.endTurn()
+				return s, nil
+			}
+		}
+
+	case "pass":
+		if s.drawn == nil {
+			if s.canDraw() {
+				return nil, fmt.Errorf("%w: draw a card before passing", engine.ErrIllegalMove)
+			}
+			if s.canPlay(seat) {
+				return nil, fmt.Errorf("%w: nothing left to draw, play a card", engine.ErrIllegalMove)
+			}
+			s.passes++
+			if s.passes == len(s.players) {
+				s.finishHand(-1)
+				return s, nil
+			}
+		}
+		s.endTurn()
+		return s, nil
+
+	case "play":
+		var data playData
+		if err := move.Decode(&data); err != nil {
+			return nil, err
+		}
+		card, ok := cards.Parse(data.Card)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown card %q", engine.ErrIllegalMove, data.Card)
+		}
+		index := cards.Index(s.hands[seat], card)
+		if index < 0 {
+			return nil, fmt.Errorf("%w: you do not hold %s", engine.ErrIllegalMove, card)
+		}
+		if s.drawn != nil && *s.drawn != card {
+			return nil, fmt.Errorf("%w: only the card you drew can be played", engine.ErrIllegalMove)
+		}
+		if !s.playable(card) {
+			return nil, fmt.Errorf("%w: %s matches neither the suit nor the rank on the pile", engine.ErrIllegalMove, card)
+		}
+		if card.Rank == wildRank && !validSuit(data.Suit) {
+			return nil, fmt.Errorf("%w: choose a suit for the eight", engine.ErrIllegalMove)
+		}
+
+		s.passes = 0
+		s.hands[seat] = cards.Remove(s.hands[seat], index)
+		s.discard = append(s.discard, card)
+		s.activeSuit = card.Suit
+		if card.Rank == wildRank {
+			s.activeSuit = data.Suit
+		}
+		if len(s.hands[seat]) == 0 {
+			s.finishHand(seat)
+			return s, nil
+		}
+		s.endTurn()
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown action %q", engine.ErrIllegalMove, move.Action)
+}
+
+func (s *state) endTurn() {
+	s.drawn = nil
+	s.turn = (s.turn + 1) % len(s.players)
+}
+
+// finishHand scores the hand and either ends the game or deals the next
+// hand with the deal passing to the left. The player who went out scores
+// the points left in everyone else's hand. When the hand is blocked
+// (seat -1) the player with the fewest points in hand scores instead.
+func (s *state) finishHand(seat int) {
+	result := &roundResult{Round: s.round, Blocked: seat < 0}
+	if seat < 0 {
+		seat = 0
+		for other, hand := range s.hands {
+			if handPoints(hand) < handPoints(s.hands[seat]) {
+				seat = other
+			}
+		}
+	}
+	for other, hand := range s.hands {
+		if other != seat {
+			result.Points += handPoints(hand)
+		}
+	}
+	result.Winner = s.players[seat]
+	s.scores[seat] += result.Points
+	s.lastRound = result
+
+	if s.scores[seat] >= s.targetScore {
+		s.winner = seat
+		s.drawn = nil
+		return
+	}
+	s.dealer = (s.dealer + 1) % len(s.players)
+	s.deal()
+}
+
+// AutoMove is the move made for a player who ran out of time: they play
+// their first playable card, an eight last, declaring the suit they hold
+// the most of, and otherwise draw or pass.
+func (Game) AutoMove(st engine.State, player string) (engine.Move, bool) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat != s.turn || s.winner >= 0 {
+		return engine.Move{}, false
+	}
+
+	candidates := s.hands[seat]
+	if s.drawn != nil {
+		candidates = []cards.Card{*s.drawn}
+	}
+	var eight *cards.Card
+	for _, card := range candidates {
+		if !s.playable(card) {
+			continue
+		}
+		if card.Rank != wildRank {
+			return engine.NewMove("play", playData{Card: card.Code()}), true
+		}
+		c := card
+		eight = &c
+	}
+	if eight != nil {
+		counts := make(map[string]int)
+		suit := eight.Suit
+		for _, card := range s.hands[seat] {
+			if card.Rank != wildRank {
+				counts[card.Suit]++
+				if counts[card.Suit] > counts[suit] {
+					suit = card.Suit
+				}
+			}
+		}
+		return engine.NewMove("play", playData{Card: eight.Code(), Suit: suit}), true
+	}
+	if s.drawn == nil && s.canDraw() {
+		return engine.NewMove("draw", nil), true
+	}
+	return engine.NewMove("pass", nil), true
+}
+
+func (Game) CurrentPlayer(st engine.State) string {
+	s := st.(*state)
+	if s.winner >= 0 {
+		return ""
+	}
+	return s.players[s.turn]
+}
+
+func (Game) IsTerminal(st engine.State) bool {
+	return st.(*state).winner >= 0
+}
+
+func (Game) Winners(st engine.State) []string {
+	s := st.(*state)
+	if s.winner < 0 {
+		return nil
+	}
+	return []string{s.players[s.winner]}
+}
+
+// Standings ranks the players by their score once the game is over.
+func (Game) Standings(st engine.State) [][]string {
+	s := st.(*state)
+	return engine.RankByScore(s.players, s.scores)
+}
+
+type playerSummary struct {
+	ID    string `json:"id"`
+	Cards int    `json:"cards"`
+	Score int    `json:"score"`
+}
+
+type view struct {
+	Players           []playerSummary `json:"players"`
+	TopCard           cards.Card      `json:"topCard"`
+	ActiveSuit        string          `json:"activeSuit"`
+	CurrentPlayer     string          `json:"currentPlayer,omitempty"`
+	Stock             int             `json:"stock"`
+	DrawUntilPlayable bool            `json:"drawUntilPlayable"`
+	Round             int             `json:"round"`
+	TargetScore       int             `json:"targetScore"`
+	LastRound         *roundResult    `json:"lastRound,omitempty"`
+	Winner            string          `json:"winner,omitempty"`
+
+	// Only in a player's own view
+	Hand  []cards.Card `json:"hand,omitempty"`
+	Drawn *cards.Card  `json:"drawn,omitempty"`
+}
+
+func (s *state) publicView() view {
+	v := view{
+		TopCard:           s.top(),
+		ActiveSuit:        s.activeSuit,
+		Stock:             len(s.stock),
+		DrawUntilPlayable: s.drawUntilPlayable,
+		Round:             s.round,
+		TargetScore:       s.targetScore,
+		LastRound:         s.lastRound,
+	}
+	for i, player := range s.players {
+		v.Players = append(v.Players, playerSummary{
+			ID:    player,
+			Cards: len(s.hands[i]),
+			Score: s.scores[i],
+		})
+	}
+	if s.winner >= 0 {
+		v.Winner = s.players[s.winner]
+	} else {
+		v.CurrentPlayer = s.players[s.turn]
+	}
+	return v
+}
+
+func (Game) PublicView(st engine.State) interface{} {
+	return st.(*state).publicView()
+}
+
+func (Game) PlayerView(st engine.State, player string) interface{} {
+	s := st.(*state)
+	v := s.publicView()
+	if seat := s.seatOf(player); seat >= 0 {
+		v.Hand = append([]cards.Card{}, s.hands[seat]...)
+		if seat == s.turn {
+			v.Drawn = s.drawn
+		}
+	}
+	return v
+}
@@ -0,0 +1,206 @@
+package crazyeights
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"norex/engine"
+	"norex/games/cards"
+)
+
+func newTestState(t *testing.T, players int, seed int64) *state {
+	t.Helper()
+	ids := []string{"a", "b", "c", "d", "e", "f", "g"}[:players]
+	st, err := Game{}.NewState(engine.Setup{Players: ids, Options: engine.Options{}, Rand: rand.New(rand.NewSource(seed))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st.(*state)
+}
+
+func hasAction(moves []engine.Move, action string) bool {
+	for _, move := range moves {
+		if move.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPassWithNothingToDraw(t *testing.T) {
+	tests := []struct {
+		name     string
+		hand     []cards.Card
+		drawn    bool
+		wantPass bool
+	}{
+		{"playable card in hand", []cards.Card{{Suit: cards.Hearts, Rank: "4"}, {Suit: cards.Clubs, Rank: "K"}}, false, false},
+		{"eight in hand", []cards.Card{{Suit: cards.Clubs, Rank: "8"}, {Suit: cards.Clubs, Rank: "K"}}, false, false},
+		{"nothing playable", []cards.Card{{Suit: cards.Clubs, Rank: "K"}, {Suit: cards.Spades, Rank: "2"}}, false, true},
+		{"after drawing", []cards.Card{{Suit: cards.Hearts, Rank: "4"}}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, 2, 1)
+			seat := s.turn
+			s.stock = nil
+			s.discard = []cards.Card{{Suit: cards.Hearts, Rank: "9"}}
+			s.activeSuit = cards.Hearts
+			s.hands[seat] = tt.hand
+			if tt.drawn {
+				s.drawn = &tt.hand[0]
+			}
+
+			player := s.players[seat]
+			if got := hasAction(Game{}.LegalMoves(s, player), "pass"); got != tt.wantPass {
+				t.Fatalf("pass offered = %v, want %v", got, tt.wantPass)
+			}
+			_, err := Game{}.ApplyMove(s, player, engine.NewMove("pass", nil))
+			if tt.wantPass && err != nil {
+				t.Fatalf("pass: %v", err)
+			}
+			if !tt.wantPass && !errors.Is(err, engine.ErrIllegalMove) {
+				t.Fatalf("pass: %v, want an illegal move", err)
+			}
+		})
+	}
+}
+
+func TestBlockedHand(t *testing.T) {
+	s := newTestState(t, 2, 3)
+	s.stock = nil
+	s.discard = []cards.Card{{Suit: cards.Hearts, Rank: "9"}}
+	s.activeSuit = cards.Hearts
+	s.hands = [][]cards.Card{
+		{{Suit: cards.Clubs, Rank: "K"}},                                  // 10 points
+		{{Suit: cards.Spades, Rank: "2"}, {Suit: cards.Clubs, Rank: "3"}}, // 5 points
+	}
+	first := s.turn
+	for range s.players {
+		if _, err := (Game{}).ApplyMove(s, s.players[s.turn], engine.NewMove("pass", nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.lastRound == nil || !s.lastRound.Blocked {
+		t.Fatalf("lastRound = %+v, want a blocked hand", s.lastRound)
+	}
+	if s.lastRound.Winner != s.players[1] || s.lastRound.Points != 10 {
+		t.Fatalf("lastRound = %+v, want %s to score 10", s.lastRound, s.players[1])
+	}
+	if s.turn == first {
+		t.Fatal("the deal did not pass to the left")
+	}
+}
+
+func TestGoingOut(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     int
+		others     [][]string
+		wantPoints int
+		wantOver   bool
+	}{
+		{"every rank", 100, [][]string{{"8S", "KD", "QC"}, {"JH", "AC", "7D"}}, 88, false},
+		{"target reached", 50, [][]string{{"8S"}, {"2C"}}, 52, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, 3, 1)
+			s.targetScore = tt.target
+			seat := s.turn
+			s.discard = cards.MustParse("9H")
+			s.activeSuit = cards.Hearts
+			s.hands[seat] = cards.MustParse("4H")
+			for i, hand := range tt.others {
+				s.hands[(seat+1+i)%3] = cards.MustParse(hand...)
+			}
+			if _, err := (Game{}).ApplyMove(s, s.players[seat], engine.NewMove("play", playData{Card: "4H"})); err != nil {
+				t.Fatal(err)
+			}
+			if s.lastRound.Winner != s.players[seat] || s.lastRound.Points != tt.wantPoints || s.scores[seat] != tt.wantPoints {
+				t.Fatalf("last round %+v, want %s to score %d", s.lastRound, s.players[seat], tt.wantPoints)
+			}
+			if (Game{}).IsTerminal(s) != tt.wantOver {
+				t.Fatalf("terminal = %v, want %v", !tt.wantOver, tt.wantOver)
+			}
+			if !tt.wantOver && s.round != 2 {
+				t.Fatalf("round %d, want the next hand dealt", s.round)
+			}
+		})
+	}
+}
+
+func TestPlay(t *testing.T) {
+	tests := []struct {
+		name string
+		play playData
+		want bool
+	}{
+		{"same suit", playData{Card: "2H"}, true},
+		{"same rank", playData{Card: "9C"}, true},
+		{"neither", playData{Card: "3D"}, false},
+		{"eight naming a suit", playData{Card: "8S", Suit: cards.Clubs}, true},
+		{"eight without a suit", playData{Card: "8S"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, 2, 1)
+			seat := s.turn
+			s.discard = cards.MustParse("9H")
+			s.activeSuit = cards.Hearts
+			s.hands[seat] = cards.MustParse("2H", "9C", "3D", "8S", "KC")
+			_, err := Game{}.ApplyMove(s, s.players[seat], engine.NewMove("play", tt.play))
+			if tt.want && err != nil {
+				t.Fatalf("play: %v", err)
+			}
+			if !tt.want && !errors.Is(err, engine.ErrIllegalMove) {
+				t.Fatalf("play: %v, want an illegal move", err)
+			}
+			if tt.play.Suit != "" && s.activeSuit != tt.play.Suit {
+				t.Fatalf("active suit %s, want %s", s.activeSuit, tt.play.Suit)
+			}
+		})
+	}
+}
+
+func TestDraw(t *testing.T) {
+	tests := []struct {
+		name      string
+		untilPlay bool
+		stock     []string // the last card is drawn first
+		wantDrawn string   // "" when the turn passed
+		wantCards int
+	}{
+		{"until playable", true, []string{"5H", "3C", "2D"}, "5H", 4},
+		{"single card", false, []string{"5H", "3C", "2D"}, "", 2},
+		{"single playable card", false, []string{"5H"}, "5H", 2},
+		{"stock runs out", true, []string{"3C", "2D"}, "", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, 2, 1)
+			s.drawUntilPlayable = tt.untilPlay
+			seat := s.turn
+			s.discard = cards.MustParse("9H")
+			s.activeSuit = cards.Hearts
+			s.hands[seat] = cards.MustParse("KC")
+			s.stock = cards.MustParse(tt.stock...)
+			if _, err := (Game{}).ApplyMove(s, s.players[seat], engine.NewMove("draw", nil)); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(s.hands[seat]); got != tt.wantCards {
+				t.Fatalf("%d cards in hand, want %d", got, tt.wantCards)
+			}
+			if tt.wantDrawn == "" {
+				if s.drawn != nil || s.turn == seat {
+					t.Fatalf("drawn %v on turn %d, want the turn to pass", s.drawn, s.turn)
+				}
+				return
+			}
+			if s.drawn == nil || s.drawn.Code() != tt.wantDrawn || s.turn != seat {
+				t.Fatalf("drawn %v, want %s to play", s.drawn, tt.wantDrawn)
+			}
+		})
+	}
+}
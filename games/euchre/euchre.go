@@ -0,0 +1,686 @@
+// Package euchre implements four-player partnership Euchre for the game
+// engine.
+package euchre
+
+import (
+	"fmt"
+	"math/rand"
+
+	"norex/catalog"
+	"norex/engine"
+	"norex/games/cards"
+)
+
+const (
+	players     = 4
+	handSize    = 5
+	targetScore = 10
+)
+
+// ranks are the 24 cards of the Euchre deck, nine to ace in every suit.
+var ranks = []string{"9", "10", "J", "Q", "K", "A"}
+
+// Phases of a hand.
+const (
+	phaseOrdering   = "ordering"   // first round: order up the turned card
+	phaseNaming     = "naming"     // second round: name another suit
+	phaseDiscarding = "discarding" // the dealer discards for the card picked up
+	phasePlaying    = "playing"
+	phaseOver       = "over"
+)
+
+// sameColor returns the other suit of the same color, the suit of the
+// left bower.
+func sameColor(suit string) string {
+	switch suit {
+	case cards.Clubs:
+		return cards.Spades
+	case cards.Spades:
+		return cards.Clubs
+	case cards.Diamonds:
+		return cards.Hearts
+	}
+	return cards.Diamonds
+}
+
+func validSuit(suit string) bool {
+	for _, s := range cards.Suits {
+		if s == suit {
+			return true
+		}
+	}
+	return false
+}
+
+type play struct {
+	seat int
+	card cards.Card
+}
+
+// state is the authoritative state of a Euchre game. Partners sit
+// opposite each other: seats 0 and 2 are team 0, seats 1 and 3 team 1.
+type state struct {
+	rng *rand.Rand
+
+	players []string
+	hands   [][]cards.Card
+	dealer  int
+	turn    int
+	phase   string
+
+	upcard     cards.Card
+	turnedDown bool // nobody ordered the upcard up, it may not be named
+	trump      string
+	maker      int  // seat that made trump, -1 while bidding
+	alone      bool // the maker plays without their partner
+	sittingOut int  // partner of a lone maker, -1 otherwise
+
+	trick     []play
+	lastTrick *completedTrick
+	taken     []int // tricks taken this hand
+
+	stickTheDealer bool
+	scores         [2]int
+	round          int
+	lastRound      *roundResult
+	winner         int // winning team, -1 until the game is over
+}
+
+func team(seat int) int {
+	return seat % 2
+}
+
+func partner(seat int) int {
+	return (seat + 2) % players
+}
+
+// Game is the Euchre rule set.
+type Game struct{}
+
+func init() {
+	catalog.Register(catalog.Game{
+		Key:         "euchre",
+		DisplayName: "Euchre",
+		Icon:        "euchre.png",
+		MinPlayers:  players,
+		MaxPlayers:  players,
+		TextChat:    true,
+		Options: []catalog.Option{
+			{Key: "stickTheDealer", Kind: catalog.OptionBool, Default: false},
+		},
+		New: func() engine.Game { return Game{} },
+	})
+}
+
+// NewState seats the players in the order of the room, the owner first,
+// so the owner partners the third player, and deals the first hand. With
+// the "stickTheDealer" option the dealer must name trump when everyone
+// else passed twice, instead of the hand being dealt again.
+func (Game) NewState(setup engine.Setup) (engine.State, error) {
+	if len(setup.Players) != players {
+		return nil, engine.ErrPlayerCount
+	}
+
+	s := &state{
+		rng:            setup.Rand,
+		players:        append([]string(nil), setup.Players...),
+		dealer:         players - 1,
+		stickTheDealer: setup.Options.Bool("stickTheDealer", false),
+		winner:         -1,
+	}
+	s.deal()
+	return s, nil
+}
+
+// deal shuffles and deals five cards to everyone and turns up the next
+// card of the kitty. Bidding starts left of the dealer.
+func (s *state) deal() {
+	s.round++
+	deck := cards.NewDeck(ranks...)
+	cards.Shuffle(deck, s.rng)
+	var kitty []cards.Card
+	s.hands, kitty = cards.Deal(deck, players, handSize)
+	for _, hand := range s.hands {
+		cards.Sort(hand)
+	}
+
+	s.upcard = kitty[len(kitty)-1]
+	s.turnedDown = false
+	s.trump = ""
+	s.maker = -1
+	s.alone = false
+	s.sittingOut = -1
+	s.trick = nil
+	s.lastTrick = nil
+	s.taken = make([]int, players)
+	s.phase = phaseOrdering
+	s.turn = s.next(s.dealer)
+}
+
+// next returns the seat after seat, skipping the partner of a lone maker.
+func (s *state) next(seat int) int {
+	seat = (seat + 1) % players
+	if seat == s.sittingOut {
+		seat = (seat + 1) % players
+	}
+	return seat
+}
+
+func (s *state) seatOf(player string) int {
+	for i, p := range s.players {
+		if p == player {
+			return i
+		}
+	}
+	return -1
+}
+
+// suitOf returns the suit a card follows: the left bower belongs to trump.
+func (s *state) suitOf(card cards.Card) string {
+	if card.Rank == "J" && s.trump != "" && card.Suit == sameColor(s.trump) {
+		return s.trump
+	}
+	return card.Suit
+}
+
+// strength orders the cards of a trick: the right bower, the left bower
+// and the other trumps above the cards of the suit led, everything else 0.
+func (s *state) strength(card cards.Card, led string) int {
+	suit := s.suitOf(card)
+	switch {
+	case suit == s.trump && card.Rank == "J" && card.Suit == s.trump:
+		return 200
+	case suit == s.trump && card.Rank == "J":
+		return 199
+	case suit == s.trump:
+		return 100 + card.Value()
+	case suit == led:
+		return card.Value()
+	}
+	return 0
+}
+
+// legalCards lists the cards seat may play to the current trick.
+func (s *state) legalCards(seat int) []cards.Card {
+	hand := s.hands[seat]
+	if len(s.trick) == 0 {
+		return append([]cards.Card(nil), hand...)
+	}
+	led := s.suitOf(s.trick[0].card)
+	var legal []cards.Card
+	for _, card := range hand {
+		if s.suitOf(card) == led {
+			legal = append(legal, card)
+		}
+	}
+	if len(legal) == 0 {
+		return append(legal, hand...)
+	}
+	return legal
+}
+
+type orderData struct {
+	Alone bool `json:"alone,omitempty"`
+}
+
+type nameData struct {
+	Suit  string `json:"suit"`
+	Alone bool   `json:"alone,omitempty"`
+}
+
+type cardData struct {
+	Card string `json:"card"`
+}
+
+// mustName reports whether seat has to name trump: the dealer under the
+// stick-the-dealer rule, once everyone else passed twice.
+func (s *state) mustName(seat int) bool {
+	return s.phase == phaseNaming && s.stickTheDealer && seat == s.dealer
+}
+
+func (Game) LegalMoves(st engine.State, player string) []engine.Move {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 || seat != s.turn || s.phase == phaseOver {
+		return nil
+	}
+
+	var moves []engine.Move
+	switch s.phase {
+	case phaseOrdering:
+		moves = append(moves,
+			engine.NewMove("pass", nil),
+			engine.NewMove("order_up", orderData{}),
+			engine.NewMove("order_up", orderData{Alone: true}))
+	case phaseNaming:
+		if !s.mustName(seat) {
+			moves = append(moves, engine.NewMove("pass", nil))
+		}
+		for _, suit := range cards.Suits {
+			if suit != s.upcard.Suit {
+				moves = append(moves,
+					engine.NewMove("name_trump", nameData{Suit: suit}),
+					engine.NewMove("name_trump", nameData{Suit: suit, Alone: true}))
+			}
+		}
+	case phaseDiscarding:
+		for _, card := range s.hands[seat] {
+			moves = append(moves, engine.NewMove("discard", cardData{Card: card.Code()}))
+		}
+	case phasePlaying:
+		for _, card := range s.legalCards(seat) {
+			moves = append(moves, engine.NewMove("play", cardData{Card: card.Code()}))
+		}
+	}
+	return moves
+}
+
+func (Game) ApplyMove(st engine.State, player string, move engine.Move) (engine.State, error) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 {
+		return nil, engine.ErrNotPlayer
+	}
+	if s.phase == phaseOver {
+		return nil, engine.ErrGameOver
+	}
+	if seat != s.turn {
+		return nil, engine.ErrNotYourTurn
+	}
+
+	switch move.Action {
+	case "pass":
+		switch {
+		case s.phase != phaseOrdering && s.phase != phaseNaming:
+			return nil, fmt.Errorf("%w: trump is already made", engine.ErrIllegalMove)
+		case s.mustName(seat):
+			return nil, fmt.Errorf("%w: stick the dealer, you must name trump", engine.ErrIllegalMove)
+		}
+		s.pass(seat)
+		return s, nil
+
+	case "order_up":
+		if s.phase != phaseOrdering {
+			return nil, fmt.Errorf("%w: the turned card can no longer be ordered up", engine.ErrIllegalMove)
+		}
+		var data orderData
+		if len(move.Data) > 0 {
+			if err := move.Decode(&data); err != nil {
+				return nil, err
+			}
+		}
+		s.makeTrump(seat, s.upcard.Suit, data.Alone)
+		// The dealer picks the card up, unless they sit this hand out
+		if s.dealer != s.sittingOut {
+			s.hands[s.dealer] = append(s.hands[s.dealer], s.upcard)
+			cards.Sort(s.hands[s.dealer])
+			s.phase = phaseDiscarding
+			s.turn = s.dealer
+		}
+		return s, nil
+
+	case "name_trump":
+		if s.phase != phaseNaming {
+			return nil, fmt.Errorf("%w: trump can not be named now", engine.ErrIllegalMove)
+		}
+		var data nameData
+		if err := move.Decode(&data); err != nil {
+			return nil, err
+		}
+		if !validSuit(data.Suit) {
+			return nil, fmt.Errorf("%w: unknown suit %q", engine.ErrIllegalMove, data.Suit)
+		}
+		if data.Suit == s.upcard.Suit {
+			return nil, fmt.Errorf("%w: %s was turned down", engine.ErrIllegalMove, data.Suit)
+		}
+		s.makeTrump(seat, data.Suit, data.Alone)
+		return s, nil
+
+	case "discard":
+		if s.phase != phaseDiscarding {
+			return nil, fmt.Errorf("%w: there is nothing to discard", engine.ErrIllegalMove)
+		}
+		var data cardData
+		if err := move.Decode(&data); err != nil {
+			return nil, err
+		}
+		card, ok := cards.Parse(data.Card)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown card %q", engine.ErrIllegalMove, data.Card)
+		}
+		index := cards.Index(s.hands[seat], card)
+		if index < 0 {
+			return nil, fmt.Errorf("%w: you do not hold %s", engine.ErrIllegalMove, card)
+		}
+		s.hands[seat] = cards.Remove(s.hands[seat], index)
+		s.startPlaying()
+		return s, nil
+
+	case "play":
+		if s.phase != phasePlaying {
+			return nil, fmt.Errorf("%w: trump is not made yet", engine.ErrIllegalMove)
+		}
+		var data cardData
+		if err := move.Decode(&data); err != nil {
+			return nil, err
+		}
+		card, ok := cards.Parse(data.Card)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown card %q", engine.ErrIllegalMove, data.Card)
+		}
+		index := cards.Index(s.hands[seat], card)
+		if index < 0 {
+			return nil, fmt.Errorf("%w: you do not hold %s", engine.ErrIllegalMove, card)
+		}
+		if cards.Index(s.legalCards(seat), card) < 0 {
+			return nil, fmt.Errorf("%w: you must follow %s", engine.ErrIllegalMove, s.suitOf(s.trick[0].card))
+		}
+		s.play(seat, index)
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown action %q", engine.ErrIllegalMove, move.Action)
+}
+
+// pass moves the bidding on. After the dealer passes the turned card is
+// turned down and everyone may name another suit; after the dealer passes
+// again the next player deals a new hand.
+func (s *state) pass(seat int) {
+	if seat != s.dealer {
+		s.turn = s.next(seat)
+		return
+	}
+	if s.phase == phaseOrdering {
+		s.phase = phaseNaming
+		s.turnedDown = true
+		s.turn = s.next(seat)
+		return
+	}
+	s.dealer = s.next(s.dealer)
+	s.deal()
+}
+
+func (s *state) makeTrump(seat int, suit string, alone bool) {
+	s.trump = suit
+	s.maker = seat
+	s.alone = alone
+	if alone {
+		s.sittingOut = partner(seat)
+	}
+	s.startPlaying()
+}
+
+// startPlaying gives the lead of the first trick to the player left of the
+// dealer.
+func (s *state) startPlaying() {
+	s.phase = phasePlaying
+	s.turn = s.next(s.dealer)
+}
+
+// play puts the card at index of seat's hand on the trick and collects
+// the trick once every player in the hand has played to it.
+func (s *state) play(seat, index int) {
+	card := s.hands[seat][index]
+	s.hands[seat] = cards.Remove(s.hands[seat], index)
+	s.trick = append(s.trick, play{seat: seat, card: card})
+	active := players
+	if s.alone {
+		active--
+	}
+	if len(s.trick) < active {
+		s.turn = s.next(seat)
+		return
+	}
+
+	led := s.suitOf(s.trick[0].card)
+	best := s.trick[0]
+	for _, p := range s.trick[1:] {
+		if s.strength(p.card, led) > s.strength(best.card, led) {
+			best = p
+		}
+	}
+	s.taken[best.seat]++
+	s.lastTrick = &completedTrick{Winner: s.players[best.seat]}
+	for _, p := range s.trick {
+		s.lastTrick.Cards = append(s.lastTrick.Cards, trickCard{Player: s.players[p.seat], Card: p.card})
+	}
+	s.trick = nil
+	s.turn = best.seat
+	if len(s.hands[best.seat]) == 0 {
+		s.finishHand()
+	}
+}
+
+// finishHand scores the hand and either ends the game or deals the next
+// hand. The makers score 1 point for three or four tricks and 2 for all
+// five, 4 when the maker went alone; makers taking fewer than three tricks
+// are euchred and the defenders score 2.
+func (s *state) finishHand() {
+	makers := team(s.maker)
+	tricks := s.taken[makers] + s.taken[makers+2]
+	result := &roundResult{
+		Round:  s.round,
+		Maker:  s.players[s.maker],
+		Trump:  s.trump,
+		Alone:  s.alone,
+		Tricks: tricks,
+	}
+	switch {
+	case tricks == handSize && s.alone:
+		result.Team, result.Points = makers, 4
+	case tricks == handSize:
+		result.Team, result.Points = makers, 2
+	case tricks >= 3:
+		result.Team, result.Points = makers, 1
+	default:
+		result.Team, result.Points = 1-makers, 2
+		result.Euchred = true
+	}
+	s.scores[result.Team] += result.Points
+	s.lastRound = result
+
+	if s.scores[result.Team] >= targetScore {
+		s.winner = result.Team
+		s.phase = phaseOver
+		return
+	}
+	s.dealer = (s.dealer + 1) % players
+	s.deal()
+}
+
+// AutoMove is the move made for a player who ran out of time: they pass,
+// name their longest suit when stuck as dealer, discard and play their
+// weakest card.
+func (Game) AutoMove(st engine.State, player string) (engine.Move, bool) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat != s.turn || s.phase == phaseOver {
+		return engine.Move{}, false
+	}
+
+	switch s.phase {
+	case phaseNaming:
+		if s.mustName(seat) {
+			best, count := "", -1
+			for _, suit := range cards.Suits {
+				n := 0
+				for _, card := range s.hands[seat] {
+					if card.Suit == suit {
+						n++
+					}
+				}
+				if suit != s.upcard.Suit && n > count {
+					best, count = suit, n
+				}
+			}
+			return engine.NewMove("name_trump", nameData{Suit: best}), true
+		}
+		return engine.NewMove("pass", nil), true
+	case phaseOrdering:
+		return engine.NewMove("pass", nil), true
+	case phaseDiscarding:
+		return engine.NewMove("discard", cardData{Card: s.weakest(s.hands[seat]).Code()}), true
+	}
+	return engine.NewMove("play", cardData{Card: s.weakest(s.legalCards(seat)).Code()}), true
+}
+
+// weakest returns the card of hand that is worth the least with the
+// current trump.
+func (s *state) weakest(hand []cards.Card) cards.Card {
+	weakest := hand[0]
+	for _, card := range hand[1:] {
+		if s.strength(card, card.Suit) < s.strength(weakest, weakest.Suit) {
+			weakest = card
+		}
+	}
+	return weakest
+}
+
+// Forfeit ends the game when a player runs out of time: the other team wins.
+func (Game) Forfeit(st engine.State, player string) (engine.State, error) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 {
+		return nil, engine.ErrNotPlayer
+	}
+	s.winner = 1 - team(seat)
+	s.phase = phaseOver
+	return s, nil
+}
+
+func (Game) CurrentPlayer(st engine.State) string {
+	s := st.(*state)
+	if s.phase == phaseOver {
+		return ""
+	}
+	return s.players[s.turn]
+}
+
+func (Game) IsTerminal(st engine.State) bool {
+	return st.(*state).phase == phaseOver
+}
+
+// Winners returns both players of the winning team.
+func (Game) Winners(st engine.State) []string {
+	s := st.(*state)
+	if s.winner < 0 {
+		return nil
+	}
+	return []string{s.players[s.winner], s.players[s.winner+2]}
+}
+
+type trickCard struct {
+	Player string     `json:"player"`
+	Card   cards.Card `json:"card"`
+}
+
+type completedTrick struct {
+	Cards  []trickCard `json:"cards"`
+	Winner string      `json:"winner"`
+}
+
+type roundResult struct {
+	Round   int    `json:"round"`
+	Maker   string `json:"maker"`
+	Trump   string `json:"trump"`
+	Alone   bool   `json:"alone,omitempty"`
+	Tricks  int    `json:"tricks"` // taken by the makers
+	Euchred bool   `json:"euchred,omitempty"`
+	Team    int    `json:"team"` // team scoring the points
+	Points  int    `json:"points"`
+}
+
+type playerSummary struct {
+	ID         string `json:"id"`
+	Team       int    `json:"team"`
+	Cards      int    `json:"cards"`
+	Tricks     int    `json:"tricks"`
+	SittingOut bool   `json:"sittingOut,omitempty"`
+}
+
+type teamSummary struct {
+	Players []string `json:"players"`
+	Score   int      `json:"score"`
+}
+
+type view struct {
+	Players       []playerSummary `json:"players"`
+	Teams         []teamSummary   `json:"teams"`
+	Phase         string          `json:"phase"`
+	Dealer        string          `json:"dealer"`
+	CurrentPlayer string          `json:"currentPlayer,omitempty"`
+	Upcard        *cards.Card     `json:"upcard,omitempty"` // while it may be ordered up
+	TurnedDown    string          `json:"turnedDown,omitempty"`
+	Trump         string          `json:"trump,omitempty"`
+	Maker         string          `json:"maker,omitempty"`
+	Alone         bool            `json:"alone,omitempty"`
+	Trick         []trickCard     `json:"trick"`
+	LastTrick     *completedTrick `json:"lastTrick,omitempty"`
+	Round         int             `json:"round"`
+	TargetScore   int             `json:"targetScore"`
+	LastRound     *roundResult    `json:"lastRound,omitempty"`
+	Winners       []string        `json:"winners,omitempty"`
+
+	// Only in a player's own view
+	Hand []cards.Card `json:"hand,omitempty"`
+}
+
+func (s *state) publicView() view {
+	v := view{
+		Phase:       s.phase,
+		Dealer:      s.players[s.dealer],
+		Trump:       s.trump,
+		Alone:       s.alone,
+		Trick:       []trickCard{},
+		LastTrick:   s.lastTrick,
+		Round:       s.round,
+		TargetScore: targetScore,
+		LastRound:   s.lastRound,
+		Winners:     Game{}.Winners(s),
+	}
+	switch {
+	case s.phase == phaseOrdering:
+		upcard := s.upcard
+		v.Upcard = &upcard
+	case s.turnedDown && s.trump == "":
+		v.TurnedDown = s.upcard.Suit
+	}
+	if s.maker >= 0 {
+		v.Maker = s.players[s.maker]
+	}
+	for i, player := range s.players {
+		v.Players = append(v.Players, playerSummary{
+			ID:         player,
+			Team:       team(i),
+			Cards:      len(s.hands[i]),
+			Tricks:     s.taken[i],
+			SittingOut: i == s.sittingOut,
+		})
+	}
+	for t := 0; t < 2; t++ {
+		v.Teams = append(v.Teams, teamSummary{
+			Players: []string{s.players[t], s.players[t+2]},
+			Score:   s.scores[t],
+		})
+	}
+	for _, p := range s.trick {
+		v.Trick = append(v.Trick, trickCard{Player: s.players[p.seat], Card: p.card})
+	}
+	if s.phase != phaseOver {
+		v.CurrentPlayer = s.players[s.turn]
+	}
+	return v
+}
+
+func (Game) PublicView(st engine.State) interface{} {
+	return st.(*state).publicView()
+}
+
+func (Game) PlayerView(st engine.State, player string) interface{} {
+	s := st.(*state)
+	v := s.publicView()
+	if seat := s.seatOf(player); seat >= 0 {
+		v.Hand = append([]cards.Card{}, s.hands[seat]...)
+	}
+	return v
+}
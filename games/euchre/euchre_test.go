@@ -0,0 +1,199 @@
+package euchre
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"norex/engine"
+	"norex/games/cards"
+)
+
+func newTestState(t *testing.T, options engine.Options) *state {
+	t.Helper()
+	st, err := Game{}.NewState(engine.Setup{Players: []string{"a", "b", "c", "d"}, Options: options, Rand: rand.New(rand.NewSource(1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st.(*state)
+}
+
+func apply(t *testing.T, s *state, action string, data interface{}) {
+	t.Helper()
+	if _, err := (Game{}).ApplyMove(s, s.players[s.turn], engine.NewMove(action, data)); err != nil {
+		t.Fatalf("%s: %v", action, err)
+	}
+}
+
+func TestTrickWinner(t *testing.T) {
+	tests := []struct {
+		name  string
+		trick []string
+		want  int
+	}{
+		{"highest of the suit led", []string{"9S", "AS", "KD", "10S"}, 1},
+		{"trump wins", []string{"AS", "KS", "9H", "QS"}, 2},
+		{"right bower", []string{"AH", "JH", "KH", "JD"}, 1},
+		{"left bower beats the ace", []string{"AH", "KH", "JD", "QH"}, 2},
+		{"left bower led calls for trump", []string{"JD", "AD", "9H", "JH"}, 3},
+		{"jack of another color is plain", []string{"AS", "JS", "JC", "9S"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, engine.Options{})
+			s.trump = cards.Hearts
+			trick := cards.MustParse(tt.trick...)
+			led := s.suitOf(trick[0])
+			best := 0
+			for seat, card := range trick {
+				if s.strength(card, led) > s.strength(trick[best], led) {
+					best = seat
+				}
+			}
+			if best != tt.want {
+				t.Fatalf("winner = %d, want %d", best, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegalCards(t *testing.T) {
+	tests := []struct {
+		name string
+		hand []string
+		led  string
+		want []string
+	}{
+		{"left bower follows trump", []string{"JD", "9D", "AC"}, "AH", []string{"JD"}},
+		{"left bower does not follow its suit", []string{"JD", "9D", "AC"}, "KD", []string{"9D"}},
+		{"void", []string{"JD", "AC"}, "KS", []string{"JD", "AC"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, engine.Options{})
+			s.trump = cards.Hearts
+			s.hands[1] = cards.MustParse(tt.hand...)
+			s.trick = []play{{seat: 0, card: cards.MustParse(tt.led)[0]}}
+			if got := s.legalCards(1); fmt.Sprint(got) != fmt.Sprint(cards.MustParse(tt.want...)) {
+				t.Fatalf("legal cards %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoring(t *testing.T) {
+	tests := []struct {
+		name        string
+		alone       bool
+		taken       []int // by seat; the maker is seat 0
+		wantTeam    int
+		wantPoints  int
+		wantEuchred bool
+	}{
+		{"three tricks", false, []int{2, 1, 1, 1}, 0, 1, false},
+		{"four tricks", false, []int{3, 1, 1, 0}, 0, 1, false},
+		{"march", false, []int{3, 0, 2, 0}, 0, 2, false},
+		{"march alone", true, []int{5, 0, 0, 0}, 0, 4, false},
+		{"three tricks alone", true, []int{3, 1, 0, 1}, 0, 1, false},
+		{"euchred", false, []int{1, 2, 1, 1}, 1, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, engine.Options{})
+			s.maker, s.alone, s.trump = 0, tt.alone, cards.Spades
+			s.taken = tt.taken
+			s.finishHand()
+
+			r := s.lastRound
+			if r.Team != tt.wantTeam || r.Points != tt.wantPoints || r.Euchred != tt.wantEuchred {
+				t.Fatalf("round %+v, want team %d to score %d", r, tt.wantTeam, tt.wantPoints)
+			}
+			if s.scores[tt.wantTeam] != tt.wantPoints {
+				t.Fatalf("scores %v", s.scores)
+			}
+		})
+	}
+}
+
+func TestGameEnd(t *testing.T) {
+	s := newTestState(t, engine.Options{})
+	s.scores = [2]int{8, 9}
+	s.maker, s.trump = 1, cards.Clubs
+	s.taken = []int{0, 3, 0, 2}
+	s.finishHand()
+	if !(Game{}).IsTerminal(s) || fmt.Sprint(Game{}.Winners(s)) != "[b d]" {
+		t.Fatalf("winners = %v with scores %v, want [b d]", Game{}.Winners(s), s.scores)
+	}
+}
+
+func TestBidding(t *testing.T) {
+	t.Run("order up", func(t *testing.T) {
+		s := newTestState(t, engine.Options{})
+		upcard := s.upcard
+		apply(t, s, "order_up", orderData{})
+		if s.trump != upcard.Suit || s.phase != phaseDiscarding || s.turn != s.dealer || len(s.hands[s.dealer]) != 6 {
+			t.Fatalf("trump %s, phase %s, turn %d; want the dealer to discard", s.trump, s.phase, s.turn)
+		}
+		apply(t, s, "discard", cardData{Card: s.hands[s.dealer][0].Code()})
+		if s.phase != phasePlaying || s.turn != s.next(s.dealer) {
+			t.Fatalf("phase %s, turn %d; want the player left of the dealer to lead", s.phase, s.turn)
+		}
+	})
+
+	t.Run("everyone passes twice", func(t *testing.T) {
+		s := newTestState(t, engine.Options{})
+		dealer, round := s.dealer, s.round
+		for i := 0; i < players; i++ {
+			apply(t, s, "pass", nil)
+		}
+		if s.phase != phaseNaming || !s.turnedDown {
+			t.Fatalf("phase %s, want naming after four passes", s.phase)
+		}
+		_, err := Game{}.ApplyMove(s, s.players[s.turn], engine.NewMove("name_trump", nameData{Suit: s.upcard.Suit}))
+		if !errors.Is(err, engine.ErrIllegalMove) {
+			t.Fatalf("naming the turned down suit: %v", err)
+		}
+		for i := 0; i < players; i++ {
+			apply(t, s, "pass", nil)
+		}
+		if s.dealer != (dealer+1)%players || s.round != round+1 || s.phase != phaseOrdering {
+			t.Fatalf("dealer %d, round %d; want a new deal by the next player", s.dealer, s.round)
+		}
+	})
+
+	t.Run("stick the dealer", func(t *testing.T) {
+		s := newTestState(t, engine.Options{"stickTheDealer": true})
+		for i := 0; i < 2*players-1; i++ {
+			apply(t, s, "pass", nil)
+		}
+		if s.turn != s.dealer {
+			t.Fatalf("turn %d, want the dealer", s.turn)
+		}
+		if _, err := (Game{}).ApplyMove(s, s.players[s.dealer], engine.NewMove("pass", nil)); !errors.Is(err, engine.ErrIllegalMove) {
+			t.Fatalf("dealer pass: %v, want an illegal move", err)
+		}
+		move, ok := Game{}.AutoMove(s, s.players[s.dealer])
+		if !ok || move.Action != "name_trump" {
+			t.Fatalf("AutoMove = %+v, want the dealer to name trump", move)
+		}
+	})
+
+	t.Run("going alone", func(t *testing.T) {
+		s := newTestState(t, engine.Options{})
+		// The dealer's partner orders up alone and the dealer sits out
+		maker := partner(s.dealer)
+		for s.turn != maker {
+			apply(t, s, "pass", nil)
+		}
+		apply(t, s, "order_up", orderData{Alone: true})
+		if s.sittingOut != s.dealer || s.phase != phasePlaying {
+			t.Fatalf("sitting out %d, phase %s; want the dealer out and no discard", s.sittingOut, s.phase)
+		}
+		for seat := 0; seat < players; seat++ {
+			if s.next(seat) == s.dealer {
+				t.Fatalf("seat %d is followed by the player sitting out", seat)
+			}
+		}
+	})
+}
@@ -0,0 +1,396 @@
+// Package gofish implements Go Fish for two to six players for the game
+// engine.
+package gofish
+
+import (
+	"fmt"
+	"math/rand"
+
+	"norex/catalog"
+	"norex/engine"
+	"norex/games/cards"
+)
+
+const (
+	minPlayers = 2
+	maxPlayers = 6
+	// Two or three players get seven cards, more players five
+	smallHandSize = 7
+	largeHandSize = 5
+	bookSize      = 4
+)
+
+// state is the authoritative state of a Go Fish game.
+type state struct {
+	rng *rand.Rand
+
+	players []string
+	hands   [][]cards.Card
+	pond    []cards.Card
+	books   [][]string // ranks of the books laid down per seat
+	turn    int
+	lastAsk *askResult
+	over    bool
+}
+
+// askResult is what happened on the last ask, shown to everyone.
+type askResult struct {
+	Player  string `json:"player"`
+	Target  string `json:"target,omitempty"` // empty when they drew without asking
+	Rank    string `json:"rank,omitempty"`
+	Given   int    `json:"given"`             // cards handed over
+	Fished  bool   `json:"fished"`            // had to draw from the pond
+	Lucky   bool   `json:"lucky"`             // drew the rank they asked for
+	NewBook string `json:"newBook,omitempty"` // rank of a book laid down
+}
+
+// Game is the Go Fish rule set.
+type Game struct{}
+
+func init() {
+	catalog.Register(catalog.Game{
+		Key:         "go_fish",
+		DisplayName: "Go Fish",
+		Icon:        "go_fish.png",
+		MinPlayers:  minPlayers,
+		MaxPlayers:  maxPlayers,
+		VoiceChat:   true,
+		TextChat:    true,
+		New:         func() engine.Game { return Game{} },
+	})
+}
+
+// NewState deals the hands; the rest of the deck is the pond. The owner
+// asks first.
+func (Game) NewState(setup engine.Setup) (engine.State, error) {
+	if len(setup.Players) < minPlayers || len(setup.Players) > maxPlayers {
+		return nil, engine.ErrPlayerCount
+	}
+
+	s := &state{
+		rng:     setup.Rand,
+		players: append([]string(nil), setup.Players...),
+		books:   make([][]string, len(setup.Players)),
+	}
+	handSize := smallHandSize
+	if len(s.players) > 3 {
+		handSize = largeHandSize
+	}
+	deck := cards.NewDeck()
+	cards.Shuffle(deck, s.rng)
+	s.hands, s.pond = cards.Deal(deck, len(s.players), handSize)
+	for seat := range s.hands {
+		s.layBooks(seat)
+		cards.Sort(s.hands[seat])
+	}
+	s.startTurn(0)
+	return s, nil
+}
+
+func (s *state) seatOf(player string) int {
+	for i, p := range s.players {
+		if p == player {
+			return i
+		}
+	}
+	return -1
+}
+
+// holds reports whether seat holds a card of rank.
+func (s *state) holds(seat int, rank string) bool {
+	for _, card := range s.hands[seat] {
+		if card.Rank == rank {
+			return true
+		}
+	}
+	return false
+}
+
+// layBooks lays down every rank seat holds all four cards of and returns
+// the last one, or "".
+func (s *state) layBooks(seat int) string {
+	counts := make(map[string]int)
+	for _, card := range s.hands[seat] {
+		counts[card.Rank]++
+	}
+	laid := ""
+	for _, rank := range cards.Ranks {
+		if counts[rank] < bookSize {
+			continue
+		}
+		kept := s.hands[seat][:0]
+		for _, card := range s.hands[seat] {
+			if card.Rank != rank {
+				kept = append(kept, card)
+			}
+		}
+		s.hands[seat] = kept
+		s.books[seat] = append(s.books[seat], rank)
+		laid = rank
+	}
+	return laid
+}
+
+func (s *state) bookCount() int {
+	n := 0
+	for _, books := range s.books {
+		n += len(books)
+	}
+	return n
+}
+
+// draw moves the top card of the pond to seat's hand.
+func (s *state) draw(seat int) cards.Card {
+	card := s.pond[len(s.pond)-1]
+	s.pond = s.pond[:len(s.pond)-1]
+	s.hands[seat] = append(s.hands[seat], card)
+	cards.Sort(s.hands[seat])
+	return card
+}
+
+// startTurn gives the turn to the first player from seat on who can play.
+// A player whose hand ran out draws a card from the pond; without cards
+// in hand or pond they are skipped. The game is over once every book is
+// laid down.
+func (s *state) startTurn(seat int) {
+	if s.bookCount() == len(cards.Ranks) {
+		s.over = true
+		return
+	}
+	for i := 0; i < len(s.players); i++ {
+		next := (seat + i) % len(s.players)
+		if len(s.hands[next]) == 0 && len(s.pond) > 0 {
+			s.draw(next)
+		}
+		if len(s.hands[next]) > 0 {
+			s.turn = next
+			return
+		}
+	}
+	s.over = true
+}
+
+// targets lists the seats seat may ask: everyone else holding cards.
+func (s *state) targets(seat int) []int {
+	var targets []int
+	for other := range s.players {
+		if other != seat && len(s.hands[other]) > 0 {
+			targets = append(targets, other)
+		}
+	}
+	return targets
+}
+
+type askData struct {
+	Player string `json:"player"`
+	Rank   string `json:"rank"`
+}
+
+func (Game) LegalMoves(st engine.State, player string) []engine.Move {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat != s.turn || s.over {
+		return nil
+	}
+
+	targets := s.targets(seat)
+	if len(targets) == 0 {
+		return []engine.Move{engine.NewMove("draw", nil)}
+	}
+	var moves []engine.Move
+	for _, rank := range cards.Ranks {
+		if !s.holds(seat, rank) {
+			continue
+		}
+		for _, target := range targets {
+			moves = append(moves, engine.NewMove("ask", askData{Player: s.players[target], Rank: rank}))
+		}
+	}
+	return moves
+}
+
+func (Game) ApplyMove(st engine.State, player string, move engine.Move) (engine.State, error) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 {
+		return nil, engine.ErrNotPlayer
+	}
+	if s.over {
+		return nil, engine.ErrGameOver
+	}
+	if seat != s.turn {
+		return nil, engine.ErrNotYourTurn
+	}
+
+	switch move.Action {
+	case "ask":
+		var data askData
+		if err := move.Decode(&data); err != nil {
+			return nil, err
+		}
+		target := s.seatOf(data.Player)
+		switch {
+		case target < 0 || target == seat:
+			return nil, fmt.Errorf("%w: ask another player", engine.ErrIllegalMove)
+		case len(s.hands[target]) == 0:
+			return nil, fmt.Errorf("%w: %s has no cards", engine.ErrIllegalMove, data.Player)
+		case !s.holds(seat, data.Rank):
+			return nil, fmt.Errorf("%w: you may only ask for a rank you hold", engine.ErrIllegalMove)
+		}
+		s.ask(seat, target, data.Rank)
+		return s, nil
+
+	case "draw":
+		if len(s.targets(seat)) > 0 {
+			return nil, fmt.Errorf("%w: ask another player for a rank", engine.ErrIllegalMove)
+		}
+		s.lastAsk = &askResult{Player: player, Fished: true}
+		s.draw(seat)
+		s.lastAsk.NewBook = s.layBooks(seat)
+		s.startTurn(seat + 1)
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown action %q", engine.ErrIllegalMove, move.Action)
+}
+
+// ask takes every card of rank from target. When target has none, seat
+// goes fishing. Getting cards or fishing the rank asked for earns another
+// turn.
+func (s *state) ask(seat, target int, rank string) {
+	result := &askResult{Player: s.players[seat], Target: s.players[target], Rank: rank}
+	kept := s.hands[target][:0]
+	for _, card := range s.hands[target] {
+		if card.Rank == rank {
+			s.hands[seat] = append(s.hands[seat], card)
+			result.Given++
+		} else {
+			kept = append(kept, card)
+		}
+	}
+	s.hands[target] = kept
+	cards.Sort(s.hands[seat])
+
+	again := result.Given > 0
+	if !again && len(s.pond) > 0 {
+		result.Fished = true
+		drawn := s.draw(seat)
+		result.Lucky = drawn.Rank == rank
+		again = result.Lucky
+	}
+	result.NewBook = s.layBooks(seat)
+	s.lastAsk = result
+
+	if again {
+		s.startTurn(seat)
+	} else {
+		s.startTurn(seat + 1)
+	}
+}
+
+// AutoMove is the move made for a player who ran out of time: they ask the
+// player holding the most cards for the rank they hold the most of.
+func (Game) AutoMove(st engine.State, player string) (engine.Move, bool) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat != s.turn || s.over {
+		return engine.Move{}, false
+	}
+	targets := s.targets(seat)
+	if len(targets) == 0 {
+		return engine.NewMove("draw", nil), true
+	}
+	target := targets[0]
+	for _, other := range targets[1:] {
+		if len(s.hands[other]) > len(s.hands[target]) {
+			target = other
+		}
+	}
+	counts := make(map[string]int)
+	rank := ""
+	for _, card := range s.hands[seat] {
+		counts[card.Rank]++
+		if counts[card.Rank] > counts[rank] {
+			rank = card.Rank
+		}
+	}
+	return engine.NewMove("ask", askData{Player: s.players[target], Rank: rank}), true
+}
+
+func (Game) CurrentPlayer(st engine.State) string {
+	s := st.(*state)
+	if s.over {
+		return ""
+	}
+	return s.players[s.turn]
+}
+
+func (Game) IsTerminal(st engine.State) bool {
+	return st.(*state).over
+}
+
+// Winners returns the players with the most books once the game is over.
+func (Game) Winners(st engine.State) []string {
+	s := st.(*state)
+	if !s.over {
+		return nil
+	}
+	return Game{}.Standings(s)[0]
+}
+
+// Standings ranks the players by the number of books they laid down.
+func (Game) Standings(st engine.State) [][]string {
+	s := st.(*state)
+	counts := make([]int, len(s.players))
+	for seat, books := range s.books {
+		counts[seat] = len(books)
+	}
+	return engine.RankByScore(s.players, counts)
+}
+
+type playerSummary struct {
+	ID    string   `json:"id"`
+	Cards int      `json:"cards"`
+	Books []string `json:"books"`
+}
+
+type view struct {
+	Players       []playerSummary `json:"players"`
+	CurrentPlayer string          `json:"currentPlayer,omitempty"`
+	Pond          int             `json:"pond"`
+	LastAsk       *askResult      `json:"lastAsk,omitempty"`
+	Winners       []string        `json:"winners,omitempty"`
+
+	// Only in a player's own view
+	Hand []cards.Card `json:"hand,omitempty"`
+}
+
+func (s *state) publicView() view {
+	v := view{
+		CurrentPlayer: Game{}.CurrentPlayer(s),
+		Pond:          len(s.pond),
+		LastAsk:       s.lastAsk,
+		Winners:       Game{}.Winners(s),
+	}
+	for i, player := range s.players {
+		v.Players = append(v.Players, playerSummary{
+			ID:    player,
+			Cards: len(s.hands[i]),
+			Books: append([]string{}, s.books[i]...),
+		})
+	}
+	return v
+}
+
+func (Game) PublicView(st engine.State) interface{} {
+	return st.(*state).publicView()
+}
+
+func (Game) PlayerView(st engine.State, player string) interface{} {
+	s := st.(*state)
+	v := s.publicView()
+	if seat := s.seatOf(player); seat >= 0 {
+		v.Hand = append([]cards.Card{}, s.hands[seat]...)
+	}
+	return v
+}
@@ -0,0 +1,175 @@
+package gofish
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"norex/engine"
+	"norex/games/cards"
+)
+
+func newTestState(t *testing.T, players int) *state {
+	t.Helper()
+	ids := []string{"a", "b", "c", "d", "e", "f"}[:players]
+	st, err := Game{}.NewState(engine.Setup{Players: ids, Options: engine.Options{}, Rand: rand.New(rand.NewSource(1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st.(*state)
+}
+
+func TestDeal(t *testing.T) {
+	tests := []struct {
+		players  int
+		handSize int
+	}{
+		{2, 7},
+		{3, 7},
+		{4, 5},
+		{6, 5},
+	}
+	for _, tt := range tests {
+		s := newTestState(t, tt.players)
+		dealt := 0
+		for seat, hand := range s.hands {
+			// Books laid down at the deal count towards the hand
+			if got := len(hand) + bookSize*len(s.books[seat]); got != tt.handSize {
+				t.Errorf("%d players: seat %d was dealt %d cards, want %d", tt.players, seat, got, tt.handSize)
+			}
+			dealt += tt.handSize
+		}
+		if len(s.pond) != 52-dealt {
+			t.Errorf("%d players: pond of %d cards, want %d", tt.players, len(s.pond), 52-dealt)
+		}
+	}
+}
+
+func TestAsk(t *testing.T) {
+	tests := []struct {
+		name      string
+		hand      []string
+		target    []string
+		pond      []string // the last card is drawn first
+		want      askResult
+		wantTurn  int
+		wantCards int // in the asker's hand afterwards
+	}{
+		{"given", []string{"7C", "2D"}, []string{"7D", "7H", "2S"}, []string{"3C"},
+			askResult{Given: 2}, 0, 4},
+		{"go fish", []string{"7C"}, []string{"2S"}, []string{"3C"},
+			askResult{Fished: true}, 1, 2},
+		{"lucky fish", []string{"7C"}, []string{"2S"}, []string{"3C", "7S"},
+			askResult{Fished: true, Lucky: true}, 0, 2},
+		{"book", []string{"7C", "7S", "2D"}, []string{"7D", "7H"}, []string{"3C"},
+			askResult{Given: 2, NewBook: "7"}, 0, 1},
+		{"empty pond", []string{"7C"}, []string{"2S"}, nil,
+			askResult{}, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, 2)
+			s.hands = [][]cards.Card{cards.MustParse(tt.hand...), cards.MustParse(tt.target...)}
+			s.books = make([][]string, 2)
+			s.pond = cards.MustParse(tt.pond...)
+			s.turn = 0
+
+			if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("ask", askData{Player: "b", Rank: "7"})); err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			want.Player, want.Target, want.Rank = "a", "b", "7"
+			if *s.lastAsk != want {
+				t.Fatalf("lastAsk = %+v, want %+v", *s.lastAsk, want)
+			}
+			if s.turn != tt.wantTurn || len(s.hands[0]) != tt.wantCards {
+				t.Fatalf("turn %d, a holds %d cards; want turn %d and %d cards", s.turn, len(s.hands[0]), tt.wantTurn, tt.wantCards)
+			}
+		})
+	}
+}
+
+func TestAskValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		ask  askData
+	}{
+		{"rank not held", askData{Player: "b", Rank: "K"}},
+		{"themselves", askData{Player: "a", Rank: "7"}},
+		{"nobody", askData{Player: "z", Rank: "7"}},
+		{"empty hand", askData{Player: "c", Rank: "7"}},
+	}
+	for _, tt := range tests {
+		s := newTestState(t, 3)
+		s.hands = [][]cards.Card{cards.MustParse("7C"), cards.MustParse("2S"), nil}
+		s.turn = 0
+		if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("ask", tt.ask)); !errors.Is(err, engine.ErrIllegalMove) {
+			t.Errorf("%s: %v, want an illegal move", tt.name, err)
+		}
+	}
+}
+
+func TestEmptyHands(t *testing.T) {
+	t.Run("draw from the pond", func(t *testing.T) {
+		s := newTestState(t, 2)
+		s.hands = [][]cards.Card{cards.MustParse("7C"), nil}
+		s.pond = cards.MustParse("4D")
+		s.startTurn(1)
+		if s.turn != 1 || len(s.hands[1]) != 1 {
+			t.Fatalf("turn %d with %d cards, want b to draw and play", s.turn, len(s.hands[1]))
+		}
+	})
+
+	t.Run("skipped once the pond is empty", func(t *testing.T) {
+		s := newTestState(t, 3)
+		s.hands = [][]cards.Card{cards.MustParse("7C"), nil, cards.MustParse("2S")}
+		s.pond = nil
+		s.startTurn(1)
+		if s.turn != 2 {
+			t.Fatalf("turn %d, want c", s.turn)
+		}
+	})
+
+	t.Run("draw when nobody else holds cards", func(t *testing.T) {
+		s := newTestState(t, 2)
+		s.hands = [][]cards.Card{cards.MustParse("7C"), nil}
+		s.pond = cards.MustParse("4D")
+		s.turn = 0
+		moves := Game{}.LegalMoves(s, "a")
+		if len(moves) != 1 || moves[0].Action != "draw" {
+			t.Fatalf("moves = %v, want a draw", moves)
+		}
+		if _, err := (Game{}).ApplyMove(s, "a", moves[0]); err != nil {
+			t.Fatal(err)
+		}
+		if len(s.hands[0]) != 2 || len(s.pond) != 0 {
+			t.Fatalf("a holds %d cards, pond %d", len(s.hands[0]), len(s.pond))
+		}
+	})
+}
+
+func TestWinners(t *testing.T) {
+	tests := []struct {
+		name  string
+		books [][]string
+		want  []string
+	}{
+		{"most books", [][]string{{"2", "3", "4", "5", "6", "7", "8"}, {"9", "10", "J"}, {"Q", "K", "A"}}, []string{"a"}},
+		{"tie", [][]string{{"2", "3", "4", "5", "6"}, {"7", "8", "9", "10", "J"}, {"Q", "K", "A"}}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, 3)
+			s.hands = make([][]cards.Card, 3)
+			s.books = tt.books
+			s.startTurn(0)
+			if !(Game{}).IsTerminal(s) {
+				t.Fatal("the game is not over with every book down")
+			}
+			if got := (Game{}).Winners(s); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("winners = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,636 @@
+// Package hearts implements Hearts for three to six players for the game
+// engine.
+package hearts
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"norex/catalog"
+	"norex/engine"
+	"norex/games/cards"
+)
+
+const (
+	minPlayers      = 3
+	maxPlayers      = 6
+	passSize        = 3
+	defaultEndScore = 100
+
+	// defaultPassSeconds is how long the players have to pass their cards
+	// before the highest ones are passed for them
+	defaultPassSeconds = 60
+
+	// moonPoints is every point of a hand: the 13 hearts and the Queen of
+	// Spades
+	moonPoints = 26
+)
+
+// Phases of a hand.
+const (
+	phasePassing = "passing"
+	phasePlaying = "playing"
+	phaseOver    = "over"
+)
+
+// Pass directions, rotating every hand.
+const (
+	passLeft   = "left"
+	passRight  = "right"
+	passAcross = "across"
+	passHold   = "hold"
+)
+
+var (
+	twoOfClubs    = cards.Card{Suit: cards.Clubs, Rank: "2"}
+	queenOfSpades = cards.Card{Suit: cards.Spades, Rank: "Q"}
+)
+
+// removedCards are taken out of the deck so that it deals evenly. The two
+// of clubs always stays in, it leads the first trick.
+var removedCards = map[int][]cards.Card{
+	3: {{Suit: cards.Diamonds, Rank: "2"}},
+	5: {{Suit: cards.Diamonds, Rank: "2"}, {Suit: cards.Spades, Rank: "2"}},
+	6: {{Suit: cards.Diamonds, Rank: "2"}, {Suit: cards.Spades, Rank: "2"}, {Suit: cards.Diamonds, Rank: "3"}, {Suit: cards.Spades, Rank: "3"}},
+}
+
+// points is what taking a card costs.
+func points(card cards.Card) int {
+	switch {
+	case card.Suit == cards.Hearts:
+		return 1
+	case card == queenOfSpades:
+		return 13
+	}
+	return 0
+}
+
+type play struct {
+	seat int
+	card cards.Card
+}
+
+// state is the authoritative state of a Hearts game.
+type state struct {
+	rng *rand.Rand
+
+	players []string
+	hands   [][]cards.Card
+	turn    int
+	phase   string
+
+	passing     [][]cards.Card // cards each player passes, nil until they chose
+	received    [][]cards.Card // cards each player was passed this hand
+	passFor     time.Duration
+	passStarted time.Time
+
+	trick        []play
+	lastTrick    *completedTrick
+	firstTrick   bool
+	heartsBroken bool
+	taken        []int // points taken this hand
+
+	scores    []int
+	endScore  int
+	round     int
+	lastRound *roundResult
+}
+
+// Game is the Hearts rule set.
+type Game struct{}
+
+func init() {
+	catalog.Register(catalog.Game{
+		Key:         "hearts",
+		DisplayName: "Hearts",
+		Icon:        "hearts.png",
+		MinPlayers:  minPlayers,
+		MaxPlayers:  maxPlayers,
+		VoiceChat:   true,
+		TextChat:    true,
+		Options: []catalog.Option{
+			{Key: "endScore", Kind: catalog.OptionInt, Default: defaultEndScore, Min: 26, Max: 500},
+			{Key: "passSeconds", Kind: catalog.OptionInt, Default: defaultPassSeconds, Min: 10, Max: 600},
+		},
+		New: func() engine.Game { return Game{} },
+	})
+}
+
+// NewState deals the first hand. The "endScore" option sets the score
+// that ends the game (100 by default) and "passSeconds" how long the
+// players have to pass their cards (60 by default).
+func (Game) NewState(setup engine.Setup) (engine.State, error) {
+	if len(setup.Players) < minPlayers || len(setup.Players) > maxPlayers {
+		return nil, engine.ErrPlayerCount
+	}
+
+	s := &state{
+		rng:      setup.Rand,
+		players:  append([]string(nil), setup.Players...),
+		scores:   make([]int, len(setup.Players)),
+		endScore: setup.Options.Int("endScore", defaultEndScore),
+		passFor:  time.Duration(setup.Options.Int("passSeconds", defaultPassSeconds)) * time.Second,
+	}
+	if s.endScore <= 0 {
+		s.endScore = defaultEndScore
+	}
+	if s.passFor <= 0 {
+		s.passFor = defaultPassSeconds * time.Second
+	}
+	s.deal()
+	return s, nil
+}
+
+// passDirection returns where the cards go this hand: left, right, across
+// when the players can be paired up, then a hand without passing.
+func (s *state) passDirection() string {
+	directions := []string{passLeft, passRight, passHold}
+	if len(s.players)%2 == 0 {
+		directions = []string{passLeft, passRight, passAcross, passHold}
+	}
+	return directions[(s.round-1)%len(directions)]
+}
+
+// receiver returns the seat the cards of seat are passed to.
+func (s *state) receiver(seat int) int {
+	n := len(s.players)
+	switch s.passDirection() {
+	case passRight:
+		return (seat - 1 + n) % n
+	case passAcross:
+		return (seat + n/2) % n
+	}
+	return (seat + 1) % n
+}
+
+// deal shuffles and deals a new hand, evenly, with the cards of
+// removedCards left out.
+func (s *state) deal() {
+	s.round++
+	var deck []cards.Card
+	for _, card := range cards.NewDeck() {
+		if cards.Index(removedCards[len(s.players)], card) < 0 {
+			deck = append(deck, card)
+		}
+	}
+	cards.Shuffle(deck, s.rng)
+	s.hands, _ = cards.Deal(deck, len(s.players), len(deck)/len(s.players))
+	for _, hand := range s.hands {
+		cards.Sort(hand)
+	}
+
+	s.passing = make([][]cards.Card, len(s.players))
+	s.received = make([][]cards.Card, len(s.players))
+	s.taken = make([]int, len(s.players))
+	s.trick = nil
+	s.lastTrick = nil
+	s.heartsBroken = false
+	s.firstTrick = true
+	if s.passDirection() == passHold {
+		s.startPlaying()
+	} else {
+		s.phase = phasePassing
+		s.passStarted = time.Now()
+	}
+}
+
+// highestCards returns the n highest cards of hand, the ones passed for a
+// player who did not choose in time.
+func highestCards(hand []cards.Card, n int) []cards.Card {
+	sorted := append([]cards.Card(nil), hand...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Value() > sorted[j].Value() })
+	return sorted[:n]
+}
+
+// startPlaying gives the lead to whoever holds the two of clubs.
+func (s *state) startPlaying() {
+	s.phase = phasePlaying
+	for seat, hand := range s.hands {
+		if cards.Index(hand, twoOfClubs) >= 0 {
+			s.turn = seat
+		}
+	}
+}
+
+func (s *state) seatOf(player string) int {
+	for i, p := range s.players {
+		if p == player {
+			return i
+		}
+	}
+	return -1
+}
+
+// legalCards lists the cards seat may play to the current trick.
+func (s *state) legalCards(seat int) []cards.Card {
+	hand := s.hands[seat]
+	if len(s.trick) == 0 {
+		if s.firstTrick {
+			return []cards.Card{twoOfClubs}
+		}
+		// Hearts may not be led before they are broken, unless nothing else is left
+		var legal []cards.Card
+		for _, card := range hand {
+			if card.Suit != cards.Hearts || s.heartsBroken {
+				legal = append(legal, card)
+			}
+		}
+		if len(legal) == 0 {
+			return append(legal, hand...)
+		}
+		return legal
+	}
+
+	led := s.trick[0].card.Suit
+	var legal []cards.Card
+	for _, card := range hand {
+		if card.Suit == led {
+			legal = append(legal, card)
+		}
+	}
+	if len(legal) > 0 {
+		return legal
+	}
+	// No points on the first trick, unless the hand holds nothing else
+	if s.firstTrick {
+		for _, card := range hand {
+			if points(card) == 0 {
+				legal = append(legal, card)
+			}
+		}
+		if len(legal) > 0 {
+			return legal
+		}
+	}
+	return append(legal, hand...)
+}
+
+type passData struct {
+	Cards []string `json:"cards"`
+}
+
+type playData struct {
+	Card string `json:"card"`
+}
+
+// LegalMoves lists the cards the player may play. Passes are left out:
+// any three cards of the hand may be passed.
+func (Game) LegalMoves(st engine.State, player string) []engine.Move {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 || s.phase != phasePlaying || seat != s.turn {
+		return nil
+	}
+
+	var moves []engine.Move
+	for _, card := range s.legalCards(seat) {
+		moves = append(moves, engine.NewMove("play", playData{Card: card.Code()}))
+	}
+	return moves
+}
+
+func (Game) ApplyMove(st engine.State, player string, move engine.Move) (engine.State, error) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 {
+		return nil, engine.ErrNotPlayer
+	}
+	if s.phase == phaseOver {
+		return nil, engine.ErrGameOver
+	}
+
+	switch move.Action {
+	case "pass":
+		if s.phase != phasePassing {
+			return nil, fmt.Errorf("%w: there is nothing to pass now", engine.ErrIllegalMove)
+		}
+		if s.passing[seat] != nil {
+			return nil, fmt.Errorf("%w: you already passed your cards", engine.ErrIllegalMove)
+		}
+		var data passData
+		if err := move.Decode(&data); err != nil {
+			return nil, err
+		}
+		if len(data.Cards) != passSize {
+			return nil, fmt.Errorf("%w: pass exactly %d cards", engine.ErrIllegalMove, passSize)
+		}
+		var passed []cards.Card
+		for _, code := range data.Cards {
+			card, ok := cards.Parse(code)
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown card %q", engine.ErrIllegalMove, code)
+			}
+			if cards.Index(s.hands[seat], card) < 0 {
+				return nil, fmt.Errorf("%w: you do not hold %s", engine.ErrIllegalMove, card)
+			}
+			if cards.Index(passed, card) >= 0 {
+				return nil, fmt.Errorf("%w: %s is passed twice", engine.ErrIllegalMove, card)
+			}
+			passed = append(passed, card)
+		}
+		s.passing[seat] = passed
+		s.exchangeIfReady()
+		return s, nil
+
+	case "play":
+		if s.phase != phasePlaying {
+			return nil, fmt.Errorf("%w: wait for everyone to pass", engine.ErrIllegalMove)
+		}
+		if seat != s.turn {
+			return nil, engine.ErrNotYourTurn
+		}
+		var data playData
+		if err := move.Decode(&data); err != nil {
+			return nil, err
+		}
+		card, ok := cards.Parse(data.Card)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown card %q", engine.ErrIllegalMove, data.Card)
+		}
+		index := cards.Index(s.hands[seat], card)
+		if index < 0 {
+			return nil, fmt.Errorf("%w: you do not hold %s", engine.ErrIllegalMove, card)
+		}
+		if cards.Index(s.legalCards(seat), card) < 0 {
+			switch {
+			case len(s.trick) == 0 && s.firstTrick:
+				return nil, fmt.Errorf("%w: the two of clubs leads the first trick", engine.ErrIllegalMove)
+			case len(s.trick) == 0:
+				return nil, fmt.Errorf("%w: hearts are not broken yet", engine.ErrIllegalMove)
+			case cards.HasSuit(s.hands[seat], s.trick[0].card.Suit):
+				return nil, fmt.Errorf("%w: you must follow %s", engine.ErrIllegalMove, s.trick[0].card.Suit)
+			}
+			return nil, fmt.Errorf("%w: no points on the first trick", engine.ErrIllegalMove)
+		}
+		s.play(seat, index)
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown action %q", engine.ErrIllegalMove, move.Action)
+}
+
+// exchangeIfReady hands the passed cards over once every player chose
+// theirs, and starts the play.
+func (s *state) exchangeIfReady() {
+	for _, passed := range s.passing {
+		if passed == nil {
+			return
+		}
+	}
+	for seat, passed := range s.passing {
+		for _, card := range passed {
+			s.hands[seat] = cards.Remove(s.hands[seat], cards.Index(s.hands[seat], card))
+		}
+	}
+	for seat, passed := range s.passing {
+		to := s.receiver(seat)
+		s.hands[to] = append(s.hands[to], passed...)
+		s.received[to] = passed
+	}
+	for _, hand := range s.hands {
+		cards.Sort(hand)
+	}
+	s.startPlaying()
+}
+
+// play puts the card at index of seat's hand on the trick. The highest
+// card of the suit led takes the trick and leads the next one.
+func (s *state) play(seat, index int) {
+	card := s.hands[seat][index]
+	s.hands[seat] = cards.Remove(s.hands[seat], index)
+	if card.Suit == cards.Hearts {
+		s.heartsBroken = true
+	}
+	s.trick = append(s.trick, play{seat: seat, card: card})
+	if len(s.trick) < len(s.players) {
+		s.turn = (seat + 1) % len(s.players)
+		return
+	}
+
+	best := s.trick[0]
+	for _, p := range s.trick[1:] {
+		if p.card.Suit == best.card.Suit && p.card.Value() > best.card.Value() {
+			best = p
+		}
+	}
+	s.lastTrick = &completedTrick{Winner: s.players[best.seat]}
+	for _, p := range s.trick {
+		s.taken[best.seat] += points(p.card)
+		s.lastTrick.Cards = append(s.lastTrick.Cards, trickCard{Player: s.players[p.seat], Card: p.card})
+	}
+	s.trick = nil
+	s.firstTrick = false
+	s.turn = best.seat
+	if len(s.hands[best.seat]) == 0 {
+		s.finishHand()
+	}
+}
+
+// finishHand adds the points of the hand to the scores, and either ends
+// the game or deals the next hand. A player who took every point shot the
+// moon: everyone else takes 26 points instead.
+func (s *state) finishHand() {
+	result := &roundResult{Round: s.round, Points: append([]int(nil), s.taken...)}
+	for seat, taken := range s.taken {
+		if taken == moonPoints {
+			result.ShotTheMoon = s.players[seat]
+			for other := range result.Points {
+				result.Points[other] = moonPoints
+			}
+			result.Points[seat] = 0
+		}
+	}
+	over := false
+	for seat, p := range result.Points {
+		s.scores[seat] += p
+		if s.scores[seat] >= s.endScore {
+			over = true
+		}
+	}
+	s.lastRound = result
+
+	if over {
+		s.phase = phaseOver
+		return
+	}
+	s.deal()
+}
+
+// AutoMove is the move made for a player who ran out of time: their
+// three highest cards while passing, then their lowest legal card,
+// keeping points for last.
+func (Game) AutoMove(st engine.State, player string) (engine.Move, bool) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat >= 0 && s.phase == phasePassing && s.passing[seat] == nil {
+		var codes []string
+		for _, card := range highestCards(s.hands[seat], passSize) {
+			codes = append(codes, card.Code())
+		}
+		return engine.NewMove("pass", passData{Cards: codes}), true
+	}
+	if s.phase != phasePlaying || seat != s.turn {
+		return engine.Move{}, false
+	}
+	legal := s.legalCards(seat)
+	lowest := legal[0]
+	for _, card := range legal[1:] {
+		if points(card) < points(lowest) || (points(card) == points(lowest) && card.Value() < lowest.Value()) {
+			lowest = card
+		}
+	}
+	return engine.NewMove("play", playData{Card: lowest.Code()}), true
+}
+
+// Timer runs while cards are passed, so that an idle player can not hold
+// up the hand.
+func (Game) Timer(st engine.State) (time.Duration, bool) {
+	s := st.(*state)
+	if s.phase != phasePassing {
+		return 0, false
+	}
+	return max(s.passFor-time.Since(s.passStarted), 0), true
+}
+
+// Timeout passes the three highest cards of everyone who has not chosen
+// yet.
+func (Game) Timeout(st engine.State) (engine.State, error) {
+	s := st.(*state)
+	if s.phase != phasePassing {
+		return s, nil
+	}
+	for seat, passed := range s.passing {
+		if passed == nil {
+			s.passing[seat] = highestCards(s.hands[seat], passSize)
+		}
+	}
+	s.exchangeIfReady()
+	return s, nil
+}
+
+// CurrentPlayer is "" while cards are passed, when everyone acts at once.
+func (Game) CurrentPlayer(st engine.State) string {
+	s := st.(*state)
+	if s.phase != phasePlaying {
+		return ""
+	}
+	return s.players[s.turn]
+}
+
+func (Game) IsTerminal(st engine.State) bool {
+	return st.(*state).phase == phaseOver
+}
+
+// Winners returns the players with the lowest score once the game is over.
+func (Game) Winners(st engine.State) []string {
+	s := st.(*state)
+	if s.phase != phaseOver {
+		return nil
+	}
+	return Game{}.Standings(s)[0]
+}
+
+// Standings ranks the players from the lowest score to the highest.
+func (Game) Standings(st engine.State) [][]string {
+	s := st.(*state)
+	negated := make([]int, len(s.scores))
+	for i, score := range s.scores {
+		negated[i] = -score
+	}
+	return engine.RankByScore(s.players, negated)
+}
+
+type trickCard struct {
+	Player string     `json:"player"`
+	Card   cards.Card `json:"card"`
+}
+
+type completedTrick struct {
+	Cards  []trickCard `json:"cards"`
+	Winner string      `json:"winner"`
+}
+
+type roundResult struct {
+	Round       int    `json:"round"`
+	Points      []int  `json:"points"` // in seat order
+	ShotTheMoon string `json:"shotTheMoon,omitempty"`
+}
+
+type playerSummary struct {
+	ID     string `json:"id"`
+	Cards  int    `json:"cards"`
+	Points int    `json:"points"` // taken this hand
+	Score  int    `json:"score"`
+	Passed bool   `json:"passed,omitempty"`
+}
+
+type view struct {
+	Players       []playerSummary `json:"players"`
+	Phase         string          `json:"phase"`
+	PassDirection string          `json:"passDirection"`
+	PassDeadline  *time.Time      `json:"passDeadline,omitempty"` // when the highest cards are passed for whoever has not chosen
+	CurrentPlayer string          `json:"currentPlayer,omitempty"`
+	Trick         []trickCard     `json:"trick"`
+	LastTrick     *completedTrick `json:"lastTrick,omitempty"`
+	HeartsBroken  bool            `json:"heartsBroken"`
+	Round         int             `json:"round"`
+	EndScore      int             `json:"endScore"`
+	LastRound     *roundResult    `json:"lastRound,omitempty"`
+	Winners       []string        `json:"winners,omitempty"`
+
+	// Only in a player's own view
+	Hand     []cards.Card `json:"hand,omitempty"`
+	Passing  []cards.Card `json:"passing,omitempty"`  // chosen, waiting for the others
+	Received []cards.Card `json:"received,omitempty"` // passed to them this hand
+}
+
+func (s *state) publicView() view {
+	v := view{
+		Phase:         s.phase,
+		PassDirection: s.passDirection(),
+		Trick:         []trickCard{},
+		LastTrick:     s.lastTrick,
+		HeartsBroken:  s.heartsBroken,
+		Round:         s.round,
+		EndScore:      s.endScore,
+		LastRound:     s.lastRound,
+		Winners:       Game{}.Winners(s),
+	}
+	if s.phase == phasePassing {
+		deadline := s.passStarted.Add(s.passFor)
+		v.PassDeadline = &deadline
+	}
+	for i, player := range s.players {
+		v.Players = append(v.Players, playerSummary{
+			ID:     player,
+			Cards:  len(s.hands[i]),
+			Points: s.taken[i],
+			Score:  s.scores[i],
+			Passed: s.phase == phasePassing && s.passing[i] != nil,
+		})
+	}
+	for _, p := range s.trick {
+		v.Trick = append(v.Trick, trickCard{Player: s.players[p.seat], Card: p.card})
+	}
+	v.CurrentPlayer = Game{}.CurrentPlayer(s)
+	return v
+}
+
+func (Game) PublicView(st engine.State) interface{} {
+	return st.(*state).publicView()
+}
+
+func (Game) PlayerView(st engine.State, player string) interface{} {
+	s := st.(*state)
+	v := s.publicView()
+	if seat := s.seatOf(player); seat >= 0 {
+		v.Hand = append([]cards.Card{}, s.hands[seat]...)
+		if s.phase == phasePassing {
+			v.Passing = s.passing[seat]
+		}
+		v.Received = s.received[seat]
+	}
+	return v
+}
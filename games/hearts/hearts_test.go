@@ -0,0 +1,230 @@
+package hearts
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"norex/engine"
+	"norex/games/cards"
+)
+
+func newTestState(t *testing.T, players int, seed int64) *state {
+	t.Helper()
+	ids := []string{"a", "b", "c", "d", "e", "f"}[:players]
+	st, err := Game{}.NewState(engine.Setup{Players: ids, Options: engine.Options{}, Rand: rand.New(rand.NewSource(seed))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st.(*state)
+}
+
+func TestPassTimeout(t *testing.T) {
+	s := newTestState(t, 4, 1)
+	if s.phase != phasePassing {
+		t.Fatalf("phase = %s, want %s", s.phase, phasePassing)
+	}
+	delay, pending := Game{}.Timer(s)
+	if !pending || delay <= 0 || delay > defaultPassSeconds*time.Second {
+		t.Fatalf("Timer = %v, %v; want the pass deadline pending", delay, pending)
+	}
+
+	// a chooses, the others stay idle
+	chosen := []string{s.hands[0][0].Code(), s.hands[0][1].Code(), s.hands[0][2].Code()}
+	if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("pass", passData{Cards: chosen})); err != nil {
+		t.Fatal(err)
+	}
+	idle := append([]cards.Card(nil), s.hands[1]...)
+	if _, err := (Game{}).Timeout(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.phase != phasePlaying {
+		t.Fatalf("phase = %s after the timeout, want %s", s.phase, phasePlaying)
+	}
+	if _, pending := (Game{}).Timer(s); pending {
+		t.Fatal("pass timer still pending while playing")
+	}
+	for i, card := range s.passing[0] {
+		if card.Code() != chosen[i] {
+			t.Fatalf("a passed %v, want their own choice %v", s.passing[0], chosen)
+		}
+	}
+	for _, passed := range s.passing[1] {
+		for _, kept := range idle {
+			if cards.Index(s.passing[1], kept) < 0 && kept.Value() > passed.Value() {
+				t.Fatalf("b passed %s but kept the higher %s", passed, kept)
+			}
+		}
+	}
+}
+
+func TestAutoMovePasses(t *testing.T) {
+	s := newTestState(t, 3, 2)
+	move, ok := Game{}.AutoMove(s, "c")
+	if !ok || move.Action != "pass" {
+		t.Fatalf("AutoMove = %+v, %v; want a pass", move, ok)
+	}
+	if _, err := (Game{}).ApplyMove(s, "c", move); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := (Game{}).AutoMove(s, "c"); ok {
+		t.Fatal("AutoMove passed twice")
+	}
+}
+
+func TestDeal(t *testing.T) {
+	tests := []struct {
+		players  int
+		handSize int
+	}{
+		{3, 17},
+		{4, 13},
+		{5, 10},
+		{6, 8},
+	}
+	for _, tt := range tests {
+		s := newTestState(t, tt.players, 1)
+		for seat, hand := range s.hands {
+			if len(hand) != tt.handSize {
+				t.Errorf("%d players: seat %d holds %d cards, want %d", tt.players, seat, len(hand), tt.handSize)
+			}
+			for _, removed := range removedCards[tt.players] {
+				if cards.Index(hand, removed) >= 0 {
+					t.Errorf("%d players: %s was dealt", tt.players, removed)
+				}
+			}
+		}
+	}
+}
+
+func TestPassDirections(t *testing.T) {
+	tests := []struct {
+		players int
+		want    []string // seat 0 passes to, by round
+	}{
+		{4, []string{"1", "3", "2", "hold", "1"}},
+		{3, []string{"1", "2", "hold", "1"}},
+	}
+	for _, tt := range tests {
+		s := newTestState(t, tt.players, 1)
+		var got []string
+		for round := range tt.want {
+			s.round = round + 1
+			if s.passDirection() == passHold {
+				got = append(got, passHold)
+			} else {
+				got = append(got, fmt.Sprint(s.receiver(0)))
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%d players: receivers %v, want %v", tt.players, got, tt.want)
+		}
+	}
+}
+
+func TestLegalCards(t *testing.T) {
+	tests := []struct {
+		name       string
+		hand       []string
+		trick      []string
+		firstTrick bool
+		broken     bool
+		want       []string
+	}{
+		{"two of clubs leads", []string{"2C", "AS", "3H"}, nil, true, false, []string{"2C"}},
+		{"no hearts led before broken", []string{"4C", "AS", "3H"}, nil, false, false, []string{"4C", "AS"}},
+		{"hearts led once broken", []string{"4C", "3H"}, nil, false, true, []string{"4C", "3H"}},
+		{"only hearts left", []string{"3H", "9H"}, nil, false, false, []string{"3H", "9H"}},
+		{"follow suit", []string{"4C", "AS", "3H"}, []string{"2C"}, true, false, []string{"4C"}},
+		{"no points on the first trick", []string{"QS", "3H", "5D"}, []string{"2C"}, true, false, []string{"5D"}},
+		{"only points on the first trick", []string{"QS", "3H"}, []string{"2C"}, true, false, []string{"QS", "3H"}},
+		{"points discarded later", []string{"QS", "3H", "5D"}, []string{"4C"}, false, false, []string{"QS", "3H", "5D"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, 4, 1)
+			s.hands[1] = cards.MustParse(tt.hand...)
+			s.trick = nil
+			for _, card := range cards.MustParse(tt.trick...) {
+				s.trick = append(s.trick, play{seat: 0, card: card})
+			}
+			s.firstTrick = tt.firstTrick
+			s.heartsBroken = tt.broken
+			got := s.legalCards(1)
+			cards.Sort(got)
+			want := cards.MustParse(tt.want...)
+			cards.Sort(want)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("legal cards %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFinishHand(t *testing.T) {
+	tests := []struct {
+		name       string
+		taken      []int
+		scores     []int
+		wantScores []int
+		wantMoon   string
+		wantOver   bool
+	}{
+		{"points added", []int{3, 13, 10, 0}, []int{0, 0, 0, 0}, []int{3, 13, 10, 0}, "", false},
+		{"shooting the moon", []int{0, 26, 0, 0}, []int{10, 10, 10, 10}, []int{36, 10, 36, 36}, "b", false},
+		{"end score reached", []int{3, 13, 10, 0}, []int{40, 90, 20, 0}, []int{43, 103, 30, 0}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, 4, 1)
+			s.taken = tt.taken
+			s.scores = tt.scores
+			s.finishHand()
+			if fmt.Sprint(s.scores) != fmt.Sprint(tt.wantScores) {
+				t.Fatalf("scores %v, want %v", s.scores, tt.wantScores)
+			}
+			if s.lastRound.ShotTheMoon != tt.wantMoon {
+				t.Fatalf("shot the moon: %q, want %q", s.lastRound.ShotTheMoon, tt.wantMoon)
+			}
+			if (Game{}).IsTerminal(s) != tt.wantOver {
+				t.Fatalf("terminal = %v, want %v", !tt.wantOver, tt.wantOver)
+			}
+			if tt.wantOver {
+				if winners := (Game{}).Winners(s); fmt.Sprint(winners) != "[d]" {
+					t.Fatalf("winners = %v, want the lowest score", winners)
+				}
+			}
+		})
+	}
+}
+
+func TestPassValidation(t *testing.T) {
+	s := newTestState(t, 4, 1)
+	hand := s.hands[0]
+	var notHeld cards.Card
+	for _, card := range cards.NewDeck() {
+		if cards.Index(hand, card) < 0 {
+			notHeld = card
+			break
+		}
+	}
+	tests := []struct {
+		name  string
+		cards []string
+	}{
+		{"too few", []string{hand[0].Code(), hand[1].Code()}},
+		{"not held", []string{hand[0].Code(), hand[1].Code(), notHeld.Code()}},
+		{"twice", []string{hand[0].Code(), hand[0].Code(), hand[1].Code()}},
+	}
+	for _, tt := range tests {
+		if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("pass", passData{Cards: tt.cards})); !errors.Is(err, engine.ErrIllegalMove) {
+			t.Errorf("%s: %v, want an illegal move", tt.name, err)
+		}
+	}
+	if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("play", playData{Card: hand[0].Code()})); !errors.Is(err, engine.ErrIllegalMove) {
+		t.Errorf("play while passing: %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+// Package memory implements the matching-pairs memory game ("image_match")
+// for the game engine.
+package memory
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"norex/catalog"
+	"norex/engine"
+)
+
+const (
+	minPlayers          = 2
+	maxPlayers          = 10
+	defaultRevealMillis = 2000
+)
+
+// pairsByCapacity sizes the grid from the room capacity, picking pair
+// counts that lay out as near-square grids (4x4 for two players up to 7x8
+// for ten).
+var pairsByCapacity = map[int]int{2: 8, 3: 10, 4: 12, 5: 15, 6: 18, 7: 20, 8: 21, 9: 24, 10: 28}
+
+// gridFor returns the most square rows x columns layout holding n cards.
+func gridFor(n int) (rows, cols int) {
+	rows = int(math.Sqrt(float64(n)))
+	for n%rows != 0 {
+		rows--
+	}
+	return rows, n / rows
+}
+
+// state is the authoritative state of a memory game.
+type state struct {
+	players []string
+	turn    int
+
+	rows, cols int
+	faces      []int // face of every card, each face appears twice
+	matchedBy  []int // seat that claimed the card, -1 while in play
+	pairs      []int // pairs claimed per seat
+
+	revealed []int // indexes of the cards currently face up, at most two
+	// hidePending is set while two unmatched cards are shown to everyone
+	// before they are turned face down again
+	hidePending  bool
+	revealFor    time.Duration
+	remaining    int // pairs still on the table
+	lastMismatch []int
+}
+
+// Game is the memory rule set.
+type Game struct{}
+
+func init() {
+	catalog.Register(catalog.Game{
+		Key:         "image_match",
+		DisplayName: "Memory",
+		Icon:        "image_match.png",
+		MinPlayers:  minPlayers,
+		MaxPlayers:  maxPlayers,
+		VoiceChat:   true,
+		TextChat:    true,
+		Options: []catalog.Option{
+			{Key: "revealMillis", Kind: catalog.OptionInt, Default: defaultRevealMillis, Min: 500, Max: 10000},
+		},
+		New: func() engine.Game { return Game{} },
+	})
+}
+
+// NewState shuffles the grid. The "capacity" option (the room capacity)
+// sizes the grid and "revealMillis" sets how long two unmatched cards stay
+// face up (2000 by default).
+func (Game) NewState(setup engine.Setup) (engine.State, error) {
+	if len(setup.Players) < minPlayers || len(setup.Players) > maxPlayers {
+		return nil, engine.ErrPlayerCount
+	}
+
+	capacity := setup.Options.Int("capacity", len(setup.Players))
+	if capacity < len(setup.Players) {
+		capacity = len(setup.Players)
+	}
+	if capacity > maxPlayers {
+		capacity = maxPlayers
+	}
+	pairs := pairsByCapacity[capacity]
+
+	s := &state{
+		players:   append([]string(nil), setup.Players...),
+		pairs:     make([]int, len(setup.Players)),
+		remaining: pairs,
+		revealFor: time.Duration(setup.Options.Int("revealMillis", defaultRevealMillis)) * time.Millisecond,
+	}
+	if s.revealFor <= 0 {
+		s.revealFor = defaultRevealMillis * time.Millisecond
+	}
+	s.rows, s.cols = gridFor(2 * pairs)
+
+	for face := 1; face <= pairs; face++ {
+		s.faces = append(s.faces, face, face)
+	}
+	setup.Rand.Shuffle(len(s.faces), func(i, j int) {
+		s.faces[i], s.faces[j] = s.faces[j], s.faces[i]
+	})
+	s.matchedBy = make([]int, len(s.faces))
+	for i := range s.matchedBy {
+		s.matchedBy[i] = -1
+	}
+
+	return s, nil
+}
+
+func (s *state) seatOf(player string) int {
+	for i, p := range s.players {
+		if p == player {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *state) isRevealed(index int) bool {
+	for _, i := range s.revealed {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+type flipData struct {
+	Card int `json:"card"` // index in the grid, row by row
+}
+
+func (Game) LegalMoves(st engine.State, player string) []engine.Move {
+	s := st.(*state)
+	if s.remaining == 0 || s.hidePending || s.seatOf(player) != s.turn {
+		return nil
+	}
+
+	var moves []engine.Move
+	for i := range s.faces {
+		if s.matchedBy[i] < 0 && !s.isRevealed(i) {
+			moves = append(moves, engine.NewMove("flip", flipData{Card: i}))
+		}
+	}
+	return moves
+}
+
+func (Game) ApplyMove(st engine.State, player string, move engine.Move) (engine.State, error) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 {
+		return nil, engine.ErrNotPlayer
+	}
+	if s.remaining == 0 {
+		return nil, engine.ErrGameOver
+	}
+	if seat != s.turn {
+		return nil, engine.ErrNotYourTurn
+	}
+	if move.Action != "flip" {
+		return nil, fmt.Errorf("%w: unknown action %q", engine.ErrIllegalMove, move.Action)
+	}
+	if s.hidePending {
+		return nil, fmt.Errorf("%w: wait for the cards to turn back over", engine.ErrIllegalMove)
+	}
+
+	var data flipData
+	if err := move.Decode(&data); err != nil {
+		return nil, err
+	}
+	if data.Card < 0 || data.Card >= len(s.faces) {
+		return nil, fmt.Errorf("%w: there is no card %d", engine.ErrIllegalMove, data.Card)
+	}
+	if s.matchedBy[data.Card] >= 0 || s.isRevealed(data.Card) {
+		return nil, fmt.Errorf("%w: card %d is already face up", engine.ErrIllegalMove, data.Card)
+	}
+
+	s.revealed = append(s.revealed, data.Card)
+	s.lastMismatch = nil
+	if len(s.revealed) < 2 {
+		return s, nil
+	}
+
+	first, second := s.revealed[0], s.revealed[1]
+	if s.faces[first] == s.faces[second] {
+		// A match: the player keeps the pair and flips again
+		s.matchedBy[first], s.matchedBy[second] = seat, seat
+		s.pairs[seat]++
+		s.remaining--
+		s.revealed = nil
+		return s, nil
+	}
+
+	// No match: everyone gets to see both cards until the timer hides them
+	s.hidePending = true
+	return s, nil
+}
+
+// Timer keeps two unmatched cards face up for the reveal time.
+func (Game) Timer(st engine.State) (time.Duration, bool) {
+	s := st.(*state)
+	return s.revealFor, s.hidePending
+}
+
+// Timeout turns the unmatched cards face down and passes the turn.
+func (Game) Timeout(st engine.State) (engine.State, error) {
+	s := st.(*state)
+	if !s.hidePending {
+		return s, nil
+	}
+	s.lastMismatch = s.revealed
+	s.revealed = nil
+	s.hidePending = false
+	s.turn = (s.turn + 1) % len(s.players)
+	return s, nil
+}
+
+// AutoMove flips the first face-down card for a player who ran out of time.
+func (g Game) AutoMove(st engine.State, player string) (engine.Move, bool) {
+	moves := g.LegalMoves(st, player)
+	if len(moves) == 0 {
+		return engine.Move{}, false
+	}
+	return moves[0], true
+}
+
+func (Game) CurrentPlayer(st engine.State) string {
+	s := st.(*state)
+	if s.remaining == 0 {
+		return ""
+	}
+	return s.players[s.turn]
+}
+
+func (Game) IsTerminal(st engine.State) bool {
+	return st.(*state).remaining == 0
+}
+
+// Winners returns every player holding the most pairs.
+func (Game) Winners(st engine.State) []string {
+	s := st.(*state)
+	if s.remaining > 0 {
+		return nil
+	}
+	best := 0
+	for _, pairs := range s.pairs {
+		if pairs > best {
+			best = pairs
+		}
+	}
+	var winners []string
+	for i, pairs := range s.pairs {
+		if pairs == best {
+			winners = append(winners, s.players[i])
+		}
+	}
+	return winners
+}
+
+// Standings ranks the players by the pairs they hold once the game is over.
+func (Game) Standings(st engine.State) [][]string {
+	s := st.(*state)
+	return engine.RankByScore(s.players, s.pairs)
+}
+
+type card struct {
+	Face      int    `json:"face,omitempty"` // 0 while face down
+	MatchedBy string `json:"matchedBy,omitempty"`
+}
+
+type playerSummary struct {
+	ID    string `json:"id"`
+	Pairs int    `json:"pairs"`
+}
+
+type view struct {
+	Rows          int             `json:"rows"`
+	Cols          int             `json:"cols"`
+	Cards         []card          `json:"cards"`
+	Revealed      []int           `json:"revealed"`
+	HidePending   bool            `json:"hidePending"`
+	LastMismatch  []int           `json:"lastMismatch,omitempty"`
+	Players       []playerSummary `json:"players"`
+	CurrentPlayer string          `json:"currentPlayer,omitempty"`
+	Winners       []string        `json:"winners,omitempty"`
+}
+
+// PublicView shows faces only for revealed and matched cards. Every player
+// sees the same board, so PlayerView is the same view.
+func (g Game) PublicView(st engine.State) interface{} {
+	s := st.(*state)
+	v := view{
+		Rows:         s.rows,
+		Cols:         s.cols,
+		Cards:        make([]card, len(s.faces)),
+		Revealed:     append([]int{}, s.revealed...),
+		HidePending:  s.hidePending,
+		LastMismatch: s.lastMismatch,
+		Winners:      g.Winners(st),
+	}
+	for i, face := range s.faces {
+		if s.matchedBy[i] >= 0 {
+			v.Cards[i] = card{Face: face, MatchedBy: s.players[s.matchedBy[i]]}
+		} else if s.isRevealed(i) {
+			v.Cards[i] = card{Face: face}
+		}
+	}
+	for i, player := range s.players {
+		v.Players = append(v.Players, playerSummary{ID: player, Pairs: s.pairs[i]})
+	}
+	if s.remaining > 0 {
+		v.CurrentPlayer = s.players[s.turn]
+	}
+	return v
+}
+
+func (g Game) PlayerView(st engine.State, _ string) interface{} {
+	return g.PublicView(st)
+}
@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"norex/engine"
+)
+
+func newTestState(t *testing.T, players int, options engine.Options) *state {
+	t.Helper()
+	ids := []string{"a", "b", "c", "d"}[:players]
+	st, err := Game{}.NewState(engine.Setup{Players: ids, Options: options, Rand: rand.New(rand.NewSource(1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st.(*state)
+}
+
+// pairOf returns the two cards of face.
+func (s *state) pairOf(face int) (int, int) {
+	first := -1
+	for i, f := range s.faces {
+		if f != face {
+			continue
+		}
+		if first >= 0 {
+			return first, i
+		}
+		first = i
+	}
+	return -1, -1
+}
+
+func flip(t *testing.T, s *state, player string, index int) {
+	t.Helper()
+	if _, err := (Game{}).ApplyMove(s, player, engine.NewMove("flip", flipData{Card: index})); err != nil {
+		t.Fatalf("flip %d: %v", index, err)
+	}
+}
+
+func TestGrid(t *testing.T) {
+	tests := []struct {
+		players    int
+		capacity   int
+		rows, cols int
+	}{
+		{2, 0, 4, 4},
+		{3, 4, 4, 6},
+		{4, 0, 4, 6},
+		{2, 10, 7, 8},
+	}
+	for _, tt := range tests {
+		options := engine.Options{}
+		if tt.capacity > 0 {
+			options["capacity"] = tt.capacity
+		}
+		s := newTestState(t, tt.players, options)
+		if s.rows != tt.rows || s.cols != tt.cols || len(s.faces) != tt.rows*tt.cols {
+			t.Errorf("%d players, capacity %d: %dx%d with %d cards, want %dx%d", tt.players, tt.capacity, s.rows, s.cols, len(s.faces), tt.rows, tt.cols)
+		}
+	}
+}
+
+func TestMatchKeepsTurn(t *testing.T) {
+	s := newTestState(t, 2, engine.Options{})
+	first, second := s.pairOf(1)
+	flip(t, s, "a", first)
+	flip(t, s, "a", second)
+
+	if s.pairs[0] != 1 || s.turn != 0 || s.hidePending {
+		t.Fatalf("pairs %v, turn %d, hidePending %v; want a to keep the pair and the turn", s.pairs, s.turn, s.hidePending)
+	}
+	if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("flip", flipData{Card: first})); !errors.Is(err, engine.ErrIllegalMove) {
+		t.Fatalf("flipping a matched card: %v", err)
+	}
+}
+
+func TestMismatchPassesTurn(t *testing.T) {
+	s := newTestState(t, 2, engine.Options{"revealMillis": 500})
+	one, _ := s.pairOf(1)
+	two, _ := s.pairOf(2)
+	flip(t, s, "a", one)
+	flip(t, s, "a", two)
+
+	delay, pending := Game{}.Timer(s)
+	if !pending || delay != 500*time.Millisecond {
+		t.Fatalf("Timer = %v, %v; want 500ms pending", delay, pending)
+	}
+	if moves := (Game{}).LegalMoves(s, "a"); moves != nil {
+		t.Fatalf("%d moves while the cards are shown", len(moves))
+	}
+	if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("flip", flipData{Card: 0})); !errors.Is(err, engine.ErrIllegalMove) {
+		t.Fatalf("flip while the cards are shown: %v", err)
+	}
+
+	if _, err := (Game{}).Timeout(s); err != nil {
+		t.Fatal(err)
+	}
+	if s.turn != 1 || s.revealed != nil || len(s.lastMismatch) != 2 {
+		t.Fatalf("turn %d, revealed %v, lastMismatch %v; want b to play", s.turn, s.revealed, s.lastMismatch)
+	}
+}
+
+func TestWinners(t *testing.T) {
+	tests := []struct {
+		name  string
+		pairs map[string][]int // faces claimed by each player, in turn
+		want  []string
+	}{
+		{"most pairs", map[string][]int{"a": {1, 2, 3, 4, 5}, "b": {6, 7, 8}}, []string{"a"}},
+		{"tie", map[string][]int{"a": {1, 2, 3, 4}, "b": {5, 6, 7, 8}}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, 2, engine.Options{})
+			for _, player := range []string{"a", "b"} {
+				// Hand the turn over, as a miss would
+				s.turn = s.seatOf(player)
+				for _, face := range tt.pairs[player] {
+					first, second := s.pairOf(face)
+					flip(t, s, player, first)
+					flip(t, s, player, second)
+				}
+			}
+			if !(Game{}).IsTerminal(s) {
+				t.Fatalf("%d pairs left", s.remaining)
+			}
+			if got := (Game{}).Winners(s); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("winners = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,613 @@
+// Package spades implements four-player partnership Spades for the game
+// engine.
+package spades
+
+import (
+	"fmt"
+	"math/rand"
+
+	"norex/catalog"
+	"norex/engine"
+	"norex/games/cards"
+)
+
+const (
+	players            = 4
+	handSize           = 13
+	defaultTargetScore = 500
+
+	// A team may only bid blind nil when it trails by this many points
+	blindNilDeficit = 100
+	// Every bagLimit bags cost bagPenalty points
+	bagLimit   = 10
+	bagPenalty = 100
+)
+
+// Phases of a hand.
+const (
+	phaseBidding = "bidding"
+	phasePlaying = "playing"
+	phaseOver    = "over"
+)
+
+// noBid marks a player who has not bid yet. A bid of 0 is nil.
+const noBid = -1
+
+type play struct {
+	seat int
+	card cards.Card
+}
+
+// state is the authoritative state of a Spades game. Partners sit
+// opposite each other: seats 0 and 2 are team 0, seats 1 and 3 team 1.
+type state struct {
+	rng *rand.Rand
+
+	players []string
+	hands   [][]cards.Card
+	dealer  int
+	turn    int
+	phase   string
+
+	bids     []int  // tricks bid per seat, noBid until they bid
+	blind    []bool // bid blind nil
+	revealed []bool // looked at their hand; blind nil is only allowed before
+	taken    []int  // tricks taken this hand
+
+	trick        []play
+	lastTrick    *completedTrick
+	spadesBroken bool
+
+	scores      [2]int
+	bags        [2]int
+	targetScore int
+	blindNil    bool
+	round       int
+	lastRound   *roundResult
+	winner      int // winning team, -1 until the game is over
+}
+
+func team(seat int) int {
+	return seat % 2
+}
+
+// Game is the Spades rule set.
+type Game struct{}
+
+func init() {
+	catalog.Register(catalog.Game{
+		Key:         "spades",
+		DisplayName: "Spades",
+		Icon:        "spades.png",
+		MinPlayers:  players,
+		MaxPlayers:  players,
+		TextChat:    true,
+		Options: []catalog.Option{
+			{Key: "targetScore", Kind: catalog.OptionInt, Default: defaultTargetScore, Min: 100, Max: 1000},
+			{Key: "blindNil", Kind: catalog.OptionBool, Default: true},
+		},
+		New: func() engine.Game { return Game{} },
+	})
+}
+
+// NewState seats the players in the order of the room, the owner first,
+// so the owner partners the third player, and deals the first hand. The
+// "targetScore" option sets the score that ends the game (500 by default)
+// and "blindNil" allows blind nil bids (on by default).
+func (Game) NewState(setup engine.Setup) (engine.State, error) {
+	if len(setup.Players) != players {
+		return nil, engine.ErrPlayerCount
+	}
+
+	s := &state{
+		rng:         setup.Rand,
+		players:     append([]string(nil), setup.Players...),
+		dealer:      players - 1,
+		targetScore: setup.Options.Int("targetScore", defaultTargetScore),
+		blindNil:    setup.Options.Bool("blindNil", true),
+		winner:      -1,
+	}
+	if s.targetScore <= 0 {
+		s.targetScore = defaultTargetScore
+	}
+	s.deal()
+	return s, nil
+}
+
+// deal shuffles and deals a new hand. Bidding starts left of the dealer.
+func (s *state) deal() {
+	s.round++
+	deck := cards.NewDeck()
+	cards.Shuffle(deck, s.rng)
+	s.hands, _ = cards.Deal(deck, players, handSize)
+	for _, hand := range s.hands {
+		cards.Sort(hand)
+	}
+
+	s.bids = []int{noBid, noBid, noBid, noBid}
+	s.blind = make([]bool, players)
+	s.revealed = make([]bool, players)
+	s.taken = make([]int, players)
+	s.trick = nil
+	s.lastTrick = nil
+	s.spadesBroken = false
+	s.phase = phaseBidding
+	s.turn = s.next(s.dealer)
+}
+
+func (s *state) next(seat int) int {
+	return (seat + 1) % players
+}
+
+func (s *state) seatOf(player string) int {
+	for i, p := range s.players {
+		if p == player {
+			return i
+		}
+	}
+	return -1
+}
+
+// canBidBlindNil reports whether seat may still bid blind nil: before
+// looking at their hand, with their team far enough behind.
+func (s *state) canBidBlindNil(seat int) bool {
+	own := team(seat)
+	return s.blindNil && !s.revealed[seat] && s.scores[1-own]-s.scores[own] >= blindNilDeficit
+}
+
+// legalCards lists the cards seat may play to the current trick.
+func (s *state) legalCards(seat int) []cards.Card {
+	hand := s.hands[seat]
+	var legal []cards.Card
+	if len(s.trick) == 0 {
+		// Spades may not be led before they are broken, unless nothing else is left
+		onlySpades := !cards.HasSuit(hand, cards.Clubs) && !cards.HasSuit(hand, cards.Diamonds) && !cards.HasSuit(hand, cards.Hearts)
+		for _, card := range hand {
+			if card.Suit != cards.Spades || s.spadesBroken || onlySpades {
+				legal = append(legal, card)
+			}
+		}
+		return legal
+	}
+
+	led := s.trick[0].card.Suit
+	if !cards.HasSuit(hand, led) {
+		return append(legal, hand...)
+	}
+	for _, card := range hand {
+		if card.Suit == led {
+			legal = append(legal, card)
+		}
+	}
+	return legal
+}
+
+// trickWinner returns the seat that played the highest spade, or the
+// highest card of the suit led when no spade was played.
+func (s *state) trickWinner() int {
+	best := s.trick[0]
+	for _, p := range s.trick[1:] {
+		switch {
+		case p.card.Suit == best.card.Suit && p.card.Value() > best.card.Value():
+			best = p
+		case p.card.Suit == cards.Spades && best.card.Suit != cards.Spades:
+			best = p
+		}
+	}
+	return best.seat
+}
+
+type bidData struct {
+	Tricks *int `json:"tricks"` // 0 bids nil
+}
+
+type playData struct {
+	Card string `json:"card"`
+}
+
+func (Game) LegalMoves(st engine.State, player string) []engine.Move {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 || s.phase == phaseOver {
+		return nil
+	}
+
+	var moves []engine.Move
+	switch s.phase {
+	case phaseBidding:
+		if !s.revealed[seat] {
+			moves = append(moves, engine.NewMove("look", nil))
+		}
+		if seat != s.turn {
+			return moves
+		}
+		if s.canBidBlindNil(seat) {
+			moves = append(moves, engine.NewMove("blind_nil", nil))
+		}
+		for n := 0; n <= handSize; n++ {
+			tricks := n
+			moves = append(moves, engine.NewMove("bid", bidData{Tricks: &tricks}))
+		}
+	case phasePlaying:
+		if seat != s.turn {
+			return nil
+		}
+		for _, card := range s.legalCards(seat) {
+			moves = append(moves, engine.NewMove("play", playData{Card: card.Code()}))
+		}
+	}
+	return moves
+}
+
+// AllowsOutOfTurn lets every player look at their hand while others bid.
+func (Game) AllowsOutOfTurn(st engine.State, player string, move engine.Move) bool {
+	return move.Action == "look" && st.(*state).phase == phaseBidding
+}
+
+func (Game) ApplyMove(st engine.State, player string, move engine.Move) (engine.State, error) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 {
+		return nil, engine.ErrNotPlayer
+	}
+	if s.phase == phaseOver {
+		return nil, engine.ErrGameOver
+	}
+
+	if move.Action == "look" {
+		if s.phase != phaseBidding || s.revealed[seat] {
+			return nil, fmt.Errorf("%w: your hand is already face up", engine.ErrIllegalMove)
+		}
+		s.revealed[seat] = true
+		return s, nil
+	}
+	if seat != s.turn {
+		return nil, engine.ErrNotYourTurn
+	}
+
+	switch move.Action {
+	case "bid":
+		if s.phase != phaseBidding {
+			return nil, fmt.Errorf("%w: bidding is over", engine.ErrIllegalMove)
+		}
+		var data bidData
+		if err := move.Decode(&data); err != nil {
+			return nil, err
+		}
+		if data.Tricks == nil || *data.Tricks < 0 || *data.Tricks > handSize {
+			return nil, fmt.Errorf("%w: bid between 0 (nil) and %d tricks", engine.ErrIllegalMove, handSize)
+		}
+		s.bid(seat, *data.Tricks, false)
+		return s, nil
+
+	case "blind_nil":
+		if s.phase != phaseBidding {
+			return nil, fmt.Errorf("%w: bidding is over", engine.ErrIllegalMove)
+		}
+		if !s.canBidBlindNil(seat) {
+			return nil, fmt.Errorf("%w: blind nil needs an unseen hand and a team %d points behind", engine.ErrIllegalMove, blindNilDeficit)
+		}
+		s.bid(seat, 0, true)
+		return s, nil
+
+	case "play":
+		if s.phase != phasePlaying {
+			return nil, fmt.Errorf("%w: wait for the bidding to end", engine.ErrIllegalMove)
+		}
+		var data playData
+		if err := move.Decode(&data); err != nil {
+			return nil, err
+		}
+		card, ok := cards.Parse(data.Card)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown card %q", engine.ErrIllegalMove, data.Card)
+		}
+		index := cards.Index(s.hands[seat], card)
+		if index < 0 {
+			return nil, fmt.Errorf("%w: you do not hold %s", engine.ErrIllegalMove, card)
+		}
+		if cards.Index(s.legalCards(seat), card) < 0 {
+			if len(s.trick) == 0 {
+				return nil, fmt.Errorf("%w: spades are not broken yet", engine.ErrIllegalMove)
+			}
+			return nil, fmt.Errorf("%w: you must follow %s", engine.ErrIllegalMove, s.trick[0].card.Suit)
+		}
+		s.play(seat, index)
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown action %q", engine.ErrIllegalMove, move.Action)
+}
+
+// bid records the bid of seat. Once everyone has bid, the player left of
+// the dealer leads the first trick.
+func (s *state) bid(seat, tricks int, blind bool) {
+	s.bids[seat] = tricks
+	s.blind[seat] = blind
+	s.revealed[seat] = true
+	s.turn = s.next(seat)
+	if s.turn == s.next(s.dealer) {
+		s.phase = phasePlaying
+	}
+}
+
+// play puts the card at index of seat's hand on the trick and collects
+// the trick once everyone has played to it.
+func (s *state) play(seat, index int) {
+	card := s.hands[seat][index]
+	s.hands[seat] = cards.Remove(s.hands[seat], index)
+	if card.Suit == cards.Spades {
+		s.spadesBroken = true
+	}
+	s.trick = append(s.trick, play{seat: seat, card: card})
+	if len(s.trick) < players {
+		s.turn = s.next(seat)
+		return
+	}
+
+	winner := s.trickWinner()
+	s.taken[winner]++
+	s.lastTrick = &completedTrick{Winner: s.players[winner]}
+	for _, p := range s.trick {
+		s.lastTrick.Cards = append(s.lastTrick.Cards, trickCard{Player: s.players[p.seat], Card: p.card})
+	}
+	s.trick = nil
+	s.turn = winner
+	if len(s.hands[winner]) == 0 {
+		s.finishHand()
+	}
+}
+
+// finishHand scores the hand for both teams and either ends the game or
+// deals the next hand with the deal passing to the left.
+//
+// A team that takes at least the tricks its players bid scores 10 points
+// per trick bid and 1 per extra trick, a bag; otherwise it loses 10 points
+// per trick bid. Nil scores 100 (blind nil 200) when the bidder takes no
+// trick and costs as much otherwise. Tricks taken by a nil bidder do not
+// count towards their partner's bid but count as bags.
+func (s *state) finishHand() {
+	result := &roundResult{Round: s.round}
+	for t := 0; t < 2; t++ {
+		var bid, made, points, bags int
+		for seat := t; seat < players; seat += 2 {
+			if s.bids[seat] == 0 {
+				value := 100
+				if s.blind[seat] {
+					value = 200
+				}
+				if s.taken[seat] == 0 {
+					points += value
+				} else {
+					points -= value
+				}
+				bags += s.taken[seat]
+				continue
+			}
+			bid += s.bids[seat]
+			made += s.taken[seat]
+		}
+		if bid > 0 {
+			if made >= bid {
+				points += 10 * bid
+				bags += made - bid
+			} else {
+				points -= 10 * bid
+			}
+		}
+		points += bags
+
+		s.bags[t] += bags
+		for s.bags[t] >= bagLimit {
+			s.bags[t] -= bagLimit
+			points -= bagPenalty
+		}
+		s.scores[t] += points
+		result.Teams[t] = teamRound{Bid: bid, Tricks: s.taken[t] + s.taken[t+2], Points: points, Bags: bags}
+	}
+	s.lastRound = result
+
+	// The game ends once a team reaches the target score ahead of the other
+	if max(s.scores[0], s.scores[1]) >= s.targetScore && s.scores[0] != s.scores[1] {
+		s.winner = 0
+		if s.scores[1] > s.scores[0] {
+			s.winner = 1
+		}
+		s.phase = phaseOver
+		return
+	}
+
+	s.dealer = s.next(s.dealer)
+	s.deal()
+}
+
+// AutoMove is the move made for a player who ran out of time: a bid of
+// their sure tricks, at least one, or their lowest legal card.
+func (Game) AutoMove(st engine.State, player string) (engine.Move, bool) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat != s.turn || s.phase == phaseOver {
+		return engine.Move{}, false
+	}
+
+	if s.phase == phaseBidding {
+		tricks := 0
+		for _, card := range s.hands[seat] {
+			if card.Rank == "A" || (card.Suit == cards.Spades && card.Value() >= 12) {
+				tricks++
+			}
+		}
+		tricks = max(tricks, 1)
+		return engine.NewMove("bid", bidData{Tricks: &tricks}), true
+	}
+
+	legal := s.legalCards(seat)
+	lowest := legal[0]
+	for _, card := range legal[1:] {
+		if cost(card) < cost(lowest) {
+			lowest = card
+		}
+	}
+	return engine.NewMove("play", playData{Card: lowest.Code()}), true
+}
+
+// cost ranks cards by how little it hurts to throw them away.
+func cost(card cards.Card) int {
+	if card.Suit == cards.Spades {
+		return 100 + card.Value()
+	}
+	return card.Value()
+}
+
+// Forfeit ends the game when a player runs out of time: the other team wins.
+func (Game) Forfeit(st engine.State, player string) (engine.State, error) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 {
+		return nil, engine.ErrNotPlayer
+	}
+	s.winner = 1 - team(seat)
+	s.phase = phaseOver
+	return s, nil
+}
+
+func (Game) CurrentPlayer(st engine.State) string {
+	s := st.(*state)
+	if s.phase == phaseOver {
+		return ""
+	}
+	return s.players[s.turn]
+}
+
+func (Game) IsTerminal(st engine.State) bool {
+	return st.(*state).phase == phaseOver
+}
+
+// Winners returns both players of the winning team.
+func (Game) Winners(st engine.State) []string {
+	s := st.(*state)
+	if s.winner < 0 {
+		return nil
+	}
+	return []string{s.players[s.winner], s.players[s.winner+2]}
+}
+
+type trickCard struct {
+	Player string     `json:"player"`
+	Card   cards.Card `json:"card"`
+}
+
+type completedTrick struct {
+	Cards  []trickCard `json:"cards"`
+	Winner string      `json:"winner"`
+}
+
+type teamRound struct {
+	Bid    int `json:"bid"`
+	Tricks int `json:"tricks"`
+	Points int `json:"points"`
+	Bags   int `json:"bags"`
+}
+
+type roundResult struct {
+	Round int          `json:"round"`
+	Teams [2]teamRound `json:"teams"`
+}
+
+type playerSummary struct {
+	ID       string `json:"id"`
+	Team     int    `json:"team"`
+	Cards    int    `json:"cards"`
+	Bid      *int   `json:"bid,omitempty"` // 0 is nil
+	BlindNil bool   `json:"blindNil,omitempty"`
+	Tricks   int    `json:"tricks"`
+}
+
+type teamSummary struct {
+	Players []string `json:"players"`
+	Score   int      `json:"score"`
+	Bags    int      `json:"bags"`
+}
+
+type view struct {
+	Players       []playerSummary `json:"players"`
+	Teams         []teamSummary   `json:"teams"`
+	Phase         string          `json:"phase"`
+	Dealer        string          `json:"dealer"`
+	CurrentPlayer string          `json:"currentPlayer,omitempty"`
+	Trick         []trickCard     `json:"trick"`
+	LastTrick     *completedTrick `json:"lastTrick,omitempty"`
+	SpadesBroken  bool            `json:"spadesBroken"`
+	Round         int             `json:"round"`
+	TargetScore   int             `json:"targetScore"`
+	LastRound     *roundResult    `json:"lastRound,omitempty"`
+	Winners       []string        `json:"winners,omitempty"`
+
+	// Only in a player's own view; the hand stays face down until they
+	// look at it or bid
+	Hand        []cards.Card `json:"hand,omitempty"`
+	HandHidden  bool         `json:"handHidden,omitempty"`
+	CanBlindNil bool         `json:"canBidBlindNil,omitempty"`
+}
+
+func (s *state) publicView() view {
+	v := view{
+		Phase:        s.phase,
+		Dealer:       s.players[s.dealer],
+		Trick:        []trickCard{},
+		LastTrick:    s.lastTrick,
+		SpadesBroken: s.spadesBroken,
+		Round:        s.round,
+		TargetScore:  s.targetScore,
+		LastRound:    s.lastRound,
+		Winners:      Game{}.Winners(s),
+	}
+	for i, player := range s.players {
+		summary := playerSummary{
+			ID:       player,
+			Team:     team(i),
+			Cards:    len(s.hands[i]),
+			BlindNil: s.blind[i],
+			Tricks:   s.taken[i],
+		}
+		if s.bids[i] != noBid {
+			bid := s.bids[i]
+			summary.Bid = &bid
+		}
+		v.Players = append(v.Players, summary)
+	}
+	for t := 0; t < 2; t++ {
+		v.Teams = append(v.Teams, teamSummary{
+			Players: []string{s.players[t], s.players[t+2]},
+			Score:   s.scores[t],
+			Bags:    s.bags[t],
+		})
+	}
+	for _, p := range s.trick {
+		v.Trick = append(v.Trick, trickCard{Player: s.players[p.seat], Card: p.card})
+	}
+	if s.phase != phaseOver {
+		v.CurrentPlayer = s.players[s.turn]
+	}
+	return v
+}
+
+func (Game) PublicView(st engine.State) interface{} {
+	return st.(*state).publicView()
+}
+
+func (Game) PlayerView(st engine.State, player string) interface{} {
+	s := st.(*state)
+	v := s.publicView()
+	seat := s.seatOf(player)
+	if seat < 0 {
+		return v
+	}
+	if s.revealed[seat] || s.phase != phaseBidding {
+		v.Hand = append([]cards.Card{}, s.hands[seat]...)
+	} else {
+		v.HandHidden = true
+	}
+	v.CanBlindNil = s.phase == phaseBidding && seat == s.turn && s.canBidBlindNil(seat)
+	return v
+}
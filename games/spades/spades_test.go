@@ -0,0 +1,176 @@
+package spades
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"norex/engine"
+	"norex/games/cards"
+)
+
+func newTestState(t *testing.T, options engine.Options) *state {
+	t.Helper()
+	st, err := Game{}.NewState(engine.Setup{Players: []string{"a", "b", "c", "d"}, Options: options, Rand: rand.New(rand.NewSource(1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st.(*state)
+}
+
+func TestScoring(t *testing.T) {
+	tests := []struct {
+		name       string
+		bids       [2]int // seats 0 and 2, team 0
+		taken      [2]int
+		blind      bool // seat 0 bid blind nil
+		bags       int  // team 0 bags before the hand
+		wantPoints int
+		wantBags   int
+	}{
+		{"made exactly", [2]int{4, 3}, [2]int{4, 3}, false, 0, 70, 0},
+		{"overtricks", [2]int{3, 3}, [2]int{5, 3}, false, 0, 62, 2},
+		{"set", [2]int{5, 4}, [2]int{4, 3}, false, 0, -90, 0},
+		{"nil made", [2]int{0, 4}, [2]int{0, 4}, false, 0, 140, 0},
+		{"nil failed", [2]int{0, 4}, [2]int{2, 4}, false, 0, -58, 2},
+		{"blind nil made", [2]int{0, 4}, [2]int{0, 5}, true, 0, 241, 1},
+		{"bag penalty", [2]int{3, 3}, [2]int{5, 4}, false, 7, -37, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, engine.Options{})
+			s.bids = []int{tt.bids[0], 1, tt.bids[1], 1}
+			s.taken = []int{tt.taken[0], 13 - tt.taken[0] - tt.taken[1], tt.taken[1], 0}
+			s.blind[0] = tt.blind
+			s.bags[0] = tt.bags
+			s.finishHand()
+
+			if s.scores[0] != tt.wantPoints || s.lastRound.Teams[0].Points != tt.wantPoints {
+				t.Fatalf("team 0 scored %d, want %d", s.scores[0], tt.wantPoints)
+			}
+			if s.bags[0] != tt.wantBags {
+				t.Fatalf("team 0 has %d bags, want %d", s.bags[0], tt.wantBags)
+			}
+		})
+	}
+}
+
+func TestGameEnd(t *testing.T) {
+	tests := []struct {
+		name       string
+		scores     [2]int
+		wantWinner int
+	}{
+		{"below target", [2]int{300, 200}, -1},
+		{"target reached", [2]int{480, 200}, 0},
+		{"tied above target", [2]int{530, 540}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, engine.Options{})
+			s.scores = tt.scores
+			// Team 0 makes its bid of 7 and team 1 its bid of 6
+			s.bids = []int{4, 3, 3, 3}
+			s.taken = []int{4, 3, 3, 3}
+			s.finishHand()
+			if s.winner != tt.wantWinner {
+				t.Fatalf("winner = %d, want %d with scores %v", s.winner, tt.wantWinner, s.scores)
+			}
+			if (s.phase == phaseOver) != (tt.wantWinner >= 0) {
+				t.Fatalf("phase = %s", s.phase)
+			}
+		})
+	}
+}
+
+func TestTrickWinner(t *testing.T) {
+	tests := []struct {
+		name  string
+		trick []string
+		want  int
+	}{
+		{"highest of the suit led", []string{"5H", "KH", "2H", "9H"}, 1},
+		{"off suit does not win", []string{"5H", "AC", "2H", "AD"}, 0},
+		{"spade trumps", []string{"AH", "KH", "2S", "QH"}, 2},
+		{"highest spade", []string{"AH", "3S", "2S", "JS"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, engine.Options{})
+			s.trick = nil
+			for seat, card := range cards.MustParse(tt.trick...) {
+				s.trick = append(s.trick, play{seat: seat, card: card})
+			}
+			if got := s.trickWinner(); got != tt.want {
+				t.Fatalf("winner = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegalCards(t *testing.T) {
+	tests := []struct {
+		name   string
+		hand   []string
+		led    string
+		broken bool
+		want   int
+	}{
+		{"spades not led before broken", []string{"2C", "5S", "KS"}, "", false, 1},
+		{"spades led once broken", []string{"2C", "5S", "KS"}, "", true, 3},
+		{"only spades left", []string{"5S", "KS"}, "", false, 2},
+		{"follow suit", []string{"2C", "3C", "5S"}, "AC", false, 2},
+		{"void in the suit led", []string{"2D", "5S"}, "AC", false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, engine.Options{})
+			s.hands[1] = cards.MustParse(tt.hand...)
+			s.spadesBroken = tt.broken
+			s.trick = nil
+			if tt.led != "" {
+				s.trick = []play{{seat: 0, card: cards.MustParse(tt.led)[0]}}
+			}
+			if got := len(s.legalCards(1)); got != tt.want {
+				t.Fatalf("%d legal cards, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlindNil(t *testing.T) {
+	tests := []struct {
+		name    string
+		option  bool
+		deficit int
+		looked  bool
+		want    bool
+	}{
+		{"far behind", true, 100, false, true},
+		{"not far enough behind", true, 90, false, false},
+		{"looked at the hand", true, 100, true, false},
+		{"turned off", false, 100, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, engine.Options{"blindNil": tt.option})
+			seat := s.turn
+			s.scores[1-team(seat)] = tt.deficit
+			if tt.looked {
+				if _, err := (Game{}).ApplyMove(s, s.players[seat], engine.NewMove("look", nil)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := Game{}.ApplyMove(s, s.players[seat], engine.NewMove("blind_nil", nil))
+			if tt.want && err != nil {
+				t.Fatalf("blind_nil: %v", err)
+			}
+			if !tt.want && !errors.Is(err, engine.ErrIllegalMove) {
+				t.Fatalf("blind_nil: %v, want an illegal move", err)
+			}
+			if tt.want && (!s.blind[seat] || s.bids[seat] != 0) {
+				t.Fatalf("bid %d, blind %v; want a blind nil", s.bids[seat], s.blind[seat])
+			}
+		})
+	}
+}
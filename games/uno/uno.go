@@ -0,0 +1,604 @@
+// Package uno implements the rules of Uno for the game engine.
+package uno
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"norex/catalog"
+	"norex/engine"
+)
+
+const (
+	handSize           = 7
+	defaultTargetScore = 500
+	minPlayers         = 2
+	maxPlayers         = 10
+)
+
+var colors = []string{"red", "yellow", "green", "blue"}
+
+// Card values besides the numbers "0" to "9".
+const (
+	skip      = "skip"
+	reverse   = "reverse"
+	drawTwo   = "draw2"
+	wild      = "wild"
+	wildDraw4 = "wild-draw4"
+)
+
+// Card is an Uno card. Wild cards have no color.
+type Card struct {
+	Color string `json:"color,omitempty"`
+	Value string `json:"value"`
+}
+
+// Code identifies the card in moves, e.g. "red-7", "blue-skip" or "wild".
+func (c Card) Code() string {
+	if c.Color == "" {
+		return c.Value
+	}
+	return c.Color + "-" + c.Value
+}
+
+func (c Card) isWild() bool {
+	return c.Value == wild || c.Value == wildDraw4
+}
+
+// points is what the card is worth to the winner of a hand.
+func (c Card) points() int {
+	switch c.Value {
+	case skip, reverse, drawTwo:
+		return 20
+	case wild, wildDraw4:
+		return 50
+	}
+	n, _ := strconv.Atoi(c.Value)
+	return n
+}
+
+// parseCard reads a card code produced by Code.
+func parseCard(code string) (Card, bool) {
+	if code == wild || code == wildDraw4 {
+		return Card{Value: code}, true
+	}
+	color, value, ok := strings.Cut(code, "-")
+	if !ok || !validColor(color) {
+		return Card{}, false
+	}
+	switch value {
+	case skip, reverse, drawTwo:
+		return Card{Color: color, Value: value}, true
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 && n <= 9 && len(value) == 1 {
+		return Card{Color: color, Value: value}, true
+	}
+	return Card{}, false
+}
+
+func validColor(color string) bool {
+	for _, c := range colors {
+		if c == color {
+			return true
+		}
+	}
+	return false
+}
+
+// newDeck returns the 108 card Uno deck: per color one 0, two of each of
+// 1-9, Skip, Reverse and Draw Two, plus four Wild and four Wild Draw Four.
+func newDeck() []Card {
+	deck := make([]Card, 0, 108)
+	for _, color := range colors {
+		deck = append(deck, Card{Color: color, Value: "0"})
+		for i := 0; i < 2; i++ {
+			for n := 1; n <= 9; n++ {
+				deck = append(deck, Card{Color: color, Value: strconv.Itoa(n)})
+			}
+			deck = append(deck, Card{Color: color, Value: skip}, Card{Color: color, Value: reverse}, Card{Color: color, Value: drawTwo})
+		}
+	}
+	for i := 0; i < 4; i++ {
+		deck = append(deck, Card{Value: wild}, Card{Value: wildDraw4})
+	}
+	return deck
+}
+
+// state is the authoritative state of an Uno game.
+type state struct {
+	rng *rand.Rand
+
+	players     []string
+	hands       [][]Card
+	drawPile    []Card
+	discard     []Card
+	activeColor string // color to match; "" lets the next card be anything
+	direction   int    // +1 clockwise, -1 counter-clockwise
+	turn        int    // index into players
+	dealer      int
+
+	// drawn is the card the current player just drew and may still play
+	drawn *Card
+	// unoVulnerable is the player who went down to one card without calling
+	// Uno; the next player may catch them before doing anything else
+	unoVulnerable int
+
+	scores      []int
+	targetScore int
+	round       int
+	lastRound   *roundResult
+	winner      int // -1 until someone reaches the target score
+}
+
+type roundResult struct {
+	Round  int    `json:"round"`
+	Winner string `json:"winner"`
+	Points int    `json:"points"`
+}
+
+// Game is the Uno rule set.
+type Game struct{}
+
+func init() {
+	catalog.Register(catalog.Game{
+		Key:         "uno",
+		DisplayName: "Uno",
+		Icon:        "uno.png",
+		MinPlayers:  minPlayers,
+		MaxPlayers:  maxPlayers,
+		VoiceChat:   true,
+		TextChat:    true,
+		Options: []catalog.Option{
+			{Key: "targetScore", Kind: catalog.OptionInt, Default: defaultTargetScore, Min: 50, Max: 2000},
+		},
+		New: func() engine.Game { return Game{} },
+	})
+}
+
+// NewState deals the first hand. The "targetScore" option sets the score
+// that ends the game (500 by default).
+func (Game) NewState(setup engine.Setup) (engine.State, error) {
+	if len(setup.Players) < minPlayers || len(setup.Players) > maxPlayers {
+		return nil, engine.ErrPlayerCount
+	}
+
+	s := &state{
+		rng:           setup.Rand,
+		players:       append([]string(nil), setup.Players...),
+		scores:        make([]int, len(setup.Players)),
+		targetScore:   setup.Options.Int("targetScore", defaultTargetScore),
+		dealer:        len(setup.Players) - 1,
+		unoVulnerable: -1,
+		winner:        -1,
+	}
+	if s.targetScore <= 0 {
+		s.targetScore = defaultTargetScore
+	}
+	s.deal()
+	return s, nil
+}
+
+// deal shuffles a fresh deck, deals every player a hand and turns up the
+// first discard, applying its effect to the player left of the dealer.
+func (s *state) deal() {
+	s.round++
+	s.drawPile = newDeck()
+	s.rng.Shuffle(len(s.drawPile), func(i, j int) {
+		s.drawPile[i], s.drawPile[j] = s.drawPile[j], s.drawPile[i]
+	})
+
+	s.hands = make([][]Card, len(s.players))
+	for i := 0; i < handSize; i++ {
+		for p := range s.players {
+			s.hands[p] = append(s.hands[p], s.drawOne())
+		}
+	}
+
+	// A Wild Draw Four may not start the discard pile
+	for {
+		top := s.drawOne()
+		if top.Value != wildDraw4 {
+			s.discard = []Card{top}
+			break
+		}
+		s.drawPile = append(s.drawPile, top)
+		s.rng.Shuffle(len(s.drawPile), func(i, j int) {
+			s.drawPile[i], s.drawPile[j] = s.drawPile[j], s.drawPile[i]
+		})
+	}
+
+	s.direction = 1
+	s.drawn = nil
+	s.unoVulnerable = -1
+	s.turn = s.next(s.dealer)
+
+	top := s.discard[0]
+	s.activeColor = top.Color
+	switch top.Value {
+	case skip:
+		s.turn = s.next(s.turn)
+	case reverse:
+		s.direction = -1
+		if len(s.players) == 2 {
+			s.turn = s.next(s.turn)
+		} else {
+			s.turn = s.dealer
+		}
+	case drawTwo:
+		s.give(s.turn, 2)
+		s.turn = s.next(s.turn)
+	}
+}
+
+// next returns the seat after seat in the current direction.
+func (s *state) next(seat int) int {
+	n := len(s.players)
+	return ((seat+s.direction)%n + n) % n
+}
+
+// drawOne takes the top card of the draw pile, reshuffling the discard
+// pile (except its top card) into it when it runs out.
+func (s *state) drawOne() Card {
+	if len(s.drawPile) == 0 {
+		if len(s.discard) <= 1 {
+			// Every card is in someone's hand; nothing left to draw
+			return Card{}
+		}
+		top := s.discard[len(s.discard)-1]
+		s.drawPile = append(s.drawPile, s.discard[:len(s.discard)-1]...)
+		s.discard = []Card{top}
+		s.rng.Shuffle(len(s.drawPile), func(i, j int) {
+			s.drawPile[i], s.drawPile[j] = s.drawPile[j], s.drawPile[i]
+		})
+	}
+	card := s.drawPile[len(s.drawPile)-1]
+	s.drawPile = s.drawPile[:len(s.drawPile)-1]
+	return card
+}
+
+// give draws n cards into a player's hand.
+func (s *state) give(seat, n int) {
+	for i := 0; i < n; i++ {
+		card := s.drawOne()
+		if card.Value == "" {
+			return
+		}
+		s.hands[seat] = append(s.hands[seat], card)
+	}
+}
+
+func (s *state) top() Card {
+	return s.discard[len(s.discard)-1]
+}
+
+func (s *state) seatOf(player string) int {
+	for i, p := range s.players {
+		if p == player {
+			return i
+		}
+	}
+	return -1
+}
+
+// playable reports whether card may be played on the current discard.
+func (s *state) playable(seat int, card Card) bool {
+	if card.Value == wildDraw4 {
+		// Only when the player holds nothing of the active color
+		for _, held := range s.hands[seat] {
+			if held.Color != "" && held.Color == s.activeColor {
+				return false
+			}
+		}
+		return true
+	}
+	if card.Value == wild || s.activeColor == "" {
+		return true
+	}
+	return card.Color == s.activeColor || card.Value == s.top().Value
+}
+
+func handIndex(hand []Card, card Card) int {
+	for i, held := range hand {
+		if held == card {
+			return i
+		}
+	}
+	return -1
+}
+
+type playData struct {
+	Card  string `json:"card"`
+	Color string `json:"color,omitempty"` // declared color for wild cards
+	Uno   bool   `json:"uno,omitempty"`   // calls "Uno" with the second to last card
+}
+
+func (Game) LegalMoves(st engine.State, player string) []engine.Move {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat != s.turn || s.winner >= 0 {
+		return nil
+	}
+
+	var moves []engine.Move
+	if s.unoVulnerable >= 0 && s.unoVulnerable != seat {
+		moves = append(moves, engine.NewMove("catch_uno", nil))
+	}
+
+	candidates := s.hands[seat]
+	if s.drawn != nil {
+		candidates = []Card{*s.drawn}
+	}
+	seen := make(map[Card]bool)
+	for _, card := range candidates {
+		if seen[card] || !s.playable(seat, card) {
+			continue
+		}
+		seen[card] = true
+		callUno := len(s.hands[seat]) == 2
+		if card.isWild() {
+			for _, color := range colors {
+				moves = append(moves, engine.NewMove("play", playData{Card: card.Code(), Color: color, Uno: callUno}))
+			}
+		} else {
+			moves = append(moves, engine.NewMove("play", playData{Card: card.Code(), Uno: callUno}))
+		}
+	}
+
+	if s.drawn == nil {
+		moves = append(moves, engine.NewMove("draw", nil))
+	} else {
+		moves = append(moves, engine.NewMove("pass", nil))
+	}
+	return moves
+}
+
+func (Game) ApplyMove(st engine.State, player string, move engine.Move) (engine.State, error) {
+	s := st.(*state)
+	seat := s.seatOf(player)
+	if seat < 0 {
+		return nil, engine.ErrNotPlayer
+	}
+	if s.winner >= 0 {
+		return nil, engine.ErrGameOver
+	}
+	if seat != s.turn {
+		return nil, engine.ErrNotYourTurn
+	}
+
+	switch move.Action {
+	case "catch_uno":
+		if s.unoVulnerable < 0 || s.unoVulnerable == seat {
+			return nil, fmt.Errorf("%w: nobody can be caught", engine.ErrIllegalMove)
+		}
+		// Forgetting to call Uno costs two cards
+		s.give(s.unoVulnerable, 2)
+		s.unoVulnerable = -1
+		return s, nil
+
+	case "draw":
+		if s.drawn != nil {
+			return nil, fmt.Errorf("%w: you already drew this turn", engine.ErrIllegalMove)
+		}
+		s.unoVulnerable = -1
+		card := s.drawOne()
+		if card.Value == "" {
+			// Nothing left to draw anywhere: the turn passes
+			s.endTurn(false)
+			return s, nil
+		}
+		s.hands[seat] = append(s.hands[seat], card)
+		if s.playable(seat, card) {
+			s.drawn = &card
+		} else {
+			s.endTurn(false)
+		}
+		return s, nil
+
+	case "pass":
+		if s.drawn == nil {
+			return nil, fmt.Errorf("%w: draw a card before passing", engine.ErrIllegalMove)
+		}
+		s.endTurn(false)
+		return s, nil
+
+	case "play":
+		var data playData
+		if err := move.Decode(&data); err != nil {
+			return nil, err
+		}
+		card, ok := parseCard(data.Card)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown card %q", engine.ErrIllegalMove, data.Card)
+		}
+		index := handIndex(s.hands[seat], card)
+		if index < 0 {
+			return nil, fmt.Errorf("%w: you do not hold %s", engine.ErrIllegalMove, data.Card)
+		}
+		if s.drawn != nil && *s.drawn != card {
+			return nil, fmt.Errorf("%w: only the card you drew can be played", engine.ErrIllegalMove)
+		}
+		if !s.playable(seat, card) {
+			return nil, fmt.Errorf("%w: %s does not match the discard pile", engine.ErrIllegalMove, data.Card)
+		}
+		if card.isWild() && !validColor(data.Color) {
+			return nil, fmt.Errorf("%w: choose a color for the wild card", engine.ErrIllegalMove)
+		}
+
+		s.unoVulnerable = -1
+		s.hands[seat] = append(s.hands[seat][:index], s.hands[seat][index+1:]...)
+		s.discard = append(s.discard, card)
+		s.drawn = nil
+		if card.isWild() {
+			s.activeColor = data.Color
+		} else {
+			s.activeColor = card.Color
+		}
+		if len(s.hands[seat]) == 1 && !data.Uno {
+			s.unoVulnerable = seat
+		}
+
+		skipNext := false
+		switch card.Value {
+		case skip:
+			skipNext = true
+		case reverse:
+			s.direction = -s.direction
+			// With two players Reverse acts like Skip
+			skipNext = len(s.players) == 2
+		case drawTwo:
+			s.give(s.next(seat), 2)
+			skipNext = true
+		case wildDraw4:
+			s.give(s.next(seat), 4)
+			skipNext = true
+		}
+
+		if len(s.hands[seat]) == 0 {
+			s.finishRound(seat)
+			return s, nil
+		}
+		s.endTurn(skipNext)
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown action %q", engine.ErrIllegalMove, move.Action)
+}
+
+// endTurn moves play to the next player, jumping over one player if skip is set.
+func (s *state) endTurn(skip bool) {
+	s.drawn = nil
+	s.turn = s.next(s.turn)
+	if skip {
+		s.turn = s.next(s.turn)
+	}
+}
+
+// finishRound scores the hand for its winner and either ends the game or
+// deals the next hand with the deal passing to the left.
+func (s *state) finishRound(seat int) {
+	points := 0
+	for _, hand := range s.hands {
+		for _, card := range hand {
+			points += card.points()
+		}
+	}
+	s.scores[seat] += points
+	s.lastRound = &roundResult{Round: s.round, Winner: s.players[seat], Points: points}
+
+	if s.scores[seat] >= s.targetScore {
+		s.winner = seat
+		s.unoVulnerable = -1
+		s.drawn = nil
+		return
+	}
+
+	s.dealer = (s.dealer + 1) % len(s.players)
+	s.deal()
+}
+
+// AutoMove is the move made for a player who ran out of time: they draw a
+// card, and keep the turn moving by passing if they already drew.
+func (Game) AutoMove(st engine.State, player string) (engine.Move, bool) {
+	s := st.(*state)
+	if s.seatOf(player) != s.turn || s.winner >= 0 {
+		return engine.Move{}, false
+	}
+	if s.drawn != nil {
+		return engine.NewMove("pass", nil), true
+	}
+	return engine.NewMove("draw", nil), true
+}
+
+func (Game) CurrentPlayer(st engine.State) string {
+	s := st.(*state)
+	if s.winner >= 0 {
+		return ""
+	}
+	return s.players[s.turn]
+}
+
+func (Game) IsTerminal(st engine.State) bool {
+	return st.(*state).winner >= 0
+}
+
+func (Game) Winners(st engine.State) []string {
+	s := st.(*state)
+	if s.winner < 0 {
+		return nil
+	}
+	return []string{s.players[s.winner]}
+}
+
+// Standings ranks the players by their score once the game is over.
+func (Game) Standings(st engine.State) [][]string {
+	s := st.(*state)
+	return engine.RankByScore(s.players, s.scores)
+}
+
+type playerSummary struct {
+	ID       string `json:"id"`
+	Cards    int    `json:"cards"`
+	Score    int    `json:"score"`
+	CanCatch bool   `json:"canBeCaught,omitempty"`
+}
+
+type view struct {
+	Players       []playerSummary `json:"players"`
+	TopCard       Card            `json:"topCard"`
+	ActiveColor   string          `json:"activeColor"`
+	Direction     int             `json:"direction"`
+	CurrentPlayer string          `json:"currentPlayer,omitempty"`
+	DrawPile      int             `json:"drawPile"`
+	Round         int             `json:"round"`
+	TargetScore   int             `json:"targetScore"`
+	LastRound     *roundResult    `json:"lastRound,omitempty"`
+	Winner        string          `json:"winner,omitempty"`
+
+	// Only in a player's own view
+	Hand  []Card `json:"hand,omitempty"`
+	Drawn *Card  `json:"drawn,omitempty"`
+}
+
+func (s *state) publicView() view {
+	v := view{
+		TopCard:     s.top(),
+		ActiveColor: s.activeColor,
+		Direction:   s.direction,
+		DrawPile:    len(s.drawPile),
+		Round:       s.round,
+		TargetScore: s.targetScore,
+		LastRound:   s.lastRound,
+	}
+	for i, player := range s.players {
+		v.Players = append(v.Players, playerSummary{
+			ID:       player,
+			Cards:    len(s.hands[i]),
+			Score:    s.scores[i],
+			CanCatch: s.unoVulnerable == i,
+		})
+	}
+	if s.winner >= 0 {
+		v.Winner = s.players[s.winner]
+	} else {
+		v.CurrentPlayer = s.players[s.turn]
+	}
+	return v
+}
+
+func (Game) PublicView(st engine.State) interface{} {
+	return st.(*state).publicView()
+}
+
+func (Game) PlayerView(st engine.State, player string) interface{} {
+	s := st.(*state)
+	v := s.publicView()
+	if seat := s.seatOf(player); seat >= 0 {
+		v.Hand = append([]Card{}, s.hands[seat]...)
+		if seat == s.turn {
+			v.Drawn = s.drawn
+		}
+	}
+	return v
+}
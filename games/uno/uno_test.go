@@ -0,0 +1,207 @@
+package uno
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"norex/engine"
+)
+
+// newTestState deals a seeded game, then replaces the hands and the
+// discard pile so that a test controls the table. Seat 0 is to play.
+func newTestState(t *testing.T, top Card, hands ...[]Card) *state {
+	t.Helper()
+	ids := []string{"a", "b", "c", "d"}[:len(hands)]
+	st, err := Game{}.NewState(engine.Setup{Players: ids, Options: engine.Options{}, Rand: rand.New(rand.NewSource(1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := st.(*state)
+	s.hands = hands
+	s.discard = []Card{top}
+	s.activeColor = top.Color
+	s.direction = 1
+	s.turn = 0
+	return s
+}
+
+func card(code string) Card {
+	c, ok := parseCard(code)
+	if !ok {
+		panic("uno: invalid card code " + code)
+	}
+	return c
+}
+
+func cardsOf(codes ...string) []Card {
+	var hand []Card
+	for _, code := range codes {
+		hand = append(hand, card(code))
+	}
+	return hand
+}
+
+func TestDeck(t *testing.T) {
+	deck := newDeck()
+	if len(deck) != 108 {
+		t.Fatalf("deck has %d cards, want 108", len(deck))
+	}
+	total := 0
+	for _, c := range deck {
+		if parsed, ok := parseCard(c.Code()); !ok || parsed != c {
+			t.Fatalf("%s does not parse back", c.Code())
+		}
+		total += c.points()
+	}
+	// Per color 2*(1+...+9) + 6*20, plus 8 wild cards at 50
+	if want := 4*(90+120) + 8*50; total != want {
+		t.Fatalf("deck is worth %d points, want %d", total, want)
+	}
+}
+
+func TestPlayable(t *testing.T) {
+	tests := []struct {
+		name string
+		hand []Card
+		card string
+		want bool
+	}{
+		{"same color", cardsOf("red-2"), "red-2", true},
+		{"same number", cardsOf("blue-7"), "blue-7", true},
+		{"neither", cardsOf("blue-3"), "blue-3", false},
+		{"wild", cardsOf("wild", "red-2"), "wild", true},
+		{"draw four without the color", cardsOf("wild-draw4", "blue-3"), "wild-draw4", true},
+		{"draw four holding the color", cardsOf("wild-draw4", "red-2"), "wild-draw4", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, card("red-7"), tt.hand, cardsOf("green-1"))
+			if got := s.playable(0, card(tt.card)); got != tt.want {
+				t.Fatalf("playable(%s) = %v, want %v", tt.card, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActionCards(t *testing.T) {
+	tests := []struct {
+		name      string
+		players   int
+		play      playData
+		wantTurn  int
+		wantDir   int
+		wantDrawn int // cards given to seat 1
+	}{
+		{"number", 3, playData{Card: "red-3"}, 1, 1, 0},
+		{"skip", 3, playData{Card: "red-skip"}, 2, 1, 0},
+		{"reverse", 3, playData{Card: "red-reverse"}, 2, -1, 0},
+		{"reverse with two players", 2, playData{Card: "red-reverse"}, 0, -1, 0},
+		{"draw two", 3, playData{Card: "red-draw2"}, 2, 1, 2},
+		{"wild draw four", 3, playData{Card: "wild-draw4", Color: "green"}, 2, 1, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hands := [][]Card{cardsOf(tt.play.Card, "blue-1", "blue-2")}
+			for i := 1; i < tt.players; i++ {
+				hands = append(hands, cardsOf("yellow-5", "yellow-6"))
+			}
+			s := newTestState(t, card("red-9"), hands...)
+			if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("play", tt.play)); err != nil {
+				t.Fatal(err)
+			}
+			if s.turn != tt.wantTurn || s.direction != tt.wantDir {
+				t.Fatalf("turn %d direction %d, want %d and %d", s.turn, s.direction, tt.wantTurn, tt.wantDir)
+			}
+			if got := len(s.hands[1]) - 2; got != tt.wantDrawn {
+				t.Fatalf("seat 1 drew %d cards, want %d", got, tt.wantDrawn)
+			}
+			if tt.play.Color != "" && s.activeColor != tt.play.Color {
+				t.Fatalf("active color %s, want %s", s.activeColor, tt.play.Color)
+			}
+		})
+	}
+}
+
+func TestCatchUno(t *testing.T) {
+	tests := []struct {
+		name      string
+		callUno   bool
+		wantCards int
+	}{
+		{"forgot to call", false, 3},
+		{"called", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, card("red-9"), cardsOf("red-3", "blue-1"), cardsOf("yellow-5", "yellow-6"))
+			if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("play", playData{Card: "red-3", Uno: tt.callUno})); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Game{}.ApplyMove(s, "b", engine.NewMove("catch_uno", nil))
+			if tt.callUno != errors.Is(err, engine.ErrIllegalMove) {
+				t.Fatalf("catch_uno: %v", err)
+			}
+			if got := len(s.hands[0]); got != tt.wantCards {
+				t.Fatalf("a holds %d cards, want %d", got, tt.wantCards)
+			}
+		})
+	}
+}
+
+func TestDrawThenPass(t *testing.T) {
+	s := newTestState(t, card("red-9"), cardsOf("blue-1"), cardsOf("yellow-5"))
+	s.drawPile = cardsOf("red-4")
+	if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("pass", nil)); !errors.Is(err, engine.ErrIllegalMove) {
+		t.Fatalf("pass before drawing: %v", err)
+	}
+	if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("draw", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if s.drawn == nil || *s.drawn != card("red-4") || s.turn != 0 {
+		t.Fatalf("drawn %v on turn %d, want red-4 to play", s.drawn, s.turn)
+	}
+	if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("play", playData{Card: "blue-1"})); !errors.Is(err, engine.ErrIllegalMove) {
+		t.Fatalf("playing another card than the one drawn: %v", err)
+	}
+	if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("pass", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if s.turn != 1 || len(s.hands[0]) != 2 {
+		t.Fatalf("turn %d with %d cards, want b to play and a to keep 2", s.turn, len(s.hands[0]))
+	}
+}
+
+func TestRoundScoring(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     int
+		wantWinner string
+	}{
+		{"next hand", 500, ""},
+		{"target reached", 50, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, card("red-9"), cardsOf("red-3"), cardsOf("yellow-5", "wild"), cardsOf("blue-skip"))
+			s.targetScore = tt.target
+			if _, err := (Game{}).ApplyMove(s, "a", engine.NewMove("play", playData{Card: "red-3"})); err != nil {
+				t.Fatal(err)
+			}
+			// 5 + 50 + 20
+			if s.scores[0] != 75 || s.lastRound.Points != 75 || s.lastRound.Winner != "a" {
+				t.Fatalf("scores %v, last round %+v; want a to score 75", s.scores, s.lastRound)
+			}
+			winners := Game{}.Winners(s)
+			if tt.wantWinner == "" {
+				if winners != nil || s.round != 2 || len(s.hands[0]) != handSize {
+					t.Fatalf("winners %v in round %d, want a new hand", winners, s.round)
+				}
+				return
+			}
+			if len(winners) != 1 || winners[0] != tt.wantWinner || !(Game{}).IsTerminal(s) {
+				t.Fatalf("winners = %v, want [%s]", winners, tt.wantWinner)
+			}
+		})
+	}
+}
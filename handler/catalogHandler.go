@@ -0,0 +1,12 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"norex/catalog"
+)
+
+// ListGames returns every game of the catalog for the lobby, ordered by
+// display name
+func ListGames(c *fiber.Ctx) error {
+	return c.JSON(catalog.List())
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"norex/engine"
+	"norex/hub"
+	"norex/models"
+)
+
+// roomBroadcaster delivers engine events over the /game/:game_id sockets.
+type roomBroadcaster struct{}
+
+func (roomBroadcaster) Broadcast(roomID, event string, data interface{}) {
+	broadcastToRoom(roomID, event, fiber.Map{"payload": data})
+}
+
+func (roomBroadcaster) SendTo(roomID, userID, event string, data interface{}) {
+	hub.PublishTo(hub.RoomTopic(roomID), userID, fiber.Map{
+		"type": event,
+		"data": fiber.Map{"payload": data},
+	})
+}
+
+func (roomBroadcaster) SendToSpectators(roomID string, players []string, event string, data interface{}) {
+	seated := make(map[string]bool, len(players))
+	for _, player := range players {
+		seated[player] = true
+	}
+	hub.PublishWhere(hub.RoomTopic(roomID), fiber.Map{
+		"type": event,
+		"data": fiber.Map{"payload": data},
+	}, func(userID string) bool { return !seated[userID] })
+}
+
+// roomOptions collects the room settings the game rules depend on.
+func roomOptions(room models.Room) engine.Options {
+	options := engine.Options{}
+	for key, value := range room.Options {
+		if value != nil {
+			options[key] = value
+		}
+	}
+	options["capacity"] = room.Capacity
+	return options
+}
+
+// roomTimeControl returns the time control of the room, if any.
+func roomTimeControl(room models.Room) engine.TimeControl {
+	if room.TimeControl == nil {
+		return engine.TimeControl{}
+	}
+	return *room.TimeControl
+}
+
+// gameSocketMessage is a message sent by a client on the room socket, e.g.
+// {"type": "move", "move": {"action": "play", "data": {...}}}.
+type gameSocketMessage struct {
+	Type string      `json:"type"`
+	Move engine.Move `json:"move"`
+}
+
+// handleGameSocketMessage routes a message received on the room socket to
+// the room's game runner and answers the sender.
+func handleGameSocketMessage(gameID, userEmail string, client *hub.Client, msg []byte) {
+	var message gameSocketMessage
+	if err := json.Unmarshal(msg, &message); err != nil {
+		sendToClient(client, "game_error", fiber.Map{"error": "Invalid message"})
+		return
+	}
+
+	runner, ok := engine.RunnerFor(gameID)
+	if !ok {
+		sendToClient(client, "game_error", fiber.Map{"error": "No game is running in this room"})
+		return
+	}
+
+	switch message.Type {
+	case "move":
+		if err := runner.Submit(userEmail, message.Move); err != nil {
+			sendToClient(client, "game_error", fiber.Map{"error": err.Error(), "action": message.Move.Action})
+		}
+	case "state":
+		sendToClient(client, "game_state", fiber.Map{"payload": runner.Snapshot(userEmail)})
+	case "legal_moves":
+		sendToClient(client, "legal_moves", fiber.Map{"moves": runner.LegalMoves(userEmail)})
+	default:
+		log.Println("Unknown game socket message:", message.Type)
+		sendToClient(client, "game_error", fiber.Map{"error": "Unknown message type"})
+	}
+}
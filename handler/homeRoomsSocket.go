@@ -1,28 +1,27 @@
 package handler
 
 import (
+	"context"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
-	"gopkg.in/rethinkdb/rethinkdb-go.v6"
 	"log"
-	"norex/database"
+	"norex/changefeed"
+	"norex/hub"
+	"norex/store"
 )
 
-var clients = make(map[*websocket.Conn]bool) // connected clients
-
 func HandleGameRooms(c *websocket.Conn) {
-	clients[c] = true
-	defer func() {
-		delete(clients, c) // remove client on disconnect
-		c.Close()
-	}()
+	email, _ := c.Locals("email").(string)
+	client := hub.Register(c, email)
+	client.Subscribe(hub.AllGamesTopic)
+	defer client.Close() // remove client on disconnect
 
 	for {
 		_, _, err := c.ReadMessage()
 		if err != nil {
-			log.Println("WebSocket error:", err)
-			delete(clients, c)
-			c.Close()
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Println("WebSocket error:", err)
+			}
 			break
 		}
 	}
@@ -31,72 +30,47 @@ func HandleGameRooms(c *websocket.Conn) {
 // Function to broadcast room counts separated by gameName to all clients
 func broadcastRoomCountByGame() {
 
-	res, err := rethinkdb.Table("rooms").Run(database.GetRethinkSession())
-	if err != nil {
-		log.Println("RethinkDB error:", err)
-	}
-	defer res.Close()
-
-	var rooms []struct {
-		GameName string `rethinkdb:"gameName"`
-	}
-
-	// Fetch all rooms into the slice
-	err = res.All(&rooms)
+	gameRoomCounts, err := store.Rooms().CountByGame(context.TODO())
 	if err != nil {
 		log.Println("Error fetching rooms:", err)
 	}
 
-	// Manually aggregate rooms by gameName
-	gameRoomCounts := make(map[string]int)
-	for _, room := range rooms {
-		gameRoomCounts[room.GameName]++
-	}
-
 	// Send the room counts to all connected clients
-	for client := range clients {
-		if err := client.WriteJSON(fiber.Map{
-			"gameRoomCounts": gameRoomCounts, // e.g., {"uno": 3, "chess": 5}
-		}); err != nil {
-			log.Println("Error broadcasting to client:", err)
-			client.Close()
-			delete(clients, client)
-		}
-	}
+	hub.Publish(hub.AllGamesTopic, fiber.Map{
+		"gameRoomCounts": gameRoomCounts, // e.g., {"uno": 3, "chess": 5}
+	})
 }
 
-func WatchRoomChanges() {
-
-	log.Println("change detected in /all-games")
+// roomCountsStale asks broadcastRoomCounts for a new count. Its single
+// slot folds a burst of room changes into one query.
+var roomCountsStale = make(chan struct{}, 1)
 
-	cursor, err := rethinkdb.Table("rooms").Changes().Run(database.GetRethinkSession())
-	if err != nil {
-		log.Println("RethinkDB error:", err)
-		return
+// broadcastRoomCounts counts the rooms again every time they change, off
+// the changefeed goroutine.
+func broadcastRoomCounts() {
+	for range roomCountsStale {
+		broadcastRoomCountByGame()
 	}
-	defer cursor.Close()
-
-	var change map[string]interface{}
-	for cursor.Next(&change) {
-
-		if _, newExists := change["new_val"].(map[string]interface{}); newExists && change["old_val"] == nil {
-			log.Println("Room Added, triggering broadcast")
-			broadcastRoomCountByGame()
-		}
-
-		// If old value exists but new value is nil, a room was deleted
-		if _, oldExists := change["old_val"].(map[string]interface{}); oldExists && change["new_val"] == nil {
-			log.Println("Room Deleted, triggering broadcast")
-			broadcastRoomCountByGame()
-		}
+}
 
+// WatchRoomChanges re-broadcasts the room counts when a room is added or deleted
+func WatchRoomChanges(event changefeed.Event) {
+	switch event.Kind {
+	case changefeed.Insert:
+		log.Println("Room Added, triggering broadcast")
+	case changefeed.Delete:
+		log.Println("Room Deleted, triggering broadcast")
+	default:
+		return
 	}
-
-	if err := cursor.Err(); err != nil {
-		log.Println("Cursor error:", err)
+	// A count already pending sees this change too
+	select {
+	case roomCountsStale <- struct{}{}:
+	default:
 	}
 }
 
 func StartWebSocketService() {
-	go WatchRoomChanges()
+	go broadcastRoomCounts()
+	changefeed.Subscribe("rooms", WatchRoomChanges)
 }
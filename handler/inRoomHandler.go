@@ -2,38 +2,42 @@ package handler
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
-	"gopkg.in/rethinkdb/rethinkdb-go.v6"
+	"github.com/gofiber/fiber/v2/utils"
 	"log"
-	"norex/database"
+	"norex/changefeed"
+	"norex/engine"
+	"norex/hub"
 	"norex/models"
+	"norex/store"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
-var roomClients = make(map[string]map[*websocket.Conn]bool) // Map game_id -> clients
-
 func HandleGameRoom(c *websocket.Conn) {
 	gameID := c.Params("game_id")
 	userEmail := c.Locals("email").(string)
 
-	// Fetch user info from MongoDB based on their email
-	var user struct {
-		Name   string `bson:"name"`
-		Avatar string `bson:"avatar"`
-	}
-	collection := database.GetCollection("users")
-	err := collection.FindOne(context.Background(), bson.M{"email": userEmail}).Decode(&user)
+	// Fetch user info based on their email
+	user, err := store.Users().FindByEmail(context.Background(), userEmail)
 	if err != nil {
 		log.Printf("Failed to fetch user data for email %s: %v", userEmail, err)
 		return
 	}
 
-	// Add the current connection to the room clients
-	if roomClients[gameID] == nil {
-		roomClients[gameID] = make(map[*websocket.Conn]bool)
-	}
-	roomClients[gameID][c] = true
+	// Add the current connection to the room
+	client := hub.Register(c, userEmail)
+	client.Subscribe(hub.RoomTopic(gameID))
 
 	// Broadcast that a new user has joined the room
 	broadcastToRoom(gameID, "new_user", fiber.Map{
@@ -42,41 +46,44 @@ func HandleGameRoom(c *websocket.Conn) {
 		"email":    userEmail,
 	})
 
-	defer func() {
-		// Check if the user is still connected before proceeding
-		if _, ok := roomClients[gameID][c]; ok {
-			// Remove the user from the room clients on disconnect
-			delete(roomClients[gameID], c)
-			c.Close()
-
-			// Broadcast that the user has left the room
-			broadcastToRoom(gameID, "user_left", fiber.Map{
-				"userName": user.Name,
-				"avatar":   user.Avatar,
-				"email":    userEmail,
-			})
+	// Catch up with the game if one is already running in the room
+	if runner, ok := engine.RunnerFor(gameID); ok {
+		sendToClient(client, "game_state", fiber.Map{"payload": runner.Snapshot(userEmail)})
+	}
 
-			// Check if the current user is the room owner by querying RethinkDB
-			isOwner, err := checkIfUserIsOwner(gameID, userEmail)
-			if err != nil {
-				log.Println("Error checking owner in RethinkDB:", err)
-				return
-			}
+	defer func() {
+		// Remove the user from the room on disconnect
+		client.Close()
+
+		// Broadcast that the user has left the room
+		broadcastToRoom(gameID, "user_left", fiber.Map{
+			"userName": user.Name,
+			"avatar":   user.Avatar,
+			"email":    userEmail,
+		})
+
+		// Keep the room while the user is still connected from somewhere else
+		if hub.Connected(hub.RoomTopic(gameID), userEmail) {
+			return
+		}
 
-			// If the owner is leaving, delete the room
-			if isOwner {
-				// Broadcast that the room is being deleted
-				broadcastToRoom(gameID, "room_deleted", fiber.Map{
-					"gameID": gameID,
-					"owner":  userEmail,
-				})
+		// Check if the current user is the room owner by querying RethinkDB
+		isOwner, err := checkIfUserIsOwner(gameID, userEmail)
+		if err != nil {
+			log.Println("Error checking owner in RethinkDB:", err)
+			return
+		}
 
-				// Delete the room data from RethinkDB
-				deleteRoomFromDatabase(gameID)
+		// If the owner is leaving, delete the room
+		if isOwner {
+			// Broadcast that the room is being deleted
+			broadcastToRoom(gameID, "room_deleted", fiber.Map{
+				"gameID": gameID,
+				"owner":  userEmail,
+			})
 
-				// Clean up the room clients data
-				delete(roomClients, gameID)
-			}
+			// Delete the room data from RethinkDB
+			deleteRoomFromDatabase(gameID)
 		}
 	}()
 
@@ -87,58 +94,31 @@ func HandleGameRoom(c *websocket.Conn) {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure) {
 				log.Println("WebSocket error:", err)
 			}
-			delete(roomClients[gameID], c)
-			c.Close()
 			break
 		}
-		// Handle incoming messages or other events
-		log.Println("Message received:", string(msg))
+		// Handle incoming game messages
+		handleGameSocketMessage(gameID, userEmail, client, msg)
 	}
 }
 
-func WatchRoomDelete() {
-	cursor, err := rethinkdb.Table("rooms").Changes().Run(database.GetRethinkSession())
-	if err != nil {
-		log.Println("RethinkDB error:", err)
+func WatchRoomDelete(event changefeed.Event) {
+	if event.Kind != changefeed.Delete {
 		return
 	}
-	defer cursor.Close()
-
-	var change map[string]interface{}
-	for cursor.Next(&change) {
-		// Check if a room was deleted
-		if change["old_val"] != nil && change["new_val"] == nil {
-			// Room deleted event
-			roomID := change["old_val"].(map[string]interface{})["id"].(string)
-			ownerEmail := change["old_val"].(map[string]interface{})["userEmail"].(string) // Get the owner email
-			broadcastToRoom(roomID, "room_deleted", fiber.Map{
-				"roomID": roomID,
-				"owner":  ownerEmail, // Broadcast the owner's email or name if needed
-			})
-		}
-	}
 
-	if err := cursor.Err(); err != nil {
-		log.Println("Cursor error:", err)
-	}
+	// Room deleted event
+	broadcastToRoom(event.ID(), "room_deleted", fiber.Map{
+		"roomID": event.ID(),
+		"owner":  event.String("userEmail"), // Broadcast the owner's email or name if needed
+	})
 }
 
 // Helper function to check if the user is the room owner
 func checkIfUserIsOwner(gameID, userEmail string) (bool, error) {
-	var room struct {
-		UserEmail string `rethinkdb:"userEmail"`
-	}
-
-	// Get the room document from the rooms table using its ID
-	res, err := rethinkdb.Table("rooms").Get(gameID).Run(database.GetRethinkSession())
+	// Get the room document using its ID
+	room, err := store.Rooms().Get(context.TODO(), gameID)
 	if err != nil {
-		return false, err
-	}
-	defer res.Close()
-
-	// Decode the result into the room struct
-	if err := res.One(&room); err != nil {
-		if err == rethinkdb.ErrEmptyResult {
+		if err == store.ErrNotFound {
 			return false, nil // Room not found
 		}
 		return false, err
@@ -150,26 +130,35 @@ func checkIfUserIsOwner(gameID, userEmail string) (bool, error) {
 
 // Helper function to delete the room from RethinkDB
 func deleteRoomFromDatabase(gameID string) {
-	_, err := rethinkdb.Table("rooms").Get(gameID).Delete().RunWrite(database.GetRethinkSession())
+	err := store.Rooms().Delete(context.TODO(), gameID)
 	if err != nil {
 		log.Println("Error deleting room from RethinkDB:", err)
 	} else {
 		log.Println("Room deleted:", gameID)
 	}
+	if err := store.Participations().DeleteByRoom(context.TODO(), gameID); err != nil {
+		log.Println("Error deleting participants:", err)
+	}
+	if err := store.Messages().DeleteByRoom(context.TODO(), gameID); err != nil {
+		log.Println("Error deleting messages:", err)
+	}
+	engine.Stop(gameID)
 }
 
 // Helper function to broadcast events
 func broadcastToRoom(gameID string, event string, message fiber.Map) {
-	for conn := range roomClients[gameID] {
-		if err := conn.WriteJSON(fiber.Map{
-			"type": event,
-			"data": message,
-		}); err != nil {
-			log.Println("Error sending message to room:", err)
-			conn.Close()
-			delete(roomClients[gameID], conn) // Clean up disconnected client
-		}
-	}
+	hub.Publish(hub.RoomTopic(gameID), fiber.Map{
+		"type": event,
+		"data": message,
+	})
+}
+
+// Helper function to send an event to a single connection of a room
+func sendToClient(client *hub.Client, event string, message fiber.Map) {
+	client.Send(fiber.Map{
+		"type": event,
+		"data": message,
+	})
 }
 
 // Broadcast when a user subscribes/unsubscribes
@@ -179,65 +168,388 @@ func broadcastUserEvent(gameID string, eventName string, user fiber.Map) {
 
 // ===================== api
 
-func ParticipateInGame(c *fiber.Ctx) error {
-	gameID := c.Params("game_id")
-	// Logic to add user to the game
+// participationMu serializes seat claims so two users cannot both take
+// the last seat of a room
+var participationMu sync.Mutex
+
+// Helper function to tell the room whether every seat is taken
+func broadcastCapacity(gameID string, participants, capacity int) {
+	broadcastToRoom(gameID, "full_capacity", fiber.Map{
+		"full":         capacity > 0 && participants >= capacity,
+		"participants": participants,
+		"capacity":     capacity,
+	})
+}
+
+// roomParticipants returns the emails of the users seated in a room, the
+// owner first and then everyone else in the order they joined.
+func roomParticipants(gameID, owner string) ([]string, error) {
+	participations, err := store.Participations().ListByRoom(context.TODO(), gameID)
+	if err != nil {
+		return nil, err
+	}
+	participants := []string{owner}
+	for _, participation := range participations {
+		if participation.UserID != owner {
+			participants = append(participants, participation.UserID)
+		}
+	}
+	return participants, nil
+}
+
+// errAlreadySeated is returned by takeSeat for users already in the room
+var errAlreadySeated = errors.New("user already participates in this room")
+
+// errGameInProgress is returned by takeSeat for rooms playing a game
+var errGameInProgress = errors.New("a game is in progress in this room")
+
+// gameInProgress reports whether a game is being played in a room.
+func gameInProgress(roomID string) bool {
+	runner, ok := engine.RunnerFor(roomID)
+	return ok && !runner.Finished()
+}
+
+// takeSeat seats a user in a room: it claims a free seat, records the
+// participation and tells the room. The caller holds participationMu and
+// has checked the room settings.
+func takeSeat(room models.Room, user models.User) error {
+	participations, err := store.Participations().ListByRoom(context.TODO(), room.ID)
+	if err != nil {
+		return err
+	}
+	for _, participation := range participations {
+		if participation.UserID == user.Email {
+			return errAlreadySeated
+		}
+	}
+	// The players of a game are fixed when it is dealt
+	if gameInProgress(room.ID) {
+		return errGameInProgress
+	}
+
+	// Claimed in the database, so servers sharing it never oversell a room
+	if err := store.Rooms().ClaimSeat(context.TODO(), room.ID); err != nil {
+		return err
+	}
+	level := user.Games[room.GameName].Level
+	_, err = store.Participations().Create(context.TODO(), models.Participation{
+		RoomID:     room.ID,
+		UserID:     user.Email,
+		UserName:   user.Name,
+		UserAvatar: user.Avatar,
+		UserLevel:  level,
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		store.Rooms().ReleaseSeat(context.TODO(), room.ID)
+		return err
+	}
+
 	// Broadcast event: "someone participated"
-	broadcastUserEvent(gameID, "user_participated", fiber.Map{
-		"userName": "someUser",
-		"avatar":   "someAvatar",
-		"level":    1, // Get user level from the database
+	broadcastUserEvent(room.ID, "user_participated", fiber.Map{
+		"email":    user.Email,
+		"userName": user.Name,
+		"avatar":   user.Avatar,
+		"level":    level,
 	})
+	broadcastCapacity(room.ID, len(participations)+1, room.Capacity)
+	return nil
+}
+
+func ParticipateInGame(c *fiber.Ctx) error {
+	// Copied because the ID outlives the request
+	gameID := utils.CopyString(c.Params("game_id"))
+	userEmail := c.Locals("email").(string)
+
+	// Fetch user info based on their email
+	user, err := store.Users().FindByEmail(context.TODO(), userEmail)
+	if err != nil {
+		log.Printf("Failed to fetch user data for email %s: %v", userEmail, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	participationMu.Lock()
+	defer participationMu.Unlock()
+
+	room, err := store.Rooms().Get(context.TODO(), gameID)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+	if err != nil {
+		log.Println("Error reading room:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading room"})
+	}
+
+	level := user.Games[room.GameName].Level
+
+	// The owner is always seated; everyone else has to meet the room settings
+	if userEmail != room.UserEmail {
+		if level < room.MinLevel {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Your level is too low for this room"})
+		}
+		if room.IsLocked {
+			if subtle.ConstantTimeCompare([]byte(c.FormValue("password")), []byte(room.RoomPassword)) != 1 {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Wrong room password"})
+			}
+		}
+	}
+
+	err = takeSeat(room, user)
+	if err == errAlreadySeated {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "You already participate in this room"})
+	}
+	if err == store.ErrFull {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The room is full"})
+	}
+	if err == errGameInProgress {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A game is in progress in this room"})
+	}
+	if err != nil {
+		log.Println("Error taking seat:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to participate"})
+	}
+
 	return c.JSON(fiber.Map{"status": "user participated"})
 }
 
 func CancelParticipation(c *fiber.Ctx) error {
 	gameID := c.Params("game_id")
-	// Logic to remove user from game (but not owner)
+	userEmail := c.Locals("email").(string)
+
+	// Fetch user info based on their email
+	user, err := store.Users().FindByEmail(context.TODO(), userEmail)
+	if err != nil {
+		log.Printf("Failed to fetch user data for email %s: %v", userEmail, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	participationMu.Lock()
+	defer participationMu.Unlock()
+
+	room, err := store.Rooms().Get(context.TODO(), gameID)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+	if err != nil {
+		log.Println("Error reading room:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading room"})
+	}
+
+	// The owner can not leave their own game
+	if room.UserEmail == userEmail {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "The room owner can not cancel participation"})
+	}
+
+	err = store.Participations().Delete(context.TODO(), gameID, userEmail)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "You do not participate in this room"})
+	}
+	if err != nil {
+		log.Println("Error deleting participation:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to cancel participation"})
+	}
+	if err := store.Rooms().ReleaseSeat(context.TODO(), gameID); err != nil {
+		log.Println("Error counting participants:", err)
+	}
+
 	// Broadcast event: "someone canceled participation"
 	broadcastUserEvent(gameID, "user_canceled", fiber.Map{
-		"userName": "someUser",
-		"avatar":   "someAvatar",
-		"level":    1, // Get user level from the database
+		"email":    userEmail,
+		"userName": user.Name,
+		"avatar":   user.Avatar,
+		"level":    user.Games[room.GameName].Level,
 	})
+
+	participations, err := store.Participations().ListByRoom(context.TODO(), gameID)
+	if err != nil {
+		log.Println("Error reading participants:", err)
+	} else {
+		broadcastCapacity(gameID, len(participations), room.Capacity)
+	}
+
 	return c.JSON(fiber.Map{"status": "participation canceled"})
 }
 
+const (
+	maxMessageLength    = 1000
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 100
+)
+
+// historyLimit reads the limit parameter of a history endpoint.
+func historyLimit(c *fiber.Ctx) (int, error) {
+	limit := c.QueryInt("limit", defaultHistoryLimit)
+	if limit <= 0 || limit > maxHistoryLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit)
+	}
+	return limit, nil
+}
+
+// historyPage reads the limit and before parameters of a history endpoint.
+func historyPage(c *fiber.Ctx) (int, time.Time, error) {
+	limit, err := historyLimit(c)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	var before time.Time
+	if cursor := c.Query("before"); cursor != "" {
+		var err error
+		before, err = time.Parse(time.RFC3339Nano, cursor)
+		if err != nil {
+			return 0, time.Time{}, errors.New("Invalid before cursor")
+		}
+	}
+	return limit, before, nil
+}
+
 func SendMessage(c *fiber.Ctx) error {
-	// Get the game ID from URL params
-	gameID := c.Params("game_id")
+	// Get the game ID from URL params, copied because it outlives the request
+	gameID := utils.CopyString(c.Params("game_id"))
 
 	// Get the user's email from the request context
 	userEmail := c.Locals("email").(string)
 
-	// Fetch user info from MongoDB based on their email
-	var user struct {
-		Name   string `bson:"name"`
-		Avatar string `bson:"avatar"`
+	content := utils.CopyString(strings.TrimSpace(c.FormValue("message")))
+	if content == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Message is empty"})
+	}
+	if utf8.RuneCountInString(content) > maxMessageLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Message is too long"})
+	}
+
+	// Check that text chat is on in the room settings
+	room, err := store.Rooms().Get(c.Context(), gameID)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+	if err != nil {
+		log.Println("Error reading room:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading room"})
+	}
+	if !room.TextChatOn {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Text chat is off in this room"})
+	}
+
+	// Only the players of the room may talk in it
+	participants, err := roomParticipants(gameID, room.UserEmail)
+	if err != nil {
+		log.Println("Error reading participants:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading participants"})
+	}
+	if !slices.Contains(participants, userEmail) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You do not participate in this room"})
 	}
 
-	// Replace "users" with your MongoDB collection name
-	collection := database.GetCollection("users") // Assuming this is how you access MongoDB collection
-	err := collection.FindOne(c.Context(), bson.M{"email": userEmail}).Decode(&user)
+	// Fetch user info based on their email
+	user, err := store.Users().FindByEmail(c.Context(), userEmail)
 	if err != nil {
 		// Handle the error if the user is not found or another error occurs
 		log.Printf("Failed to fetch user data for email %s: %v", userEmail, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "User not found"})
 	}
 
+	// Save the message so users joining later can read it
+	message := models.Message{
+		RoomID:     gameID,
+		UserID:     userEmail,
+		UserName:   user.Name,
+		UserAvatar: user.Avatar,
+		Content:    content,
+		CreatedAt:  time.Now().UTC(),
+	}
+	message.ID, err = store.Messages().Create(c.Context(), message)
+	if err != nil {
+		log.Println("Error saving message:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to send message"})
+	}
+
 	// Broadcast the message to the room with user's info
 	broadcastToRoom(gameID, "new_message", fiber.Map{
-		"userName": user.Name,
-		"avatar":   user.Avatar,
-		"message":  c.FormValue("message"),
+		"messageID": message.ID,
+		"email":     userEmail,
+		"userName":  user.Name,
+		"avatar":    user.Avatar,
+		"message":   content,
+		"createdAt": message.CreatedAt,
 	})
 
 	// Return a success response
-	return c.JSON(fiber.Map{"status": "message sent"})
+	return c.JSON(fiber.Map{"status": "message sent", "messageID": message.ID})
 }
 
-func StartGame(c *fiber.Ctx) error {
+func encodeMessageCursor(message models.Message) string {
+	data, _ := json.Marshal(store.MessageCursor{CreatedAt: message.CreatedAt, ID: message.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeMessageCursor(cursor string) (*store.MessageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var decoded store.MessageCursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return &decoded, nil
+}
+
+// GetRoomMessages returns the chat history of a room, newest first. Pass
+// the nextCursor of a page as ?before= to get the messages before it. Only
+// the owner and the players seated in the room can read it.
+func GetRoomMessages(c *fiber.Ctx) error {
 	gameID := c.Params("game_id")
+	userEmail := c.Locals("email").(string)
+
+	limit, err := historyLimit(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	var before *store.MessageCursor
+	if cursor := c.Query("before"); cursor != "" {
+		if before, err = decodeMessageCursor(cursor); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid before cursor"})
+		}
+	}
+
+	room, err := store.Rooms().Get(c.Context(), gameID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+		}
+		log.Println("Error reading room:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading room"})
+	}
+
+	participants, err := roomParticipants(gameID, room.UserEmail)
+	if err != nil {
+		log.Println("Error reading participants:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading participants"})
+	}
+	if !slices.Contains(participants, userEmail) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You do not participate in this room"})
+	}
+
+	messages, err := store.Messages().ListByRoom(c.Context(), gameID, before, limit)
+	if err != nil {
+		log.Println("Error fetching messages:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error fetching messages"})
+	}
+	if messages == nil {
+		messages = []models.Message{}
+	}
+
+	// A full page means there may be older messages
+	response := fiber.Map{"messages": messages}
+	if len(messages) == limit {
+		response["nextCursor"] = encodeMessageCursor(messages[len(messages)-1])
+	}
+	return c.JSON(response)
+}
+
+func StartGame(c *fiber.Ctx) error {
+	// Copied because the ID outlives the request
+	gameID := utils.CopyString(c.Params("game_id"))
 	userEmail := c.Locals("email").(string) // Assuming the user's email is set in the context during authentication
 
 	// Check if the user is the owner of the room
@@ -251,91 +563,98 @@ func StartGame(c *fiber.Ctx) error {
 	}
 
 	// Fetch the game name from the rooms table
-	var room struct {
-		GameName string `rethinkdb:"gameName"`
+	room, err := store.Rooms().Get(context.TODO(), gameID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch room information"})
 	}
 
-	cursor, err := rethinkdb.Table("rooms").Get(gameID).Field("gameName").Run(database.GetRethinkSession())
+	err = startRoomGame(room)
+	if err == engine.ErrGameInProgress {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, errGameNotSaved) {
+		log.Println("Error starting game:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start the game"})
+	}
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch room information"})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Fetch the game name
-	if err = cursor.One(&room.GameName); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read room information"})
+	return c.JSON(fiber.Map{"status": "game started"})
+}
+
+// errGameNotSaved wraps the storage errors of startRoomGame; other errors
+// come from the engine refusing to deal the game
+var errGameNotSaved = errors.New("failed to start the game")
+
+// startRoomGame deals the game of a room to everyone seated in it, the
+// owner first, records it in the games table and tells the room.
+func startRoomGame(room models.Room) error {
+	participants, err := roomParticipants(room.ID, room.UserEmail)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errGameNotSaved, err)
 	}
 
 	// Create a new entry in the games table
-	gameEntry := map[string]interface{}{
-		"roomId":       gameID,
-		"gameName":     room.GameName, // Use the game name retrieved from the rooms table
-		"status":       "started",
-		"ownerId":      userEmail,           // Store the owner's email as the ownerId
-		"winnerId":     nil,                 // Placeholder for the winner; can be updated later
-		"participates": []string{userEmail}, // Start with the owner as a participant
+	gameEntry := models.Game{
+		RoomID:       room.ID,
+		GameName:     room.GameName, // Use the game name retrieved from the rooms table
+		Status:       "started",
+		OwnerID:      room.UserEmail, // Store the owner's email as the ownerId
+		WinnerID:     nil,            // Placeholder for the winner; can be updated later
+		Participants: participants,   // The owner first, then everyone who participated
+		Ranked:       room.Ranked,
+	}
+
+	// Insert the new game entry into the games table first: a game can be
+	// over as soon as it is dealt and its result refers to the entry
+	gameID, err := store.Games().Create(context.TODO(), gameEntry)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errGameNotSaved, err)
 	}
 
-	// Insert the new game entry into the games table
-	_, err = rethinkdb.Table("games").Insert(gameEntry).RunWrite(database.GetRethinkSession())
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start the game"})
+	// Deal the game if an engine is registered for it
+	if _, registered := engine.Lookup(room.GameName); registered {
+		_, err = engine.Start(room.ID, gameID, room.GameName, gameEntry.Participants, roomOptions(room), roomTimeControl(room), roomBroadcaster{})
+		if err != nil {
+			if err := store.Games().Delete(context.TODO(), gameID); err != nil {
+				log.Println("Error deleting game entry:", err)
+			}
+			return err
+		}
 	}
 
 	// Broadcast event: "game started"
-	broadcastToRoom(gameID, "game_started", fiber.Map{
-		"owner": userEmail, // or fetch the owner's name if necessary
+	broadcastToRoom(room.ID, "game_started", fiber.Map{
+		"owner": room.UserEmail, // or fetch the owner's name if necessary
 	})
-
-	return c.JSON(fiber.Map{"status": "game started"})
+	return nil
 }
 
 func GetRoomInformation(c *fiber.Ctx) error {
 	gameID := c.Params("game_id")
 
-	// Define a map to hold the entire room information from RethinkDB
-	var roomSettings map[string]interface{}
-
-	// Fetch the room from RethinkDB. The entire row will represent the room's settings.
-	res, err := rethinkdb.Table("rooms").Get(gameID).Run(database.GetRethinkSession())
+	// Fetch the room. The entire row will represent the room's settings.
+	roomSettings, err := store.Rooms().Get(context.TODO(), gameID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve room"})
-	}
-	defer res.Close()
-
-	// Decode the result into the roomSettings map
-	if err := res.One(&roomSettings); err != nil {
-		if err == rethinkdb.ErrEmptyResult {
+		if err == store.ErrNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not decode room information"})
-	}
-
-	// Get the owner's email from the roomSettings map (assuming 'userEmail' exists in the RethinkDB document)
-	userEmail, ok := roomSettings["UserEmail"].(string)
-	if !ok {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Invalid user email format in room data"})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve room"})
 	}
 
-	// Fetch the owner's details from MongoDB
-	var owner models.User // Assuming you have a User model to hold user information
-	collection := database.GetCollection("users")
-
-	// Fetch the owner's information from the users collection using the email from the room
-	err = collection.FindOne(context.TODO(), bson.M{"email": userEmail}).Decode(&owner)
+	// Fetch the owner's information using the email from the room
+	owner, err := store.Users().FindByEmail(context.TODO(), roomSettings.UserEmail)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve owner information"})
 	}
 
-	gameName, ok := roomSettings["GameName"].(string)
-	if !ok {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Invalid game name format in room data"})
-	}
-	gameLevel := owner.Games[gameName].Level
+	gameLevel := owner.Games[roomSettings.GameName].Level
 
 	filteredSettings := fiber.Map{
-		"IsLocked":    roomSettings["IsLocked"],
-		"VoiceChatOn": roomSettings["VoiceChatOn"],
-		"TextChatOn":  roomSettings["TextChatOn"],
+		"isLocked":    roomSettings.IsLocked,
+		"voiceChatOn": roomSettings.VoiceChatOn,
+		"textChatOn":  roomSettings.TextChatOn,
 	}
 
 	// Prepare the room information response
@@ -349,169 +668,54 @@ func GetRoomInformation(c *fiber.Ctx) error {
 	return c.JSON(roomInfo)
 }
 
-func WatchRoomUserParticipation() {
-	cursor, err := rethinkdb.Table("participated").Changes().Run(database.GetRethinkSession())
-	if err != nil {
-		log.Println("RethinkDB error:", err)
+// WatchRoomGameChanges tells a room which of its settings were edited
+func WatchRoomGameChanges(event changefeed.Event) {
+	if event.Kind != changefeed.Update {
 		return
 	}
-	defer cursor.Close()
-
-	var change map[string]interface{}
-	for cursor.Next(&change) {
-		if change["new_val"] != nil {
-			// User participated in a room
-			userID := change["new_val"].(map[string]interface{})["userID"].(string)
-			roomID := change["new_val"].(map[string]interface{})["roomID"].(string)
-			userName := change["new_val"].(map[string]interface{})["userName"].(string)
-			userAvatar := change["new_val"].(map[string]interface{})["userAvatar"].(string)
-			userLevel := change["new_val"].(map[string]interface{})["userLevel"].(int) // Assuming level is an int
-
-			// Broadcast participation details to the room
-			broadcastToRoom(roomID, "user_participated", fiber.Map{
-				"userID":     userID,
-				"userName":   userName,
-				"userAvatar": userAvatar,
-				"userLevel":  userLevel,
-			})
-		}
-
-		if change["old_val"] != nil {
-			// User canceled participation
-			userID := change["old_val"].(map[string]interface{})["userID"].(string)
-			roomID := change["old_val"].(map[string]interface{})["roomID"].(string)
 
-			// Broadcast cancellation details to the room
-			broadcastToRoom(roomID, "user_canceled_participation", fiber.Map{
-				"userID": userID,
-			})
-		}
+	room, ok := eventRoom(event)
+	if !ok {
+		return
 	}
 
-	if err := cursor.Err(); err != nil {
-		log.Println("Cursor error:", err)
+	changes := fiber.Map{}
+	for key, value := range event.New {
+		// Seats are announced with full_capacity instead
+		if key == "roomPassword" || key == "updatedAt" || key == "participants" {
+			continue
+		}
+		if old, ok := event.Old[key]; !ok || !reflect.DeepEqual(old, value) {
+			changes[key] = value
+		}
 	}
-}
-
-func WatchRoomMessages() {
-	cursor, err := rethinkdb.Table("messages").Changes().Run(database.GetRethinkSession())
-	if err != nil {
-		log.Println("RethinkDB error:", err)
+	if len(changes) == 0 {
 		return
 	}
-	defer cursor.Close()
-
-	var change map[string]interface{}
-	for cursor.Next(&change) {
-		if change["new_val"] != nil {
-			// Message sent to the room
-			messageID := change["new_val"].(map[string]interface{})["id"].(string)
-			roomID := change["new_val"].(map[string]interface{})["roomID"].(string)
-			userID := change["new_val"].(map[string]interface{})["userID"].(string)
-			userName := change["new_val"].(map[string]interface{})["userName"].(string)
-			userAvatar := change["new_val"].(map[string]interface{})["userAvatar"].(string)
-			content := change["new_val"].(map[string]interface{})["content"].(string)
-
-			// Broadcast message to the room
-			broadcastToRoom(roomID, "new_message", fiber.Map{
-				"messageID":  messageID,
-				"userID":     userID,
-				"userName":   userName,
-				"userAvatar": userAvatar,
-				"content":    content,
-			})
-		}
-	}
 
-	if err := cursor.Err(); err != nil {
-		log.Println("Cursor error:", err)
-	}
+	log.Println("Room settings updated, triggering broadcast")
+	broadcastToRoom(event.ID(), "room_updated", fiber.Map{
+		"changes":  changes,
+		"settings": room,
+	})
 }
 
-func WatchRoomGameChanges() {
-	cursor, err := rethinkdb.Table("rooms").Changes().Run(database.GetRethinkSession())
-	if err != nil {
-		log.Println("RethinkDB error:", err)
+// WatchRoomGames tells a room when its game is removed from the games table
+func WatchRoomGames(event changefeed.Event) {
+	if event.Kind != changefeed.Delete {
 		return
 	}
-	defer cursor.Close()
-
-	var change map[string]interface{}
-	for cursor.Next(&change) {
-		newVal, newExists := change["new_val"].(map[string]interface{})
-		oldVal, oldExists := change["old_val"].(map[string]interface{})
-
-		// If the room settings are updated
-		if newExists && oldExists && newVal["settings"] != oldVal["settings"] {
-			log.Println("Room settings updated, triggering broadcast")
-			broadcastToRoom(newVal["id"].(string), "room_updated", fiber.Map{
-				"settings": newVal["settings"],
-			})
-		}
-
-		// If a new room is added
-		if newExists && !oldExists {
-			log.Println("Room added, triggering broadcast")
-			broadcastRoomCountByGame()
-		}
-
-		// If a room is deleted
-		if oldExists && !newExists {
-			log.Println("Room deleted, checking games table")
-
-			// Check for any remaining games in this room
-			gameCursor, err := rethinkdb.Table("games").Filter(rethinkdb.Row.Field("roomId").Eq(oldVal["id"])).Changes().Run(database.GetRethinkSession())
-			if err != nil {
-				log.Println("RethinkDB error when listening for game changes:", err)
-				continue
-			}
-			defer gameCursor.Close()
-
-			var gameChange map[string]interface{}
-			for gameCursor.Next(&gameChange) {
-				newGameVal, newGameExists := gameChange["new_val"].(map[string]interface{})
-				_, oldGameExists := gameChange["old_val"].(map[string]interface{})
-
-				// If a game has started
-				if newGameExists && newGameVal["status"] == "started" {
-					log.Println("Game started, triggering broadcast")
-					broadcastToRoom(oldVal["id"].(string), "game_started", fiber.Map{
-						"status": "Game has started!",
-					})
-				}
-
-				// If a game was deleted and no more games remain in the room
-				if oldGameExists && !newGameExists {
-					countCursor, err := rethinkdb.Table("games").Filter(rethinkdb.Row.Field("roomId").Eq(oldVal["id"])).Count().Run(database.GetRethinkSession())
-					if err != nil {
-						log.Println("RethinkDB error when counting remaining games:", err)
-						continue
-					}
-					defer countCursor.Close()
-
-					var remainingGames int
-					countCursor.Next(&remainingGames)
-					if remainingGames == 0 {
-						log.Println("No more games in the room, triggering broadcast")
-						broadcastToRoom(oldVal["id"].(string), "game_ended", fiber.Map{
-							"status": "Game has ended!",
-						})
-					}
-				}
-			}
-		}
-	}
-
-	if err := cursor.Err(); err != nil {
-		log.Println("Cursor error:", err)
+	if roomID := event.String("roomId"); roomID != "" {
+		log.Println("Game removed, triggering broadcast")
+		broadcastToRoom(roomID, "game_ended", fiber.Map{
+			"status": "Game has ended!",
+		})
 	}
 }
 
 func StartWebSocketServiceGameRoom() {
-	// Start goroutines to watch for specific changes in the "rooms" table and trigger broadcasts
-	go WatchRoomDelete()            // Watches for room additions and deletions
-	go WatchRoomUserParticipation() // Watches for user participation (join/leave)
-	go WatchRoomMessages()
-	go WatchRoomGameChanges()
-
+	// Subscribe to the changes of the "rooms" and "games" tables that trigger broadcasts
+	changefeed.Subscribe("rooms", WatchRoomDelete)
+	changefeed.Subscribe("rooms", WatchRoomGameChanges)
+	changefeed.Subscribe("games", WatchRoomGames)
 }
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"norex/auth"
+	"norex/catalog"
+	"norex/engine"
+	"norex/models"
+	"norex/store"
+)
+
+// recordMatch keeps a finished game in the match history, finishes its
+// games row and counts the wins of its winners. It returns the finished
+// games row, or an error when the game was not started or is already
+// finished.
+func recordMatch(result engine.Result) (models.Game, error) {
+	ctx := context.Background()
+
+	won := make(map[string]bool, len(result.Winners))
+	for _, email := range result.Winners {
+		won[email] = true
+	}
+	place := make(map[string]int, len(result.Players))
+	for i, group := range result.Standings {
+		for _, email := range group {
+			place[email] = i + 1
+		}
+	}
+
+	match := models.Match{
+		ID:        primitive.NewObjectID(),
+		RoomID:    result.RoomID,
+		Game:      result.GameKey,
+		Standings: result.Standings,
+		Moves:     result.Moves,
+		Duration:  result.Duration().Seconds(),
+		StartedAt: result.StartedAt,
+		EndedAt:   result.EndedAt,
+	}
+	for _, email := range result.Players {
+		outcome := models.OutcomeLoss
+		switch {
+		case len(result.Winners) == 0:
+			outcome = models.OutcomeDraw
+		case won[email]:
+			outcome = models.OutcomeWin
+		}
+		match.Players = append(match.Players, models.MatchPlayer{Email: email, Place: place[email], Outcome: outcome})
+	}
+
+	// A single winner is kept on the games row too
+	var winnerID *string
+	if len(result.Winners) == 1 {
+		winnerID = &result.Winners[0]
+	}
+	game, finishErr := store.Games().Finish(ctx, result.GameID, winnerID, match.ID.Hex())
+	if finishErr != nil {
+		log.Printf("Finishing game %s of room %s: %v", result.GameID, result.RoomID, finishErr)
+	}
+	match.Ranked = game.Ranked
+
+	if err := store.Matches().Create(ctx, match); err != nil {
+		log.Printf("Recording the match of room %s: %v", result.RoomID, err)
+	}
+
+	for _, email := range result.Winners {
+		user, err := store.Users().FindByEmail(ctx, email)
+		if err != nil {
+			log.Printf("Counting the win of %s: %v", email, err)
+			continue
+		}
+		// Stats have to exist before a field can be incremented in them
+		if err := auth.EnsureGameStats(ctx, &user); err != nil {
+			log.Printf("Counting the win of %s: %v", email, err)
+			continue
+		}
+		if err := store.Users().IncrementFields(ctx, email, map[string]int{"games." + result.GameKey + ".wins": 1}); err != nil {
+			log.Printf("Counting the win of %s: %v", email, err)
+		}
+	}
+	return game, finishErr
+}
+
+func encodeMatchCursor(match models.Match) string {
+	data, _ := json.Marshal(store.MatchCursor{EndedAt: match.EndedAt, ID: match.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeMatchCursor(cursor string) (*store.MatchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var decoded store.MatchCursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return &decoded, nil
+}
+
+// matchQuery reads the page size and the ?before= cursor of a match
+// history request.
+func matchQuery(c *fiber.Ctx) (int, *store.MatchCursor, error) {
+	limit, err := historyLimit(c)
+	if err != nil {
+		return 0, nil, err
+	}
+	var before *store.MatchCursor
+	if cursor := c.Query("before"); cursor != "" {
+		if before, err = decodeMatchCursor(cursor); err != nil {
+			return 0, nil, errors.New("Invalid before cursor")
+		}
+	}
+	return limit, before, nil
+}
+
+// matchPage answers a page of match history. A full page means there may
+// be older matches.
+func matchPage(c *fiber.Ctx, matches []models.Match, limit int) error {
+	if matches == nil {
+		matches = []models.Match{}
+	}
+	response := fiber.Map{"matches": matches}
+	if len(matches) == limit {
+		response["nextCursor"] = encodeMatchCursor(matches[len(matches)-1])
+	}
+	return c.JSON(response)
+}
+
+// GetMatchHistory returns the matches the caller played, newest first,
+// only those of one game with ?game=. Pass the nextCursor of a page as
+// ?before= to get the matches before it.
+func GetMatchHistory(c *fiber.Ctx) error {
+	email := c.Locals("email").(string)
+	limit, before, err := matchQuery(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var gameKey string
+	if name := c.Query("game"); name != "" {
+		game, ok := catalog.Lookup(name)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Game not found"})
+		}
+		gameKey = game.Key
+	}
+
+	matches, err := store.Matches().ListByUser(c.Context(), email, gameKey, before, limit)
+	if err != nil {
+		log.Println("Error fetching matches:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error fetching matches"})
+	}
+	return matchPage(c, matches, limit)
+}
+
+// GetGameMatches returns the latest matches of a game, newest first, paged
+// like GetMatchHistory.
+func GetGameMatches(c *fiber.Ctx) error {
+	game, ok := catalog.Lookup(c.Params("game_name"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Game not found"})
+	}
+	limit, before, err := matchQuery(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	matches, err := store.Matches().ListByGame(c.Context(), game.Key, before, limit)
+	if err != nil {
+		log.Println("Error fetching matches:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error fetching matches"})
+	}
+	return matchPage(c, matches, limit)
+}
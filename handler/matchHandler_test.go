@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"norex/engine"
+	_ "norex/games/chess"
+	"norex/models"
+	"norex/store"
+)
+
+var registerResults sync.Once
+
+// useMemoryStores gives a test empty in-memory stores and the given users.
+func useMemoryStores(t *testing.T, users ...models.User) {
+	t.Helper()
+	store.Use(store.NewMemoryStores())
+	for _, user := range users {
+		if err := store.Users().Create(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registerResults.Do(StartGameResults)
+}
+
+func TestGameOverAtDealIsRecorded(t *testing.T) {
+	white := models.User{Email: "white@example.com", Name: "White"}
+	black := models.User{Email: "black@example.com", Name: "Black"}
+	useMemoryStores(t, white, black)
+
+	// Fool's mate: white is already checkmated
+	room, err := createRoom(models.Room{
+		GameName: "chess",
+		Capacity: 2,
+		Options:  engine.Options{"fen": "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3"},
+	}, white)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := takeSeat(room, black); err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Stop(room.ID)
+	if err := startRoomGame(room); err != nil {
+		t.Fatal(err)
+	}
+
+	var matches []models.Match
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		matches, err = store.Matches().ListByGame(context.Background(), "chess", nil, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) > 0 {
+			break
+		}
+	}
+	if len(matches) != 1 {
+		t.Fatalf("%d matches recorded, want 1", len(matches))
+	}
+	match := matches[0]
+	if match.RoomID != room.ID || match.Moves != 0 {
+		t.Fatalf("match = %+v, want room %s with no moves", match, room.ID)
+	}
+	for _, player := range match.Players {
+		want := models.OutcomeLoss
+		if player.Email == black.Email {
+			want = models.OutcomeWin
+		}
+		if player.Outcome != want {
+			t.Errorf("%s: outcome %s, want %s", player.Email, player.Outcome, want)
+		}
+	}
+
+	// Recording ends with the casual rating of black, wait for it before
+	// the stores go away
+	var changes []models.RatingChange
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		changes, err = store.Ratings().ListByUser(context.Background(), black.Email, "chess", time.Time{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) > 0 {
+			break
+		}
+	}
+	if len(changes) != 1 || changes[0].Ranked || changes[0].Change <= 0 {
+		t.Fatalf("rating history of the winner = %+v, want one casual gain", changes)
+	}
+	user, err := store.Users().FindByEmail(context.Background(), black.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := user.Games["chess"]; stats.Wins != 1 || stats.Rating != 0 || stats.CasualRating <= models.DefaultRating {
+		t.Fatalf("stats of the winner = %+v, want a win and only the casual rating up", stats)
+	}
+}
+
+func TestRankedGameRatedAfterRoomDeleted(t *testing.T) {
+	white := models.User{Email: "white@example.com", Name: "White"}
+	black := models.User{Email: "black@example.com", Name: "Black"}
+	useMemoryStores(t, white, black)
+
+	room, err := createRoom(models.Room{
+		GameName: "chess",
+		Capacity: 2,
+		Ranked:   true,
+		Options:  engine.Options{"fen": "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3"},
+	}, white)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := takeSeat(room, black); err != nil {
+		t.Fatal(err)
+	}
+	if err := startRoomGame(room); err != nil {
+		t.Fatal(err)
+	}
+	// The owner leaves as the game ends
+	deleteRoomFromDatabase(room.ID)
+
+	var changes []models.RatingChange
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		changes, err = store.Ratings().ListByUser(context.Background(), black.Email, "chess", time.Time{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) > 0 {
+			break
+		}
+	}
+	if len(changes) != 1 || !changes[0].Ranked || changes[0].Change <= 0 {
+		t.Fatalf("rating history of the winner = %+v, want one ranked gain", changes)
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"norex/catalog"
+	"norex/models"
+	"norex/store"
+)
+
+// quickJoinCandidates is how many open rooms quick-join tries before it
+// opens a new one
+const quickJoinCandidates = 10
+
+// QuickJoin seats the caller in an unlocked room of a game with a free seat,
+// a minLevel they meet and no game in progress, the fullest first, or opens
+// a new public room for them when there is none.
+func QuickJoin(c *fiber.Ctx) error {
+	game, ok := catalog.Lookup(c.Params("game_name"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Game not found"})
+	}
+	userEmail := c.Locals("email").(string)
+
+	user, err := store.Users().FindByEmail(context.TODO(), userEmail)
+	if err != nil {
+		log.Printf("Failed to fetch user data for email %s: %v", userEmail, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "User not found"})
+	}
+	level := user.Games[game.Key].Level
+
+	participationMu.Lock()
+	defer participationMu.Unlock()
+
+	unlocked := false
+	rooms, err := store.Rooms().Search(context.TODO(), store.RoomQuery{
+		GameName:   game.Key,
+		Locked:     &unlocked,
+		FreeSeats:  true,
+		MinLevelTo: max(level, catalog.MinLevel),
+		Sort:       store.SortFullest,
+		Limit:      quickJoinCandidates,
+	})
+	if err != nil {
+		log.Println("Error fetching rooms:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error fetching rooms"})
+	}
+
+	for _, room := range rooms {
+		if level < room.MinLevel {
+			continue
+		}
+		// A room may fill up between the search and the claim, and rooms
+		// playing a game take no new players
+		switch err := takeSeat(room, user); err {
+		case nil, errAlreadySeated:
+			return c.JSON(fiber.Map{"status": "user participated", "roomId": room.ID, "created": false})
+		case store.ErrFull, store.ErrNotFound, errGameInProgress:
+			continue
+		default:
+			log.Println("Error taking seat:", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to participate"})
+		}
+	}
+
+	// Every room is full: open a public one with the game's defaults
+	room, err := createRoom(models.Room{
+		GameName:   game.Key,
+		TextChatOn: game.TextChat,
+		Capacity:   game.DefaultCapacity(),
+	}, user)
+	if err != nil {
+		log.Println("Error creating room:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create room"})
+	}
+	return c.JSON(fiber.Map{"status": "user participated", "roomId": room.ID, "created": true})
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"norex/catalog"
+	"norex/hub"
+	"norex/matchmaking"
+	"norex/models"
+	"norex/store"
+)
+
+// rankedListener forwards what happens to a queue ticket to its socket
+type rankedListener struct {
+	client *hub.Client
+}
+
+func (l rankedListener) QueueStatus(status matchmaking.Status) {
+	data := fiber.Map{
+		"game":          status.Game,
+		"position":      status.Position,
+		"queued":        status.Queued,
+		"tolerance":     status.Tolerance,
+		"waitedSeconds": status.Waited,
+	}
+	if status.EstimatedWait != nil {
+		data["estimatedWaitSeconds"] = *status.EstimatedWait
+	}
+	sendToClient(l.client, "queue_status", data)
+}
+
+func (l rankedListener) Matched(roomID string) {
+	sendToClient(l.client, "match_found", fiber.Map{"roomId": roomID})
+}
+
+func (l rankedListener) MatchFailed(err error, requeued bool) {
+	if requeued {
+		sendToClient(l.client, "queue_error", fiber.Map{"error": "Could not set up the match, you are back in the queue", "requeued": true})
+		return
+	}
+	sendToClient(l.client, "queue_error", fiber.Map{"error": "Could not set up the match, please queue again"})
+}
+
+// HandleRankedQueue keeps the caller in the ranked queue of a game while
+// the socket is open. The client sends {"type": "cancel"} to leave it.
+func HandleRankedQueue(c *websocket.Conn) {
+	email, _ := c.Locals("email").(string)
+	client := hub.Register(c, email)
+	defer client.Close() // remove client on disconnect
+
+	game, ok := catalog.Lookup(c.Params("game_name"))
+	if !ok {
+		sendToClient(client, "queue_error", fiber.Map{"error": "Game not found"})
+		return
+	}
+	user, err := store.Users().FindByEmail(context.Background(), email)
+	if err != nil {
+		log.Printf("Failed to fetch user data for email %s: %v", email, err)
+		sendToClient(client, "queue_error", fiber.Map{"error": "User not found"})
+		return
+	}
+
+	ticket := &matchmaking.Ticket{
+		UserID:   email,
+		Rating:   user.Games[game.Key].CurrentRating(),
+		Listener: rankedListener{client: client},
+	}
+	if err := matchmaking.Join(game, ticket); err != nil {
+		sendToClient(client, "queue_error", fiber.Map{"error": err.Error()})
+		return
+	}
+	defer matchmaking.Leave(ticket) // leave the queue on disconnect
+	sendToClient(client, "queue_joined", fiber.Map{
+		"game":    game.Key,
+		"players": matchmaking.MatchSize(game),
+		"rating":  ticket.Rating,
+	})
+
+	for {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Println("WebSocket error:", err)
+			}
+			break
+		}
+
+		var message struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(msg, &message); err != nil || message.Type != "cancel" {
+			sendToClient(client, "queue_error", fiber.Map{"error": "Unknown message type"})
+			continue
+		}
+		if matchmaking.Leave(ticket) {
+			sendToClient(client, "queue_left", fiber.Map{"game": game.Key})
+		}
+	}
+}
+
+// setUpRankedMatch opens a ranked room for a group of queued players, the
+// one who waited the longest as its owner, and starts the game.
+func setUpRankedMatch(game catalog.Game, players []*matchmaking.Ticket) (string, error) {
+	users := make([]models.User, len(players))
+	for i, player := range players {
+		user, err := store.Users().FindByEmail(context.TODO(), player.UserID)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", player.UserID, err)
+		}
+		users[i] = user
+	}
+
+	participationMu.Lock()
+	room, err := createRoom(models.Room{
+		GameName:   game.Key,
+		TextChatOn: game.TextChat,
+		Capacity:   len(users),
+		Ranked:     true,
+	}, users[0])
+	if err == nil {
+		for _, user := range users[1:] {
+			if err = takeSeat(room, user); err != nil {
+				break
+			}
+		}
+	}
+	participationMu.Unlock()
+	if err == nil {
+		err = startRoomGame(room)
+	}
+	if err != nil {
+		// createRoom returns no ID when it stored nothing
+		if room.ID != "" {
+			deleteRoomFromDatabase(room.ID)
+		}
+		return "", err
+	}
+	return room.ID, nil
+}
+
+// StartRankedQueues starts matching the players of the ranked queues.
+func StartRankedQueues() {
+	matchmaking.Start(setUpRankedMatch)
+}
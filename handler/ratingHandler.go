@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"norex/auth"
+	"norex/catalog"
+	"norex/engine"
+	"norex/models"
+	"norex/rating"
+	"norex/store"
+	"time"
+)
+
+// maxRatingAttempts bounds the retries of a rating update that raced with
+// another game of the same player
+const maxRatingAttempts = 5
+
+// recordRatings rates every player of a finished game, updates their level
+// and keeps the change in their rating history. Ranked games change the
+// ranked rating and casual games the casual one. ranked comes from the
+// games row, as the room may be gone by the time the game is recorded.
+func recordRatings(result engine.Result, ranked bool) {
+	if len(result.Players) < 2 {
+		return // nobody to be rated against
+	}
+	ctx := context.Background()
+
+	before := make(map[string]rating.Player, len(result.Players))
+	for _, email := range result.Players {
+		user, err := store.Users().FindByEmail(ctx, email)
+		if err != nil {
+			log.Printf("Rating %s of room %s: reading %s: %v", result.GameKey, result.RoomID, email, err)
+			return
+		}
+		// Stats have to exist before single fields can be set in them
+		if err := auth.EnsureGameStats(ctx, &user); err != nil {
+			log.Printf("Rating %s of room %s: filling stats of %s: %v", result.GameKey, result.RoomID, email, err)
+			return
+		}
+		before[email] = rating.FromStats(user.Games[result.GameKey], ranked)
+	}
+
+	// Players missing from the standings come last
+	place := make(map[string]int, len(result.Players))
+	for _, email := range result.Players {
+		place[email] = len(result.Standings) + 1
+	}
+	for i, group := range result.Standings {
+		for _, email := range group {
+			place[email] = i + 1
+		}
+	}
+
+	changes := fiber.Map{}
+	for _, email := range result.Players {
+		outcomes := rating.Outcomes(email, before, result.Standings)
+		stats, previous, err := rateUser(ctx, result.GameKey, email, ranked, outcomes)
+		if err != nil {
+			log.Printf("Rating %s of room %s: updating %s: %v", result.GameKey, result.RoomID, email, err)
+			continue
+		}
+		rated := rating.FromStats(stats, ranked)
+
+		change := models.RatingChange{
+			Email:      email,
+			Game:       result.GameKey,
+			RoomID:     result.RoomID,
+			Place:      place[email],
+			Players:    len(result.Players),
+			Rating:     rated.Rating,
+			Deviation:  rated.Deviation,
+			Volatility: rated.Volatility,
+			Change:     rated.Rating - previous.Rating,
+			Level:      stats.Level,
+			Ranked:     ranked,
+			CreatedAt:  result.EndedAt,
+		}
+		if err := store.Ratings().Create(ctx, change); err != nil {
+			log.Printf("Rating %s of room %s: recording history of %s: %v", result.GameKey, result.RoomID, email, err)
+		}
+		changes[email] = fiber.Map{"rating": change.Rating, "change": change.Change, "level": change.Level}
+	}
+
+	broadcastToRoom(result.RoomID, "ratings_updated", fiber.Map{"game": result.GameKey, "ranked": ranked, "players": changes})
+}
+
+// rateUser applies the outcomes of a game to a user's current ranked or
+// casual rating and returns the new stats with the rating they replaced.
+// The update only goes through while the ratings it started from are still
+// stored, and is retried otherwise, so two games ending at once can not
+// undo each other.
+func rateUser(ctx context.Context, game, email string, ranked bool, outcomes []rating.Outcome) (models.GameStats, rating.Player, error) {
+	prefix := "games." + game + "."
+	fields := [3]string{"rating", "rd", "volatility"}
+	if !ranked {
+		fields = [3]string{"casualRating", "casualRd", "casualVolatility"}
+	}
+	for attempt := 1; ; attempt++ {
+		user, err := store.Users().FindByEmail(ctx, email)
+		if err != nil {
+			return models.GameStats{}, rating.Player{}, err
+		}
+		stored := user.Games[game]
+		current := rating.FromStats(stored, ranked)
+
+		stats := stored
+		current.Update(outcomes).Apply(&stats, ranked)
+		rated := rating.FromStats(stats, ranked)
+
+		// The level depends on both ratings. Unrated players have none of
+		// the fields stored.
+		match := map[string]interface{}{}
+		for field, value := range map[string]float64{
+			"rating":       stored.Rating,
+			"rd":           stored.RatingDeviation,
+			"casualRating": stored.CasualRating,
+			"casualRd":     stored.CasualRatingDeviation,
+		} {
+			match[prefix+field] = nil
+			if value != 0 {
+				match[prefix+field] = value
+			}
+		}
+		updated, err := store.Users().UpdateFieldsIf(ctx, email, match, map[string]interface{}{
+			prefix + fields[0]: rated.Rating,
+			prefix + fields[1]: rated.Deviation,
+			prefix + fields[2]: rated.Volatility,
+			prefix + "level":   stats.Level,
+		})
+		if err != nil {
+			return models.GameStats{}, rating.Player{}, err
+		}
+		if updated {
+			return stats, current, nil
+		}
+		if attempt == maxRatingAttempts {
+			return models.GameStats{}, rating.Player{}, errors.New("the rating kept changing during the update")
+		}
+	}
+}
+
+// StartGameResults makes every finished game recorded in the match history
+// and update the stats of its players.
+func StartGameResults() {
+	engine.OnGameOver(func(result engine.Result) {
+		game, err := recordMatch(result)
+		if err != nil {
+			return // not this game's first result, or its row is unknown
+		}
+		recordRatings(result, game.Ranked)
+	})
+}
+
+// GetRatingHistory returns the caller's rating in a game and its history,
+// newest first. Pass the nextCursor of a page as ?before= to get the
+// changes before it.
+func GetRatingHistory(c *fiber.Ctx) error {
+	email := c.Locals("email").(string)
+	game, ok := catalog.Lookup(c.Params("game_name"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Game not found"})
+	}
+
+	limit, before, err := historyPage(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user, err := store.Users().FindByEmail(c.Context(), email)
+	if err != nil {
+		log.Printf("Failed to fetch user data for email %s: %v", email, err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	stats := user.Games[game.Key]
+	current := rating.FromStats(stats, true)
+	casual := rating.FromStats(stats, false)
+
+	changes, err := store.Ratings().ListByUser(c.Context(), email, game.Key, before, limit)
+	if err != nil {
+		log.Println("Error fetching rating history:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error fetching rating history"})
+	}
+	if changes == nil {
+		changes = []models.RatingChange{}
+	}
+
+	response := fiber.Map{
+		"game":         game.Key,
+		"rating":       current.Rating,
+		"rd":           current.Deviation,
+		"casualRating": casual.Rating,
+		"casualRd":     casual.Deviation,
+		"level":        rating.StatsLevel(stats),
+		"history":      changes,
+	}
+	// A full page means there may be older changes
+	if len(changes) == limit {
+		response["nextCursor"] = changes[len(changes)-1].CreatedAt.Format(time.RFC3339Nano)
+	}
+	return c.JSON(response)
+}
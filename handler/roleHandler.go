@@ -3,10 +3,9 @@ package handler
 import (
 	"context"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"norex/database"
 	"norex/models"
+	"norex/store"
 )
 
 func CreateRole(c *fiber.Ctx) error {
@@ -17,8 +16,7 @@ func CreateRole(c *fiber.Ctx) error {
 
 	role.ID = primitive.NewObjectID() // Automatically generate ObjectID
 
-	collection := database.GetCollection("roles")
-	_, err := collection.InsertOne(context.TODO(), role)
+	err := store.Roles().Create(context.TODO(), role)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create role"})
 	}
@@ -33,9 +31,7 @@ func GetRole(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid role ID"})
 	}
 
-	collection := database.GetCollection("roles")
-	var role models.Role
-	err = collection.FindOne(context.TODO(), bson.M{"_id": objectID}).Decode(&role)
+	role, err := store.Roles().FindByID(context.TODO(), objectID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Role not found"})
 	}
@@ -55,8 +51,7 @@ func UpdateRole(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	collection := database.GetCollection("roles")
-	_, err = collection.UpdateOne(context.TODO(), bson.M{"_id": objectID}, bson.M{"$set": updatedRole})
+	err = store.Roles().Update(context.TODO(), objectID, updatedRole)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update role"})
 	}
@@ -71,8 +66,7 @@ func DeleteRole(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid role ID"})
 	}
 
-	collection := database.GetCollection("roles")
-	_, err = collection.DeleteOne(context.TODO(), bson.M{"_id": objectID})
+	err = store.Roles().Delete(context.TODO(), objectID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete role"})
 	}
@@ -81,17 +75,10 @@ func DeleteRole(c *fiber.Ctx) error {
 }
 
 func ListRoles(c *fiber.Ctx) error {
-	collection := database.GetCollection("roles")
-	cursor, err := collection.Find(context.TODO(), bson.M{})
+	roles, err := store.Roles().List(context.TODO())
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch roles"})
 	}
-	defer cursor.Close(context.TODO())
-
-	var roles []models.Role
-	if err = cursor.All(context.TODO(), &roles); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse roles"})
-	}
 
 	return c.JSON(roles)
 }
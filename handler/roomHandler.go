@@ -2,19 +2,24 @@ package handler
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
-	"gopkg.in/rethinkdb/rethinkdb-go.v6"
 	"log"
 	"math/rand"
-	"norex/database" // Adjust the import path according to your project structure
+	"norex/catalog"
+	"norex/changefeed"
+	"norex/engine"
+	"norex/hub"
 	"norex/models"
+	"norex/store"
+	"strconv"
 	"strings"
+	"time"
 )
 
-var gameClients = make(map[string]map[*websocket.Conn]bool) // connected clients grouped by game
-
 func generateRoomID() string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	b := make([]byte, 9)
@@ -24,81 +29,223 @@ func generateRoomID() string {
 	return string(b)
 }
 
+// maxRoomIDAttempts bounds the retries when a generated room ID is taken
+const maxRoomIDAttempts = 5
+
 func CreateRoom(c *fiber.Ctx) error {
-	var room struct {
-		RoomID       string `json:"roomId"`
-		GameName     string `json:"gameName"`
-		IsLocked     bool   `json:"isLocked"`
-		RoomPassword string `json:"roomPassword"`
-		VoiceChatOn  bool   `json:"voiceChatOn"`
-		TextChatOn   bool   `json:"textChatOn"`
-		MinLevel     int    `json:"minLevel"`
-		UserEmail    string `json:"userEmail"`
-		Avatar       string `json:"avatar"`
-		Name         string `json:"name"`
-		Capacity     int    `json:"capacity"`
-	}
-
-	// Generate a unique RoomID
-	room.RoomID = generateRoomID()
+	var request struct {
+		GameName     string              `json:"gameName"`
+		IsLocked     bool                `json:"isLocked"`
+		RoomPassword string              `json:"roomPassword"`
+		VoiceChatOn  bool                `json:"voiceChatOn"`
+		TextChatOn   bool                `json:"textChatOn"`
+		MinLevel     int                 `json:"minLevel"`
+		Capacity     int                 `json:"capacity"`
+		TimeControl  *engine.TimeControl `json:"timeControl"`
+		Options      engine.Options      `json:"options"`
+	}
 
 	// Get the user's email from c.Locals
 	email := c.Locals("email").(string)
 
 	// Fetch the user ID from MongoDB using the email
-	var user models.User
-	if err := database.GetCollection("users").FindOne(context.TODO(), bson.M{"email": email}).Decode(&user); err != nil {
+	user, err := store.Users().FindByEmail(context.TODO(), email)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to find user"})
 	}
-	room.UserEmail = email
-	room.Avatar = user.Avatar
-	room.Name = user.Name
 
 	// Parse the JSON body
-	if err := c.BodyParser(&room); err != nil {
+	if err := c.BodyParser(&request); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	// Get the RethinkDB session
-	session := database.GetRethinkSession()
+	room := models.Room{
+		GameName:     strings.ToLower(request.GameName),
+		IsLocked:     request.IsLocked,
+		RoomPassword: request.RoomPassword,
+		VoiceChatOn:  request.VoiceChatOn,
+		TextChatOn:   request.TextChatOn,
+		MinLevel:     request.MinLevel,
+		Capacity:     request.Capacity,
+		TimeControl:  request.TimeControl,
+		Options:      request.Options,
+	}
+	if errs := catalog.ValidateRoom(room, 1); errs != nil {
+		return invalidRoomSettings(c, errs)
+	}
 
-	// Insert the room into RethinkDB
-	_, err := rethinkdb.Table("rooms").Insert(room).Run(session)
+	room, err = createRoom(room, user)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create room " + err.Error()})
 	}
 
-	return c.JSON(fiber.Map{"message": "Room created successfully", "roomId": room.RoomID, "gameName": room.GameName})
+	return c.JSON(fiber.Map{"message": "Room created successfully", "roomId": room.ID, "gameName": room.GameName})
 }
 
-func GetGameRooms(c *fiber.Ctx) error {
-	gameName := c.Params("game_name")
+// createRoom stores a room with the given settings under a new ID, owned
+// by user, who takes the first seat. On error nothing is left stored and
+// the returned room is zero, so callers never clean up a room that is not
+// theirs.
+func createRoom(room models.Room, user models.User) (models.Room, error) {
+	// Milliseconds are all RethinkDB keeps, and the lobby pages by them
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	room.Participants = 1 // the owner
+	room.UserEmail = user.Email
+	room.Avatar = user.Avatar
+	room.Name = user.Name
+	room.CreatedAt = now
+	room.UpdatedAt = now
+
+	// Insert the room under a unique ID
+	var err error
+	for attempt := 1; ; attempt++ {
+		room.ID = generateRoomID()
+		err = store.Rooms().Create(context.TODO(), room)
+		if err != store.ErrDuplicate || attempt == maxRoomIDAttempts {
+			break
+		}
+	}
+	if err != nil {
+		return models.Room{}, err
+	}
 
-	// Always fetch with 0 offset and max 50 limit
-	const offset = 0
-	const limit = 50
-
-	// Query the rooms based on gameName, with fixed offset and limit
-	cursor, err := rethinkdb.Table("rooms").
-		Filter(rethinkdb.Row.Field("GameName").Eq(gameName)).
-		Without("RoomPassword"). // Exclude specific fields
-		Skip(offset).
-		Limit(limit).
-		Run(database.GetRethinkSession())
+	// The owner always participates in their own room
+	_, err = store.Participations().Create(context.TODO(), models.Participation{
+		RoomID:     room.ID,
+		UserID:     user.Email,
+		UserName:   user.Name,
+		UserAvatar: user.Avatar,
+		UserLevel:  user.Games[room.GameName].Level,
+		CreatedAt:  now,
+	})
 	if err != nil {
-		log.Println("RethinkDB error:", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error fetching rooms"})
+		store.Rooms().Delete(context.TODO(), room.ID)
+		return models.Room{}, err
+	}
+	return room, nil
+}
+
+// invalidRoomSettings rejects a request with the error of every invalid field
+func invalidRoomSettings(c *fiber.Ctx, errs catalog.FieldErrors) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid room settings", "fields": errs})
+}
+
+const (
+	defaultRoomPageSize = 20
+	maxRoomPageSize     = 50
+)
+
+// roomCursor is the opaque cursor of a lobby page, tied to its sort order
+type roomCursor struct {
+	Sort store.RoomSort `json:"s"`
+	store.RoomCursor
+}
+
+func encodeRoomCursor(sort store.RoomSort, room models.Room) string {
+	data, _ := json.Marshal(roomCursor{Sort: sort, RoomCursor: store.RoomCursor{Value: sort.Value(room), ID: room.ID}})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeRoomCursor(cursor string, sort store.RoomSort) (*store.RoomCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var decoded roomCursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	if decoded.Sort != sort {
+		return nil, fmt.Errorf("cursor of sort %q used with sort %q", decoded.Sort, sort)
+	}
+	return &decoded.RoomCursor, nil
+}
+
+// queryFlag reads an optional true/false query parameter
+func queryFlag(c *fiber.Ctx, key string) (*bool, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", key)
+	}
+	return &flag, nil
+}
+
+// GetGameRooms searches the lobby of a game. Query parameters:
+//   - locked, voiceChat, textChat: true or false to filter on the setting
+//   - freeSeats=true: only rooms that can still seat someone
+//   - minLevelFrom, minLevelTo: bounds of the rooms' minLevel
+//   - forMe=true: only rooms the caller's level lets them join
+//   - sort: newest (default), fullest, or level (joinable rooms closest to
+//     the caller's level first)
+//   - limit (up to 50) and cursor, the nextCursor of the previous page
+func GetGameRooms(c *fiber.Ctx) error {
+	gameName := strings.ToLower(c.Params("game_name"))
+	if _, ok := catalog.Lookup(gameName); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Game not found"})
+	}
+
+	query := store.RoomQuery{
+		GameName:     gameName,
+		FreeSeats:    c.Query("freeSeats") == "true",
+		MinLevelFrom: c.QueryInt("minLevelFrom"),
+		MinLevelTo:   c.QueryInt("minLevelTo"),
+		Sort:         store.RoomSort(c.Query("sort", string(store.SortNewest))),
+		Limit:        c.QueryInt("limit", defaultRoomPageSize),
+	}
+	if query.Sort != store.SortNewest && query.Sort != store.SortFullest && query.Sort != store.SortLevel {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "sort must be newest, fullest or level"})
+	}
+	if query.Limit <= 0 || query.Limit > maxRoomPageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("limit must be between 1 and %d", maxRoomPageSize)})
+	}
+	var err error
+	if query.Locked, err = queryFlag(c, "locked"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if query.VoiceChat, err = queryFlag(c, "voiceChat"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if query.TextChat, err = queryFlag(c, "textChat"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		if query.After, err = decodeRoomCursor(cursor, query.Sort); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+		}
 	}
-	defer cursor.Close()
 
-	var rooms []map[string]interface{}
-	err = cursor.All(&rooms)
+	// Only rooms whose minLevel the caller meets
+	if c.Query("forMe") == "true" || query.Sort == store.SortLevel {
+		user, err := store.Users().FindByEmail(context.TODO(), c.Locals("email").(string))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to find user"})
+		}
+		// Users without stats in the game yet have level 0, which the store
+		// reads as no bound
+		if level := max(user.Games[gameName].Level, catalog.MinLevel); query.MinLevelTo == 0 || query.MinLevelTo > level {
+			query.MinLevelTo = level
+		}
+	}
+
+	rooms, err := store.Rooms().Search(context.TODO(), query)
 	if err != nil {
 		log.Println("Error fetching rooms:", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error fetching rooms"})
 	}
+	if rooms == nil {
+		rooms = []models.Room{}
+	}
 
-	return c.JSON(rooms)
+	// A full page means there may be more rooms
+	response := fiber.Map{"rooms": rooms}
+	if len(rooms) == query.Limit {
+		response["nextCursor"] = encodeRoomCursor(query.Sort, rooms[len(rooms)-1])
+	}
+	return c.JSON(response)
 }
 
 func HandleNewGameRoom(c *websocket.Conn) {
@@ -106,133 +253,90 @@ func HandleNewGameRoom(c *websocket.Conn) {
 	gameName := c.Params("game_name")
 	gameName = strings.ToLower(gameName) // Normalize game name
 
-	// Initialize map for the game if not already done
-	if gameClients[gameName] == nil {
-		gameClients[gameName] = make(map[*websocket.Conn]bool)
-	}
-
-	// Add the client to the game-specific map
-	gameClients[gameName][c] = true
-	defer func() {
-		delete(gameClients[gameName], c) // remove client on disconnect
-		c.Close()
-	}()
+	// Subscribe the client to the game-specific topic
+	email, _ := c.Locals("email").(string)
+	client := hub.Register(c, email)
+	client.Subscribe(hub.GameTopic(gameName))
+	defer client.Close() // remove client on disconnect
 
 	// Keep listening to broadcast messages
 	for {
 		_, _, err := c.ReadMessage()
 		if err != nil {
-			log.Println("WebSocket error:", err)
-			delete(gameClients[gameName], c)
-			c.Close()
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Println("WebSocket error:", err)
+			}
 			break
 		}
 	}
 }
 
 // Broadcast new room addition
-func broadcastNewRoomByGame(gameName string, newRoom map[string]interface{}) {
-	for client := range gameClients[gameName] {
-		if err := client.WriteJSON(fiber.Map{
-			"eventType": "added", // Event type: room added
-			"newRoom":   newRoom, // Full room details
-		}); err != nil {
-			log.Println("Error broadcasting to client:", err)
-			client.Close()
-			delete(gameClients[gameName], client)
-		}
-	}
+func broadcastNewRoomByGame(gameName string, newRoom models.Room) {
+	hub.Publish(hub.GameTopic(gameName), fiber.Map{
+		"eventType": "added", // Event type: room added
+		"newRoom":   newRoom, // Full room details
+	})
 }
 
 // Broadcast room deletion
-func broadcastDeletedRoom(gameName string, roomDetails map[string]interface{}) {
-	for client := range gameClients[gameName] {
-		if err := client.WriteJSON(fiber.Map{
-			"eventType": "deleted", // Event type: room deleted
-			"room":      roomDetails,
-		}); err != nil {
-			log.Println("Error broadcasting to client:", err)
-			client.Close()
-			delete(gameClients[gameName], client)
-		}
-	}
+func broadcastDeletedRoom(gameName string, roomDetails models.Room) {
+	hub.Publish(hub.GameTopic(gameName), fiber.Map{
+		"eventType": "deleted", // Event type: room deleted
+		"room":      roomDetails,
+	})
 }
 
 // Broadcast room updates (changes)
-func broadcastRoomChange(gameName string, roomDetails map[string]interface{}) {
-	log.Println("Broadcast Changes")
-	for client := range gameClients[gameName] {
-		log.Println("Broadcast to " + client.RemoteAddr().String())
-
-		if err := client.WriteJSON(fiber.Map{
-			"eventType": "updated", // Event type: room updated
-			"room":      roomDetails,
-		}); err != nil {
-			log.Println("Error broadcasting to client:", err)
-			client.Close()
-			delete(gameClients[gameName], client)
-		}
-	}
+func broadcastRoomChange(gameName string, roomDetails models.Room) {
+	hub.Publish(hub.GameTopic(gameName), fiber.Map{
+		"eventType": "updated", // Event type: room updated
+		"room":      roomDetails,
+	})
 }
-func WatchRoomGameAddOrDelete() {
-	cursor, err := rethinkdb.Table("rooms").Changes().Run(database.GetRethinkSession())
-	if err != nil {
-		log.Println("RethinkDB error:", err)
-		return
-	}
-	defer cursor.Close()
-
-	var change map[string]interface{}
-	for cursor.Next(&change) {
-		// If new value exists but old value is nil, a new room was added
-		if newVal, newExists := change["new_val"].(map[string]interface{}); newExists && change["old_val"] == nil {
-			if gameName, exists := newVal["GameName"].(string); exists {
-				log.Printf("New room added for game: %s", gameName)
-				broadcastNewRoomByGame(strings.ToLower(gameName), newVal)
-			}
-		}
-
-		// If old value exists but new value is nil, a room was deleted
-		if oldVal, oldExists := change["old_val"].(map[string]interface{}); oldExists && change["new_val"] == nil {
-			if gameName, exists := oldVal["GameName"].(string); exists {
-				log.Printf("Room deleted for game: %s", gameName)
-				broadcastDeletedRoom(strings.ToLower(gameName), oldVal)
-			}
-		}
-	}
 
-	if err := cursor.Err(); err != nil {
-		log.Println("Cursor error:", err)
+// eventRoom decodes the room of a rooms table change
+func eventRoom(event changefeed.Event) (models.Room, bool) {
+	var room models.Room
+	if err := event.Decode(&room); err != nil {
+		log.Println("Error decoding room change:", err)
+		return room, false
 	}
+	return room, true
 }
 
-func WatchGameRoomChanges() {
-	cursor, err := rethinkdb.Table("rooms").Changes().Run(database.GetRethinkSession())
-	if err != nil {
-		log.Println("RethinkDB error:", err)
+func WatchRoomGameAddOrDelete(event changefeed.Event) {
+	room, ok := eventRoom(event)
+	if !ok || room.GameName == "" {
 		return
 	}
-	defer cursor.Close()
 
-	var change map[string]interface{}
-	for cursor.Next(&change) {
-		// If both new_val and old_val exist, it means a room was updated
-		if newVal, newExists := change["new_val"].(map[string]interface{}); newExists && change["old_val"] != nil {
-			if gameName, exists := newVal["GameName"].(string); exists {
-				log.Printf("Room updated for game: %s", gameName)
-				broadcastRoomChange(strings.ToLower(gameName), newVal) // Broadcast room update
-			}
-		}
+	switch event.Kind {
+	case changefeed.Insert:
+		// A new room was added
+		log.Printf("New room added for game: %s", room.GameName)
+		broadcastNewRoomByGame(room.GameName, room)
+	case changefeed.Delete:
+		// A room was deleted
+		log.Printf("Room deleted for game: %s", room.GameName)
+		broadcastDeletedRoom(room.GameName, room)
 	}
+}
 
-	if err := cursor.Err(); err != nil {
-		log.Println("Cursor error:", err)
+func WatchGameRoomChanges(event changefeed.Event) {
+	// Only updates of existing rooms
+	if event.Kind != changefeed.Update {
+		return
+	}
+	if room, ok := eventRoom(event); ok && room.GameName != "" {
+		log.Printf("Room updated for game: %s", room.GameName)
+		broadcastRoomChange(room.GameName, room) // Broadcast room update
 	}
 }
 
 func StartWebSocketServiceNewGameInfo() {
-	go WatchRoomGameAddOrDelete()
-	go WatchGameRoomChanges()
+	changefeed.Subscribe("rooms", WatchRoomGameAddOrDelete)
+	changefeed.Subscribe("rooms", WatchGameRoomChanges)
 }
 
 type RoomUpdate struct {
@@ -243,6 +347,10 @@ type RoomUpdate struct {
 	TextChatOn   *bool   `json:"textChatOn,omitempty"`
 	MinLevel     *int    `json:"minLevel,omitempty"`
 	Capacity     *int    `json:"capacity,omitempty"`
+
+	TimeControl *engine.TimeControl `json:"timeControl,omitempty"`
+	// Options are merged into the room's options; null resets one
+	Options engine.Options `json:"options,omitempty"`
 }
 
 func EditRoom(c *fiber.Ctx) error {
@@ -250,24 +358,17 @@ func EditRoom(c *fiber.Ctx) error {
 	userEmail := c.Locals("email").(string) // Get the authenticated user's email
 
 	// Fetch the room by ID
-	cursor, err := rethinkdb.Table("rooms").Get(roomID).Run(database.GetRethinkSession())
-	if err != nil {
-		log.Println("Error fetching room:", err)
+	room, err := store.Rooms().Get(context.TODO(), roomID)
+	if err == store.ErrNotFound {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
 	}
-	defer cursor.Close()
-
-	// Create a variable to hold the room data
-	var room map[string]interface{}
-
-	// Check if a room was found by attempting to read it
-	if err := cursor.One(&room); err != nil {
+	if err != nil {
 		log.Println("Error reading room:", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading room"})
 	}
 
 	// Check if the user is the owner of the room
-	if ownerID, exists := room["UserEmail"].(string); !exists || ownerID != userEmail {
+	if room.UserEmail != userEmail {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not authorized to edit this room"})
 	}
 
@@ -278,28 +379,51 @@ func EditRoom(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request data"})
 	}
 
-	// Convert struct to a map and remove nil fields for partial updates
+	// Convert struct to a map and remove nil fields for partial updates,
+	// applying them to a copy of the room to validate the result
 	updateMap := make(map[string]interface{})
+	updated := room
 	if updatedRoomData.GameName != nil {
-		updateMap["gameName"] = *updatedRoomData.GameName
+		updated.GameName = strings.ToLower(*updatedRoomData.GameName)
+		updateMap["gameName"] = updated.GameName
 	}
 	if updatedRoomData.IsLocked != nil {
-		updateMap["isLocked"] = *updatedRoomData.IsLocked
+		updated.IsLocked = *updatedRoomData.IsLocked
+		updateMap["isLocked"] = updated.IsLocked
 	}
 	if updatedRoomData.RoomPassword != nil {
-		updateMap["roomPassword"] = *updatedRoomData.RoomPassword
+		updated.RoomPassword = *updatedRoomData.RoomPassword
+		updateMap["roomPassword"] = updated.RoomPassword
 	}
 	if updatedRoomData.VoiceChatOn != nil {
-		updateMap["voiceChatOn"] = *updatedRoomData.VoiceChatOn
+		updated.VoiceChatOn = *updatedRoomData.VoiceChatOn
+		updateMap["voiceChatOn"] = updated.VoiceChatOn
 	}
 	if updatedRoomData.TextChatOn != nil {
-		updateMap["textChatOn"] = *updatedRoomData.TextChatOn
+		updated.TextChatOn = *updatedRoomData.TextChatOn
+		updateMap["textChatOn"] = updated.TextChatOn
 	}
 	if updatedRoomData.MinLevel != nil {
-		updateMap["minLevel"] = *updatedRoomData.MinLevel
+		updated.MinLevel = *updatedRoomData.MinLevel
+		updateMap["minLevel"] = updated.MinLevel
 	}
 	if updatedRoomData.Capacity != nil {
-		updateMap["capacity"] = *updatedRoomData.Capacity
+		updated.Capacity = *updatedRoomData.Capacity
+		updateMap["capacity"] = updated.Capacity
+	}
+	if updatedRoomData.TimeControl != nil {
+		updated.TimeControl = updatedRoomData.TimeControl
+		updateMap["timeControl"] = *updatedRoomData.TimeControl
+	}
+	if len(updatedRoomData.Options) > 0 {
+		updated.Options = engine.Options{}
+		for key, value := range room.Options {
+			updated.Options[key] = value
+		}
+		for key, value := range updatedRoomData.Options {
+			updated.Options[key] = value
+		}
+		updateMap["options"] = updated.Options
 	}
 
 	// Ensure there's something to update
@@ -307,8 +431,30 @@ func EditRoom(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No fields to update"})
 	}
 
+	// The game and the seats are fixed while a game is being played
+	if updatedRoomData.GameName != nil || updatedRoomData.Capacity != nil {
+		if gameInProgress(roomID) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The game and capacity can not be changed while a game is in progress"})
+		}
+	}
+
+	// Held so nobody takes a seat between counting the players and
+	// lowering the capacity
+	participationMu.Lock()
+	defer participationMu.Unlock()
+
+	// The capacity may not drop below the players already seated
+	participants, err := store.Participations().ListByRoom(context.TODO(), roomID)
+	if err != nil {
+		log.Println("Error reading participants:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading room"})
+	}
+	if errs := catalog.ValidateRoom(updated, len(participants)); errs != nil {
+		return invalidRoomSettings(c, errs)
+	}
+
 	// Update the room in the database
-	_, err = rethinkdb.Table("rooms").Get(roomID).Update(updateMap).RunWrite(database.GetRethinkSession())
+	err = store.Rooms().Update(context.TODO(), roomID, updateMap)
 	if err != nil {
 		log.Println("Error updating room:", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error updating room"})
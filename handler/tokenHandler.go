@@ -4,10 +4,8 @@ import (
 	"context"
 	"github.com/dgrijalva/jwt-go/v4"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
 	"norex/auth"
-	"norex/database"
-	"norex/models"
+	"norex/store"
 	"strings"
 )
 
@@ -59,9 +57,7 @@ func ValidateToken(c *fiber.Ctx) error {
 	}
 
 	// Fetch the user from the database using the email
-	collection := database.GetCollection("users")
-	var user models.User
-	err = collection.FindOne(context.TODO(), bson.M{"email": userEmail}).Decode(&user)
+	user, err := store.Users().FindByEmail(context.TODO(), userEmail)
 	if err != nil {
 		return c.JSON(fiber.Map{
 			"loggedIn": false,
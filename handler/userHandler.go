@@ -3,11 +3,9 @@ package handler
 import (
 	"context"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
-	"gopkg.in/rethinkdb/rethinkdb-go.v6"
 	"log"
-	"norex/database"
-	"norex/models"
+	"norex/auth"
+	"norex/store"
 )
 
 func GetAuthenticatedUser(c *fiber.Ctx) error {
@@ -15,13 +13,16 @@ func GetAuthenticatedUser(c *fiber.Ctx) error {
 	email := c.Locals("email").(string)
 
 	// Fetch the user details from the database
-	var user models.User
-	collection := database.GetCollection("users")
-	err := collection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
+	user, err := store.Users().FindByEmail(context.TODO(), email)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
+	// Games added since the user signed up start with default stats
+	if err := auth.EnsureGameStats(context.TODO(), &user); err != nil {
+		log.Println("Error adding game stats:", err)
+	}
+
 	// Calculate total level for all games
 	totalLevel := 0
 	gameCount := len(user.Games) // Assuming user.Games is a map or slice of game stats
@@ -37,31 +38,13 @@ func GetAuthenticatedUser(c *fiber.Ctx) error {
 		averageLevel = totalLevel / gameCount
 	}
 
-	// Fetch the game rooms count from RethinkDB
-	res, err := rethinkdb.Table("rooms").Run(database.GetRethinkSession())
-	if err != nil {
-		log.Println("RethinkDB error:", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error fetching game rooms"})
-	}
-	defer res.Close()
-
-	var rooms []struct {
-		GameName string `rethinkdb:"gameName"`
-	}
-
-	// Fetch all rooms into the slice
-	err = res.All(&rooms)
+	// Fetch the game rooms count
+	gameRoomCounts, err := store.Rooms().CountByGame(context.TODO())
 	if err != nil {
 		log.Println("Error fetching rooms:", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error fetching game rooms"})
 	}
 
-	// Manually aggregate rooms by gameName
-	gameRoomCounts := make(map[string]int)
-	for _, room := range rooms {
-		gameRoomCounts[room.GameName]++
-	}
-
 	// Prepare the user response
 	userResponse := fiber.Map{
 		"name":         user.Name,
@@ -0,0 +1,237 @@
+// Package hub keeps track of every open websocket and delivers events to
+// them. Each connection gets its own write pump fed by a buffered queue, so
+// handlers and watchers never write to a socket directly and a slow client
+// can not hold anyone else up: when its queue is full it is disconnected.
+package hub
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+)
+
+const (
+	// QueueSize is how many outbound messages a connection may have waiting
+	// before it is considered too slow and evicted.
+	QueueSize = 256
+	// WriteWait is how long a single write may take.
+	WriteWait = 10 * time.Second
+)
+
+// AllGamesTopic is the topic of the home screen listing every game.
+const AllGamesTopic = "all-games"
+
+// GameTopic is the topic of the lobby of one game, e.g. every uno room.
+func GameTopic(gameName string) string {
+	return "game:" + strings.ToLower(gameName)
+}
+
+// RoomTopic is the topic of everyone inside one room.
+func RoomTopic(roomID string) string {
+	return "room:" + roomID
+}
+
+// Socket is the part of a websocket connection the hub writes to.
+type Socket interface {
+	WriteMessage(messageType int, data []byte) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// Client is one registered connection.
+type Client struct {
+	socket Socket
+	userID string
+	send   chan []byte
+
+	// topics is guarded by the hub lock
+	topics map[string]bool
+
+	closeOnce sync.Once
+	done      chan struct{} // closed when the client is evicted or closed
+	stopped   chan struct{} // closed when the write pump has returned
+}
+
+var (
+	mu     sync.RWMutex
+	topics = make(map[string]map[*Client]bool)
+)
+
+// Register starts the write pump of a new connection. The caller must call
+// Close once the connection is done, before its handler returns.
+func Register(socket Socket, userID string) *Client {
+	c := &Client{
+		socket:  socket,
+		userID:  userID,
+		send:    make(chan []byte, QueueSize),
+		topics:  make(map[string]bool),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go c.writePump()
+	return c
+}
+
+// UserID returns the user the connection was registered for.
+func (c *Client) UserID() string {
+	return c.userID
+}
+
+// Subscribe adds the client to topics.
+func (c *Client) Subscribe(names ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	for _, name := range names {
+		if topics[name] == nil {
+			topics[name] = make(map[*Client]bool)
+		}
+		topics[name][c] = true
+		c.topics[name] = true
+	}
+}
+
+// Unsubscribe removes the client from a topic.
+func (c *Client) Unsubscribe(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c.unsubscribeLocked(name)
+}
+
+func (c *Client) unsubscribeLocked(name string) {
+	delete(topics[name], c)
+	if len(topics[name]) == 0 {
+		delete(topics, name)
+	}
+	delete(c.topics, name)
+}
+
+// Send queues v, encoded as JSON, for this connection only.
+func (c *Client) Send(v interface{}) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Error encoding socket message:", err)
+		return false
+	}
+	return c.enqueue(data)
+}
+
+// enqueue never blocks: a client whose queue is full is evicted.
+func (c *Client) enqueue(data []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- data:
+		return true
+	default:
+		log.Printf("Evicting slow socket client %q", c.userID)
+		c.evict()
+		return false
+	}
+}
+
+// Done is closed once the client has been evicted or closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// evict unsubscribes the client and closes its socket, which ends the read
+// loop of its handler. It is safe to call from any goroutine.
+func (c *Client) evict() {
+	c.closeOnce.Do(func() {
+		mu.Lock()
+		for name := range c.topics {
+			c.unsubscribeLocked(name)
+		}
+		close(c.done)
+		mu.Unlock()
+
+		c.socket.Close()
+	})
+}
+
+// Close evicts the client and waits for its write pump to return, so the
+// socket is not written to after the handler is done with it.
+func (c *Client) Close() {
+	c.evict()
+	<-c.stopped
+}
+
+func (c *Client) writePump() {
+	defer close(c.stopped)
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case data := <-c.send:
+			c.socket.SetWriteDeadline(time.Now().Add(WriteWait))
+			if err := c.socket.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Println("Error writing to socket:", err)
+				c.evict()
+				return
+			}
+		}
+	}
+}
+
+// Publish sends v to every client subscribed to a topic.
+func Publish(topic string, v interface{}) {
+	PublishWhere(topic, v, nil)
+}
+
+// PublishTo sends v to the clients of one user subscribed to a topic.
+func PublishTo(topic, userID string, v interface{}) {
+	PublishWhere(topic, v, func(id string) bool { return id == userID })
+}
+
+// PublishWhere sends v to the clients subscribed to a topic whose user
+// passes keep. A nil keep sends to everyone.
+func PublishWhere(topic string, v interface{}, keep func(userID string) bool) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Error encoding socket message:", err)
+		return
+	}
+
+	// Collect first: enqueue may evict, which takes the write lock
+	mu.RLock()
+	var targets []*Client
+	for c := range topics[topic] {
+		if keep == nil || keep(c.userID) {
+			targets = append(targets, c)
+		}
+	}
+	mu.RUnlock()
+
+	for _, c := range targets {
+		c.enqueue(data)
+	}
+}
+
+// Connected reports whether a user has any client subscribed to a topic.
+func Connected(topic, userID string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for c := range topics[topic] {
+		if c.userID == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -1,17 +1,38 @@
 package main
 
 import (
+	"context"
 	"github.com/goccy/go-json"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"log"
 	"norex/auth"
+	"norex/changefeed"
+	"norex/config"
 	"norex/database"
+	"norex/email"
+	_ "norex/games/chess"
+	_ "norex/games/crazyeights"
+	_ "norex/games/euchre"
+	_ "norex/games/gofish"
+	_ "norex/games/hearts"
+	_ "norex/games/memory"
+	_ "norex/games/spades"
+	_ "norex/games/uno"
 	"norex/handler"
 	"norex/middleware"
+	"norex/store"
 )
 
 func main() {
+	// Load configuration from NOREX_CONFIG_FILE and the environment
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	auth.Configure(cfg.JWT)
+	email.Configure(cfg.SMTP)
+
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
 		JSONEncoder: json.Marshal,
@@ -19,8 +40,21 @@ func main() {
 	})
 
 	// Connect to MongoDB
-	database.Connect()
-	database.ConnectRethinkDB()
+	database.Connect(cfg.Mongo)
+	database.ConnectRethinkDB(cfg.RethinkDB)
+	store.Use(store.NewDatabaseStores())
+
+	// Bring rooms stored by older versions into the current shape
+	migrated, err := store.MigrateRooms(context.Background())
+	if err != nil {
+		log.Fatal("Room migration failed: ", err)
+	}
+	if migrated > 0 {
+		log.Printf("Migrated %d rooms", migrated)
+	}
+	if err := store.EnsureRoomIndexes(context.Background()); err != nil {
+		log.Fatal("Creating room indexes failed: ", err)
+	}
 
 	//delete all the rows
 	//rethink.Table("rooms").Delete().RunWrite(database.GetRethinkSession())
@@ -32,6 +66,9 @@ func main() {
 	api.Post("/auth/verify-code", auth.VerifyCode)
 	api.Get("/auth/validate-token", handler.ValidateToken)
 
+	// Game catalog
+	api.Get("/games", handler.ListGames)
+
 	// Protected routes - Require JWT authentication
 	protected := api.Group("/protected", auth.JWTProtected())
 
@@ -62,9 +99,14 @@ func main() {
 	protected.Get("/rooms/:game_name", handler.GetGameRooms)
 	protected.Get("/participate/:game_id", handler.ParticipateInGame)
 	protected.Get("/participate/cancel/:game_id", handler.CancelParticipation)
+	protected.Post("/quick-join/:game_name", handler.QuickJoin)
 	protected.Post("/send-message/:game_id", handler.SendMessage)
+	protected.Get("/messages/:game_id", handler.GetRoomMessages)
 	protected.Post("/start-game/:game_id", handler.StartGame)
 	protected.Get("/room-information/:game_id", handler.GetRoomInformation)
+	protected.Get("/ratings/:game_name", handler.GetRatingHistory)
+	protected.Get("/matches", handler.GetMatchHistory)
+	protected.Get("/matches/:game_name", handler.GetGameMatches)
 	//protected.Get("/ws/game/:game_id", websocket.New(handler.HandleGameRoom)) // WebSocket for each game room
 
 	webSocket := protected.Use(func(c *fiber.Ctx) error {
@@ -78,10 +120,16 @@ func main() {
 	webSocket.Get("/all-games", websocket.New(handler.HandleGameRooms))
 	webSocket.Get("/game/:game_id", websocket.New(handler.HandleGameRoom))
 	webSocket.Get("/game/:game_name/ws", websocket.New(handler.HandleNewGameRoom))
+	webSocket.Get("/ranked/:game_name", websocket.New(handler.HandleRankedQueue))
 
 	handler.StartWebSocketService()
 	handler.StartWebSocketServiceNewGameInfo()
 	handler.StartWebSocketServiceGameRoom()
+	handler.StartRankedQueues()
+	handler.StartGameResults()
+	// Lobby sockets must converge on the current rooms after an outage
+	changefeed.Backfill("rooms")
+	changefeed.Start()
 
-	log.Fatal(app.Listen(":9990"))
+	log.Fatal(app.Listen(cfg.Server.Address))
 }
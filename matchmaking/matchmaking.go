@@ -0,0 +1,350 @@
+// Package matchmaking runs the ranked queue of every game. Players wait in
+// the queue of a game until enough of them have close enough ratings to
+// fill a match. The rating gap a player accepts starts small and widens the
+// longer they wait, so nobody waits forever for a perfect match.
+//
+// Queues live in the memory of the server: players queue over a socket and
+// leave the queue when it closes.
+package matchmaking
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"norex/catalog"
+)
+
+const (
+	// TickInterval is how often the queues look for matches.
+	TickInterval = time.Second
+
+	// BaseTolerance is the rating gap a player accepts right away, widened
+	// by ToleranceGrowth for every second they wait, up to MaxTolerance.
+	BaseTolerance   = 50.0
+	ToleranceGrowth = 10.0
+	MaxTolerance    = 600.0
+)
+
+// ErrAlreadyQueued is returned when a player joins a queue they are in.
+var ErrAlreadyQueued = errors.New("you are already in the queue for this game")
+
+// ErrNotRanked is returned for games that can not be played yet.
+var ErrNotRanked = errors.New("this game has no ranked queue")
+
+// Status is what a waiting player knows about their place in the queue.
+type Status struct {
+	Game      string  `json:"game"`
+	Position  int     `json:"position"` // 1 for the player waiting the longest
+	Queued    int     `json:"queued"`
+	Tolerance float64 `json:"tolerance"` // the rating gap currently accepted
+	Waited    int     `json:"waitedSeconds"`
+	// EstimatedWait is the expected number of seconds left, from the waits
+	// of recent matches; nil until the queue has made one
+	EstimatedWait *int `json:"estimatedWaitSeconds,omitempty"`
+}
+
+// Listener is told what happens to a ticket. It is called from the queue
+// goroutine and must not block.
+type Listener interface {
+	QueueStatus(status Status)
+	Matched(roomID string)
+	// MatchFailed tells a player the match could not be set up. When
+	// requeued they are back in the queue in their old place.
+	MatchFailed(err error, requeued bool)
+}
+
+// Ticket is one player waiting in a queue.
+type Ticket struct {
+	UserID   string
+	Rating   float64
+	JoinedAt time.Time // set by Join
+	Listener Listener
+
+	queue *queue
+	left  bool // set by Leave, so a ticket out for matching is not requeued
+}
+
+// tolerance returns the rating gap the ticket accepts at now.
+func (t *Ticket) tolerance(now time.Time) float64 {
+	return math.Min(BaseTolerance+ToleranceGrowth*now.Sub(t.JoinedAt).Seconds(), MaxTolerance)
+}
+
+// compatible reports whether two players accept each other's rating.
+func compatible(a, b *Ticket, now time.Time) bool {
+	return math.Abs(a.Rating-b.Rating) <= math.Min(a.tolerance(now), b.tolerance(now))
+}
+
+// MatchFunc sets up a match for players, e.g. by opening a room and
+// starting its game, and returns the ID of the room.
+type MatchFunc func(game catalog.Game, players []*Ticket) (string, error)
+
+type queue struct {
+	game    catalog.Game
+	size    int
+	tickets []*Ticket // oldest first
+	// avgWait is a moving average of how long matched players waited
+	avgWait time.Duration
+	matched bool
+}
+
+var (
+	mu     sync.Mutex
+	queues = make(map[string]*queue)
+	match  MatchFunc
+	ticker *time.Ticker
+	stop   chan struct{}
+)
+
+// Start makes the queues call match for every group of players they put
+// together, and starts looking for matches until Stop is called.
+func Start(fn MatchFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	match = fn
+	if ticker != nil {
+		return
+	}
+	ticker = time.NewTicker(TickInterval)
+	stop = make(chan struct{})
+	go run(ticker, stop)
+}
+
+// Stop stops looking for matches. Players stay in their queues.
+func Stop() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if ticker != nil {
+		ticker.Stop()
+		close(stop)
+		ticker = nil
+	}
+}
+
+func run(ticker *time.Ticker, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			tick(now)
+		}
+	}
+}
+
+// MatchSize is the number of players of a ranked match of game.
+func MatchSize(game catalog.Game) int {
+	return game.DefaultCapacity()
+}
+
+// Join puts a ticket at the end of the queue of game.
+func Join(game catalog.Game, ticket *Ticket) error {
+	if !game.Playable {
+		return ErrNotRanked
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	q := queues[game.Key]
+	if q == nil {
+		q = &queue{game: game, size: MatchSize(game)}
+		queues[game.Key] = q
+	}
+	for _, waiting := range q.tickets {
+		if waiting.UserID == ticket.UserID {
+			return ErrAlreadyQueued
+		}
+	}
+
+	ticket.JoinedAt = time.Now()
+	ticket.queue = q
+	q.tickets = append(q.tickets, ticket)
+	return nil
+}
+
+// Leave takes a ticket out of its queue and reports whether it was still
+// waiting, i.e. had not been matched yet.
+func Leave(ticket *Ticket) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ticket.left = true
+	if ticket.queue == nil {
+		return false
+	}
+	q := ticket.queue
+	for i, waiting := range q.tickets {
+		if waiting == ticket {
+			q.tickets = append(q.tickets[:i], q.tickets[i+1:]...)
+			ticket.queue = nil
+			return true
+		}
+	}
+	return false
+}
+
+// tick matches the players of every queue, then tells everyone still
+// waiting where they stand.
+func tick(now time.Time) {
+	type pending struct {
+		queue   *queue
+		players []*Ticket
+	}
+	var matches []pending
+	var waiting []*Ticket
+	var statuses []Status
+
+	mu.Lock()
+	fn := match
+	for _, q := range queues {
+		for _, group := range q.takeMatches(now) {
+			matches = append(matches, pending{queue: q, players: group})
+		}
+		for i, ticket := range q.tickets {
+			waiting = append(waiting, ticket)
+			statuses = append(statuses, q.status(ticket, i, now))
+		}
+	}
+	mu.Unlock()
+
+	// Room setup talks to the database, so it runs outside the lock
+	for _, m := range matches {
+		roomID, err := fn(m.queue.game, m.players)
+		if err != nil {
+			log.Printf("Setting up a ranked %s match failed: %v", m.queue.game.Key, err)
+			for _, ticket := range m.players {
+				ticket.Listener.MatchFailed(err, m.queue.requeue(ticket))
+			}
+			continue
+		}
+		for _, ticket := range m.players {
+			ticket.Listener.Matched(roomID)
+		}
+	}
+	for i, ticket := range waiting {
+		ticket.Listener.QueueStatus(statuses[i])
+	}
+}
+
+// requeue puts back a ticket whose match could not be set up, in the place
+// its join time gives it. Players who left meanwhile or joined again with
+// another ticket are not requeued.
+func (q *queue) requeue(ticket *Ticket) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if ticket.left {
+		return false
+	}
+	at := len(q.tickets)
+	for i, waiting := range q.tickets {
+		if waiting.UserID == ticket.UserID {
+			return false
+		}
+		if at == len(q.tickets) && waiting.JoinedAt.After(ticket.JoinedAt) {
+			at = i
+		}
+	}
+	ticket.queue = q
+	q.tickets = append(q.tickets[:at], append([]*Ticket{ticket}, q.tickets[at:]...)...)
+	return true
+}
+
+// takeMatches removes every group of players that can be matched from
+// the queue. The player waiting the longest is matched first, with the
+// closest ratings their tolerance accepts.
+func (q *queue) takeMatches(now time.Time) [][]*Ticket {
+	var groups [][]*Ticket
+	taken := make(map[*Ticket]bool)
+
+	for _, anchor := range q.tickets {
+		if taken[anchor] {
+			continue
+		}
+		var candidates []*Ticket
+		for _, other := range q.tickets {
+			if other != anchor && !taken[other] && compatible(anchor, other, now) {
+				candidates = append(candidates, other)
+			}
+		}
+		if len(candidates) < q.size-1 {
+			continue
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return math.Abs(candidates[i].Rating-anchor.Rating) < math.Abs(candidates[j].Rating-anchor.Rating)
+		})
+
+		// Everyone in a group has to accept everyone else
+		group := []*Ticket{anchor}
+		for _, candidate := range candidates {
+			fits := true
+			for _, member := range group[1:] {
+				if !compatible(member, candidate, now) {
+					fits = false
+					break
+				}
+			}
+			if fits {
+				group = append(group, candidate)
+			}
+			if len(group) == q.size {
+				break
+			}
+		}
+		if len(group) < q.size {
+			continue
+		}
+
+		for _, member := range group {
+			taken[member] = true
+			q.recordWait(now.Sub(member.JoinedAt))
+		}
+		groups = append(groups, group)
+	}
+	if len(taken) == 0 {
+		return nil
+	}
+
+	remaining := q.tickets[:0]
+	for _, ticket := range q.tickets {
+		if taken[ticket] {
+			ticket.queue = nil
+		} else {
+			remaining = append(remaining, ticket)
+		}
+	}
+	q.tickets = remaining
+	return groups
+}
+
+// recordWait adds the wait of a matched player to the moving average.
+func (q *queue) recordWait(wait time.Duration) {
+	if !q.matched {
+		q.avgWait = wait
+		q.matched = true
+		return
+	}
+	q.avgWait = (4*q.avgWait + wait) / 5
+}
+
+func (q *queue) status(ticket *Ticket, index int, now time.Time) Status {
+	waited := now.Sub(ticket.JoinedAt)
+	status := Status{
+		Game:      q.game.Key,
+		Position:  index + 1,
+		Queued:    len(q.tickets),
+		Tolerance: ticket.tolerance(now),
+		Waited:    int(waited.Seconds()),
+	}
+	if q.matched {
+		left := int(math.Max(0, (q.avgWait - waited).Seconds()))
+		status.EstimatedWait = &left
+	}
+	return status
+}
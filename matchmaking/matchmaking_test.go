@@ -0,0 +1,100 @@
+package matchmaking
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"norex/catalog"
+)
+
+type recorder struct {
+	matched  string
+	failed   bool
+	requeued bool
+}
+
+func (r *recorder) QueueStatus(Status)    {}
+func (r *recorder) Matched(roomID string) { r.matched = roomID }
+func (r *recorder) MatchFailed(_ error, requeued bool) {
+	r.failed, r.requeued = true, requeued
+}
+
+func queuedUsers(key string) []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var users []string
+	for _, ticket := range queues[key].tickets {
+		users = append(users, ticket.UserID)
+	}
+	return users
+}
+
+func TestTakeMatchesWidensTolerance(t *testing.T) {
+	game := catalog.Game{Key: "test_widen", MinPlayers: 2, MaxPlayers: 2, Playable: true}
+	now := time.Now()
+	q := &queue{game: game, size: 2}
+	a := &Ticket{UserID: "a", Rating: 1500, JoinedAt: now}
+	b := &Ticket{UserID: "b", Rating: 1700, JoinedAt: now}
+	q.tickets = []*Ticket{a, b}
+
+	if groups := q.takeMatches(now); len(groups) != 0 {
+		t.Fatalf("matched a 200 point gap right away: %v", groups)
+	}
+	// 50 + 10 per second reaches 200 after 15 seconds
+	if groups := q.takeMatches(now.Add(15 * time.Second)); len(groups) != 1 {
+		t.Fatalf("groups = %d, want 1 once the tolerance widened", len(groups))
+	}
+	if len(q.tickets) != 0 {
+		t.Fatalf("%d tickets left in the queue", len(q.tickets))
+	}
+}
+
+func TestFailedMatchRequeues(t *testing.T) {
+	game := catalog.Game{Key: "test_requeue", MinPlayers: 2, MaxPlayers: 2, Playable: true}
+	listeners := map[string]*recorder{}
+	tickets := map[string]*Ticket{}
+	for _, user := range []string{"early", "a", "b"} {
+		listeners[user] = &recorder{}
+		tickets[user] = &Ticket{UserID: user, Rating: 1500, Listener: listeners[user]}
+	}
+	// early waits alone with a rating nobody accepts yet
+	tickets["early"].Rating = 3000
+	if err := Join(game, tickets["early"]); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"a", "b"} {
+		if err := Join(game, tickets[user]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	match = func(catalog.Game, []*Ticket) (string, error) {
+		// b leaves while the room is being set up
+		Leave(tickets["b"])
+		return "", errors.New("database down")
+	}
+	tick(time.Now())
+
+	if !listeners["a"].failed || !listeners["a"].requeued {
+		t.Fatalf("a: %+v, want a failed match and a requeue", listeners["a"])
+	}
+	if !listeners["b"].failed || listeners["b"].requeued {
+		t.Fatalf("b: %+v, want no requeue after leaving", listeners["b"])
+	}
+	if got := queuedUsers(game.Key); len(got) != 2 || got[0] != "early" || got[1] != "a" {
+		t.Fatalf("queue = %v, want [early a]", got)
+	}
+
+	// Back in the queue a matches the next player to join
+	match = func(catalog.Game, []*Ticket) (string, error) { return "room1", nil }
+	c := &recorder{}
+	if err := Join(game, &Ticket{UserID: "c", Rating: 1500, Listener: c}); err != nil {
+		t.Fatal(err)
+	}
+	tick(time.Now())
+	if listeners["a"].matched != "room1" || c.matched != "room1" {
+		t.Fatalf("a matched %q, c matched %q, want room1", listeners["a"].matched, c.matched)
+	}
+}
@@ -3,9 +3,7 @@ package middleware
 import (
 	"context"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
-	"norex/database"
-	"norex/models"
+	"norex/store"
 )
 
 func EnsureEmailVerified(c *fiber.Ctx) error {
@@ -16,9 +14,7 @@ func EnsureEmailVerified(c *fiber.Ctx) error {
 	}
 
 	// Fetch the user from the database using the email
-	var user models.User
-	userCollection := database.GetCollection("users")
-	err := userCollection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
+	user, err := store.Users().FindByEmail(context.TODO(), email)
 	if err != nil {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -34,9 +30,7 @@ func EnsureEmailVerified(c *fiber.Ctx) error {
 
 func NameGenderCheck(c *fiber.Ctx) error {
 	email := c.Locals("email").(string)
-	var user models.User
-	collection := database.GetCollection("users")
-	err := collection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
+	user, err := store.Users().FindByEmail(context.TODO(), email)
 	if err != nil || user.Name == "" || user.Gender == "" {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Name and gender required"})
 	}
@@ -48,8 +42,7 @@ func CheckPermissions(requiredPermission string) fiber.Handler {
 		userRole := c.Locals("role").(string)
 
 		// Fetch role and permissions from the database
-		var role models.Role
-		err := database.GetCollection("roles").FindOne(context.TODO(), bson.M{"name": userRole}).Decode(&role)
+		role, err := store.Roles().FindByName(context.TODO(), userRole)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve role"})
 		}
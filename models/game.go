@@ -0,0 +1,15 @@
+package models
+
+// Game is a game played in a room, stored in the RethinkDB "games" table.
+type Game struct {
+	ID           string   `rethinkdb:"id,omitempty" json:"id,omitempty"`
+	RoomID       string   `rethinkdb:"roomId" json:"roomId"`
+	GameName     string   `rethinkdb:"gameName" json:"gameName"`
+	Status       string   `rethinkdb:"status" json:"status"`
+	OwnerID      string   `rethinkdb:"ownerId" json:"ownerId"`
+	WinnerID     *string  `rethinkdb:"winnerId" json:"winnerId"`
+	Participants []string `rethinkdb:"participates" json:"participates"`
+	Ranked       bool     `rethinkdb:"ranked" json:"ranked"`
+	// MatchID is the ID of the Match recorded when the game finished
+	MatchID string `rethinkdb:"matchId,omitempty" json:"matchId,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Outcomes of a player in a match.
+const (
+	OutcomeWin  = "win"
+	OutcomeLoss = "loss"
+	OutcomeDraw = "draw"
+)
+
+// Match is a finished game, stored in the MongoDB "matches" collection.
+type Match struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RoomID    string             `bson:"room_id" json:"roomId"`
+	Game      string             `bson:"game" json:"game"`
+	Ranked    bool               `bson:"ranked" json:"ranked"`
+	Players   []MatchPlayer      `bson:"players" json:"players"` // in seat order
+	Standings [][]string         `bson:"standings" json:"standings"`
+	Moves     int                `bson:"moves" json:"moves"`
+	// Duration is in seconds
+	Duration  float64   `bson:"duration" json:"durationSeconds"`
+	StartedAt time.Time `bson:"started_at" json:"startedAt"`
+	EndedAt   time.Time `bson:"ended_at" json:"endedAt"`
+}
+
+// MatchPlayer is how one player did in a match.
+type MatchPlayer struct {
+	Email   string `bson:"email" json:"email"`
+	Place   int    `bson:"place" json:"place"` // 1 for first place
+	Outcome string `bson:"outcome" json:"outcome"`
+}
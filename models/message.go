@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Message is a text chat message sent in a room, stored in the RethinkDB "messages" table.
+type Message struct {
+	ID         string    `rethinkdb:"id,omitempty" json:"id,omitempty"`
+	RoomID     string    `rethinkdb:"roomID" json:"roomID"`
+	UserID     string    `rethinkdb:"userID" json:"userID"`
+	UserName   string    `rethinkdb:"userName" json:"userName"`
+	UserAvatar string    `rethinkdb:"userAvatar" json:"userAvatar"`
+	Content    string    `rethinkdb:"content" json:"content"`
+	CreatedAt  time.Time `rethinkdb:"createdAt" json:"createdAt"`
+}
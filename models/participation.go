@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Participation is a user taking a seat in a room, stored in the RethinkDB
+// "participated" table. The room owner always has one.
+type Participation struct {
+	ID         string    `rethinkdb:"id,omitempty" json:"id,omitempty"`
+	RoomID     string    `rethinkdb:"roomID" json:"roomID"`
+	UserID     string    `rethinkdb:"userID" json:"userID"`
+	UserName   string    `rethinkdb:"userName" json:"userName"`
+	UserAvatar string    `rethinkdb:"userAvatar" json:"userAvatar"`
+	UserLevel  int       `rethinkdb:"userLevel" json:"userLevel"`
+	CreatedAt  time.Time `rethinkdb:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// RatingChange is one entry of a player's rating history in one game,
+// stored in the MongoDB "rating_history" collection.
+type RatingChange struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Email      string             `bson:"email" json:"-"`
+	Game       string             `bson:"game" json:"game"`
+	RoomID     string             `bson:"room_id" json:"roomId"`
+	Place      int                `bson:"place" json:"place"` // 1 for first place
+	Players    int                `bson:"players" json:"players"`
+	Rating     float64            `bson:"rating" json:"rating"`
+	Deviation  float64            `bson:"rd" json:"rd"`
+	Volatility float64            `bson:"volatility" json:"volatility"`
+	Change     float64            `bson:"change" json:"change"` // rating gained or lost
+	Level      int                `bson:"level" json:"level"`
+	Ranked     bool               `bson:"ranked" json:"ranked"` // false for the casual rating
+	CreatedAt  time.Time          `bson:"created_at" json:"createdAt"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"norex/settings"
+)
+
+// Room is a game room waiting for players or playing, stored in the
+// RethinkDB "rooms" table. ID is generated by the server and is the
+// primary key used by every /:game_id route.
+type Room struct {
+	ID           string                `rethinkdb:"id" json:"id"`
+	GameName     string                `rethinkdb:"gameName" json:"gameName"`
+	IsLocked     bool                  `rethinkdb:"isLocked" json:"isLocked"`
+	RoomPassword string                `rethinkdb:"roomPassword,omitempty" json:"-"` // never sent to clients
+	VoiceChatOn  bool                  `rethinkdb:"voiceChatOn" json:"voiceChatOn"`
+	TextChatOn   bool                  `rethinkdb:"textChatOn" json:"textChatOn"`
+	MinLevel     int                   `rethinkdb:"minLevel" json:"minLevel"`
+	Capacity     int                   `rethinkdb:"capacity" json:"capacity"`
+	TimeControl  *settings.TimeControl `rethinkdb:"timeControl,omitempty" json:"timeControl,omitempty"`
+	Participants int                   `rethinkdb:"participants" json:"participants"` // seats taken, the owner included
+	Ranked       bool                  `rethinkdb:"ranked" json:"ranked"`             // opened by the ranked queue
+
+	// Options are the house rules of the room, see catalog.Option
+	Options settings.Options `rethinkdb:"options,omitempty" json:"options,omitempty"`
+
+	// The owner, copied from their profile when the room is created
+	UserEmail string `rethinkdb:"userEmail" json:"userEmail"`
+	Avatar    string `rethinkdb:"avatar" json:"avatar"`
+	Name      string `rethinkdb:"name" json:"name"`
+
+	CreatedAt time.Time `rethinkdb:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `rethinkdb:"updatedAt" json:"updatedAt"`
+}
+
+// FreeSeats returns how many more players the room can seat.
+func (r Room) FreeSeats() int {
+	return r.Capacity - r.Participants
+}
@@ -5,9 +5,29 @@ import (
 	"time"
 )
 
+// DefaultRating is the rating of a player who has not been rated yet.
+const DefaultRating = 1500
+
 type GameStats struct {
 	Wins  int `bson:"wins" json:"wins"`
 	Level int `bson:"level" json:"level"`
+	// Glicko-2 rating, all 0 until the first game ends
+	Rating          float64 `bson:"rating,omitempty" json:"rating,omitempty"`
+	RatingDeviation float64 `bson:"rd,omitempty" json:"rd,omitempty"`
+	Volatility      float64 `bson:"volatility,omitempty" json:"volatility,omitempty"`
+	// Glicko-2 rating of casual games, kept apart from the ranked one above
+	CasualRating          float64 `bson:"casualRating,omitempty" json:"casualRating,omitempty"`
+	CasualRatingDeviation float64 `bson:"casualRd,omitempty" json:"casualRd,omitempty"`
+	CasualVolatility      float64 `bson:"casualVolatility,omitempty" json:"casualVolatility,omitempty"`
+}
+
+// CurrentRating returns the rating, or DefaultRating before the first
+// rated game.
+func (s GameStats) CurrentRating() float64 {
+	if s.Rating == 0 {
+		return DefaultRating
+	}
+	return s.Rating
 }
 
 type User struct {
@@ -0,0 +1,212 @@
+// Package rating implements the Glicko-2 rating system. Every game is one
+// rating period: each player is rated against every other player of the
+// game, winning against players placed below them, drawing with players
+// sharing their place and losing against players placed above them, so
+// two-player and free-for-all games are rated the same way.
+//
+// See http://www.glicko.net/glicko/glicko2.pdf for the algorithm.
+package rating
+
+import (
+	"math"
+
+	"norex/catalog"
+	"norex/models"
+)
+
+const (
+	// DefaultDeviation and DefaultVolatility are the values of a player
+	// who has never been rated, with models.DefaultRating.
+	DefaultDeviation  = 350.0
+	DefaultVolatility = 0.06
+
+	// MinDeviation keeps ratings moving for players who play a lot.
+	MinDeviation = 30.0
+
+	// tau constrains how much the volatility may change per game.
+	tau = 0.5
+	// scale converts between the Glicko and Glicko-2 scales.
+	scale = 173.7178
+	// epsilon is the convergence tolerance of the volatility iteration.
+	epsilon = 0.000001
+)
+
+// Player is the rating of one player in one game.
+type Player struct {
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+}
+
+// FromStats returns the ranked rating kept in a player's stats, or their
+// casual rating when ranked is false, with the defaults of an unrated
+// player for missing values.
+func FromStats(stats models.GameStats, ranked bool) Player {
+	p := Player{Rating: stats.CurrentRating(), Deviation: stats.RatingDeviation, Volatility: stats.Volatility}
+	if !ranked {
+		p = Player{Rating: stats.CasualRating, Deviation: stats.CasualRatingDeviation, Volatility: stats.CasualVolatility}
+		if p.Rating == 0 {
+			p.Rating = models.DefaultRating
+		}
+	}
+	if p.Deviation == 0 {
+		p.Deviation = DefaultDeviation
+	}
+	if p.Volatility == 0 {
+		p.Volatility = DefaultVolatility
+	}
+	return p
+}
+
+// Apply stores the rating in stats as the ranked or the casual rating and
+// derives the level again.
+func (p Player) Apply(stats *models.GameStats, ranked bool) {
+	if ranked {
+		stats.Rating, stats.RatingDeviation, stats.Volatility = p.Rating, p.Deviation, p.Volatility
+	} else {
+		stats.CasualRating, stats.CasualRatingDeviation, stats.CasualVolatility = p.Rating, p.Deviation, p.Volatility
+	}
+	stats.Level = StatsLevel(*stats)
+}
+
+// StatsLevel is the level of a player: the level of the better of their
+// ranked and casual ratings, so that both kinds of games count towards it.
+func StatsLevel(stats models.GameStats) int {
+	return max(Level(FromStats(stats, true)), Level(FromStats(stats, false)))
+}
+
+// Level maps a rating to a level between catalog.MinLevel and
+// catalog.MaxLevel. It uses the conservative rating, two deviations below
+// the rating, so levels only grow once the rating is reliable: a new player
+// is level 1 and each 20 points above 800 add a level.
+func Level(p Player) int {
+	level := 1 + int(math.Floor((p.Rating-2*p.Deviation-800)/20))
+	return max(catalog.MinLevel, min(level, catalog.MaxLevel))
+}
+
+// Outcome is the result of a player against one opponent: 1 for a win,
+// 0.5 for a draw and 0 for a loss.
+type Outcome struct {
+	Opponent Player
+	Score    float64
+}
+
+// Update returns the rating after a rating period with the given outcomes.
+func (p Player) Update(outcomes []Outcome) Player {
+	mu := (p.Rating - models.DefaultRating) / scale
+	phi := p.Deviation / scale
+
+	if len(outcomes) == 0 {
+		// Only the uncertainty grows
+		phi = math.Sqrt(phi*phi + p.Volatility*p.Volatility)
+		return Player{Rating: p.Rating, Deviation: clampDeviation(phi * scale), Volatility: p.Volatility}
+	}
+
+	var vInv, sum float64
+	for _, o := range outcomes {
+		muJ := (o.Opponent.Rating - models.DefaultRating) / scale
+		g := g(o.Opponent.Deviation / scale)
+		e := 1 / (1 + math.Exp(-g*(mu-muJ)))
+		vInv += g * g * e * (1 - e)
+		sum += g * (o.Score - e)
+	}
+	v := 1 / vInv
+	delta := v * sum
+
+	sigma := volatility(phi, p.Volatility, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phiNew := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	muNew := mu + phiNew*phiNew*sum
+
+	return Player{
+		Rating:     muNew*scale + models.DefaultRating,
+		Deviation:  clampDeviation(phiNew * scale),
+		Volatility: sigma,
+	}
+}
+
+func g(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+// volatility finds the new volatility with the Illinois algorithm, step 5
+// of the paper.
+func volatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+func clampDeviation(rd float64) float64 {
+	return max(MinDeviation, min(rd, DefaultDeviation))
+}
+
+// Rate returns the new rating of every player of a game from their
+// ratings before it and the standings, from first place to last with
+// players sharing a place in the same group.
+func Rate(players map[string]Player, standings [][]string) map[string]Player {
+	rated := make(map[string]Player, len(players))
+	for id, player := range players {
+		rated[id] = player.Update(Outcomes(id, players, standings))
+	}
+	return rated
+}
+
+// Outcomes returns the results of player id against every other player of
+// a game. Players missing from the standings share last place.
+func Outcomes(id string, players map[string]Player, standings [][]string) []Outcome {
+	place := func(player string) int {
+		for i, group := range standings {
+			for _, member := range group {
+				if member == player {
+					return i
+				}
+			}
+		}
+		return len(standings)
+	}
+
+	var outcomes []Outcome
+	for otherID, other := range players {
+		if otherID == id {
+			continue
+		}
+		score := 0.5
+		switch {
+		case place(id) < place(otherID):
+			score = 1
+		case place(id) > place(otherID):
+			score = 0
+		}
+		outcomes = append(outcomes, Outcome{Opponent: other, Score: score})
+	}
+	return outcomes
+}
@@ -0,0 +1,117 @@
+package rating
+
+import (
+	"math"
+	"testing"
+
+	"norex/models"
+)
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+// The worked example of the Glicko-2 paper.
+func TestUpdatePaperExample(t *testing.T) {
+	player := Player{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	outcomes := []Outcome{
+		{Opponent: Player{Rating: 1400, Deviation: 30}, Score: 1},
+		{Opponent: Player{Rating: 1550, Deviation: 100}, Score: 0},
+		{Opponent: Player{Rating: 1700, Deviation: 300}, Score: 0},
+	}
+
+	got := player.Update(outcomes)
+	if !near(got.Rating, 1464.06, 0.01) || !near(got.Deviation, 151.52, 0.01) || !near(got.Volatility, 0.05999, 0.00001) {
+		t.Fatalf("Update = %+v, want rating 1464.06, rd 151.52, volatility 0.05999", got)
+	}
+}
+
+func TestUpdateWithoutGames(t *testing.T) {
+	player := Player{Rating: 1600, Deviation: 50, Volatility: 0.06}
+	got := player.Update(nil)
+	if got.Rating != 1600 || got.Deviation <= 50 {
+		t.Fatalf("Update(nil) = %+v, want the same rating with a larger rd", got)
+	}
+}
+
+func TestRate(t *testing.T) {
+	fresh := Player{Rating: 1500, Deviation: DefaultDeviation, Volatility: DefaultVolatility}
+	tests := []struct {
+		name      string
+		standings [][]string
+		check     func(rated map[string]Player) bool
+	}{
+		{
+			name:      "winner gains what the loser loses",
+			standings: [][]string{{"a"}, {"b"}},
+			check: func(rated map[string]Player) bool {
+				return rated["a"].Rating > 1500 && near(rated["a"].Rating-1500, 1500-rated["b"].Rating, 0.001)
+			},
+		},
+		{
+			name:      "draw between equals changes nothing",
+			standings: [][]string{{"a", "b"}},
+			check: func(rated map[string]Player) bool {
+				return near(rated["a"].Rating, 1500, 0.001) && near(rated["b"].Rating, 1500, 0.001)
+			},
+		},
+		{
+			name:      "missing player comes last",
+			standings: [][]string{{"b"}},
+			check: func(rated map[string]Player) bool {
+				return rated["a"].Rating < 1500 && rated["b"].Rating > 1500
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rated := Rate(map[string]Player{"a": fresh, "b": fresh}, tt.standings)
+			if !tt.check(rated) {
+				t.Fatalf("Rate = %+v", rated)
+			}
+		})
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		player Player
+		want   int
+	}{
+		{Player{Rating: 1500, Deviation: DefaultDeviation}, 1},
+		{Player{Rating: 1500, Deviation: 50}, 31},
+		{Player{Rating: 4000, Deviation: 30}, 100},
+	}
+	for _, tt := range tests {
+		if got := Level(tt.player); got != tt.want {
+			t.Errorf("Level(%+v) = %d, want %d", tt.player, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	reliable := Player{Rating: 1500, Deviation: 50, Volatility: DefaultVolatility}
+	tests := []struct {
+		name   string
+		ranked bool
+	}{
+		{"ranked", true},
+		{"casual", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats models.GameStats
+			reliable.Apply(&stats, tt.ranked)
+			if got := FromStats(stats, tt.ranked); got != reliable {
+				t.Fatalf("FromStats = %+v, want %+v", got, reliable)
+			}
+			if other := FromStats(stats, !tt.ranked); other.Deviation != DefaultDeviation {
+				t.Fatalf("the other rating changed to %+v", other)
+			}
+			// The unrated other rating is level 1
+			if want := Level(reliable); stats.Level != want {
+				t.Fatalf("level %d, want %d from the better rating", stats.Level, want)
+			}
+		})
+	}
+}
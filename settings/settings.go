@@ -0,0 +1,78 @@
+// Package settings holds the game settings of a room. They are stored with
+// the room model and read by the game engine, so neither has to depend on
+// the other.
+package settings
+
+import "fmt"
+
+// Options holds per-room house rules, e.g. {"stickTheDealer": true}.
+type Options map[string]interface{}
+
+// Bool returns the option as a bool, or def if it is missing or not a bool.
+func (o Options) Bool(key string, def bool) bool {
+	if v, ok := o[key].(bool); ok {
+		return v
+	}
+	return def
+}
+
+// Int returns the option as an int, or def if it is missing or not a number.
+func (o Options) Int(key string, def int) int {
+	switch v := o[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return def
+}
+
+// String returns the option as a string, or def if it is missing or not a string.
+func (o Options) String(key string, def string) string {
+	if v, ok := o[key].(string); ok {
+		return v
+	}
+	return def
+}
+
+// What happens to a player who runs out of time.
+const (
+	TimeoutForfeit  = "forfeit"
+	TimeoutAutoPlay = "auto_play"
+)
+
+// TimeControl is the time limit of a room. A bank gives every player a
+// total amount of time for the whole game, optionally topped up by an
+// increment after each of their turns (Fischer timing). A turn limit caps
+// each turn, however many moves it takes. Either or both may be used; zero
+// disables them.
+type TimeControl struct {
+	BankSeconds      int    `json:"bankSeconds" rethinkdb:"bankSeconds"`
+	IncrementSeconds int    `json:"incrementSeconds" rethinkdb:"incrementSeconds"`
+	TurnSeconds      int    `json:"turnSeconds" rethinkdb:"turnSeconds"`
+	OnTimeout        string `json:"onTimeout" rethinkdb:"onTimeout"` // "forfeit" (default) or "auto_play"
+}
+
+// Enabled reports whether the time control limits anything at all.
+func (tc TimeControl) Enabled() bool {
+	return tc.BankSeconds > 0 || tc.TurnSeconds > 0
+}
+
+// Validate checks the settings a room owner sent.
+func (tc TimeControl) Validate() error {
+	switch {
+	case tc.BankSeconds < 0 || tc.BankSeconds > 3*60*60:
+		return fmt.Errorf("bankSeconds must be between 0 and 10800")
+	case tc.IncrementSeconds < 0 || tc.IncrementSeconds > 60:
+		return fmt.Errorf("incrementSeconds must be between 0 and 60")
+	case tc.IncrementSeconds > 0 && tc.BankSeconds == 0:
+		return fmt.Errorf("incrementSeconds needs a bankSeconds time bank")
+	case tc.TurnSeconds < 0 || tc.TurnSeconds > 10*60:
+		return fmt.Errorf("turnSeconds must be between 0 and 600")
+	case tc.OnTimeout != "" && tc.OnTimeout != TimeoutForfeit && tc.OnTimeout != TimeoutAutoPlay:
+		return fmt.Errorf("onTimeout must be %q or %q", TimeoutForfeit, TimeoutAutoPlay)
+	}
+	return nil
+}
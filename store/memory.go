@@ -0,0 +1,693 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/rethinkdb/rethinkdb-go.v6/encoding"
+	"norex/models"
+)
+
+// newMemoryID returns a random primary key for documents kept in memory.
+func newMemoryID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// setFields applies a partial update, keyed by rethinkdb tags the way the
+// database store receives it, to the struct v points to. Unknown keys are
+// ignored.
+func setFields(v interface{}, fields map[string]interface{}) error {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+	for key, value := range fields {
+		for i := 0; i < rt.NumField(); i++ {
+			tag := strings.Split(rt.Field(i).Tag.Get("rethinkdb"), ",")[0]
+			if tag != key {
+				continue
+			}
+			if err := encoding.Decode(rv.Field(i).Addr().Interface(), value); err != nil {
+				return fmt.Errorf("store: cannot set %s: %w", key, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+type memoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]models.User // keyed by email
+}
+
+func NewMemoryUserStore() UserStore {
+	return &memoryUserStore{users: make(map[string]models.User)}
+}
+
+func (s *memoryUserStore) FindByEmail(_ context.Context, email string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[email]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (s *memoryUserStore) Create(_ context.Context, user models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	s.users[user.Email] = user
+	return nil
+}
+
+func (s *memoryUserStore) Update(_ context.Context, email string, user models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.users[email]
+	if !ok {
+		return nil
+	}
+	if user.ID.IsZero() {
+		user.ID = existing.ID
+	}
+	s.users[email] = user
+	return nil
+}
+
+func (s *memoryUserStore) UpdateFields(_ context.Context, email string, fields map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[email]
+	if !ok {
+		return nil
+	}
+	if err := setUserFields(&user, fields); err != nil {
+		return err
+	}
+	s.users[email] = user
+	return nil
+}
+
+func (s *memoryUserStore) IncrementFields(_ context.Context, email string, fields map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[email]
+	if !ok {
+		return nil
+	}
+	raw, err := bsonMarshal(user)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]interface{}, len(fields))
+	for key, delta := range fields {
+		// Missing fields start at 0, like in MongoDB
+		switch n := bsonPath(raw, key).(type) {
+		case int32:
+			set[key] = int(n) + delta
+		case int64:
+			set[key] = int(n) + delta
+		case float64:
+			set[key] = n + float64(delta)
+		default:
+			set[key] = delta
+		}
+	}
+	if err := setUserFields(&user, set); err != nil {
+		return err
+	}
+	s.users[email] = user
+	return nil
+}
+
+func (s *memoryUserStore) UpdateFieldsIf(_ context.Context, email string, match, fields map[string]interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[email]
+	if !ok {
+		return false, nil
+	}
+	raw, err := bsonMarshal(user)
+	if err != nil {
+		return false, err
+	}
+	for key, want := range match {
+		if !bsonEqual(bsonPath(raw, key), want) {
+			return false, nil
+		}
+	}
+	if err := setUserFields(&user, fields); err != nil {
+		return false, err
+	}
+	s.users[email] = user
+	return true, nil
+}
+
+// bsonPath returns the value at a dotted path of a bson document, nil when
+// it is missing.
+func bsonPath(raw bson.M, key string) interface{} {
+	var value interface{} = raw
+	for _, name := range strings.Split(key, ".") {
+		doc, _ := value.(bson.M)
+		value = doc[name]
+	}
+	return value
+}
+
+// bsonEqual compares a stored bson value with a query value the way a
+// MongoDB equality filter does, numbers by value whatever their type.
+func bsonEqual(stored, want interface{}) bool {
+	a, aNumber := bsonNumber(stored)
+	b, bNumber := bsonNumber(want)
+	if aNumber || bNumber {
+		return aNumber && bNumber && a == b
+	}
+	return reflect.DeepEqual(stored, want)
+}
+
+func bsonNumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// setUserFields applies a bson $set document to an in-memory user by
+// round-tripping it through bson, matching what MongoDB would store. Keys
+// may be dotted paths such as "games.uno".
+func setUserFields(user *models.User, fields map[string]interface{}) error {
+	raw, err := bsonMarshal(user)
+	if err != nil {
+		return err
+	}
+	for key, value := range fields {
+		doc := raw
+		path := strings.Split(key, ".")
+		for _, name := range path[:len(path)-1] {
+			next, ok := doc[name].(bson.M)
+			if !ok {
+				next = bson.M{}
+				doc[name] = next
+			}
+			doc = next
+		}
+		doc[path[len(path)-1]] = value
+	}
+	return bsonUnmarshal(raw, user)
+}
+
+type memoryRoleStore struct {
+	mu    sync.RWMutex
+	roles []models.Role
+}
+
+func NewMemoryRoleStore() RoleStore {
+	return &memoryRoleStore{}
+}
+
+func (s *memoryRoleStore) find(match func(models.Role) bool) (models.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, role := range s.roles {
+		if match(role) {
+			return role, nil
+		}
+	}
+	return models.Role{}, ErrNotFound
+}
+
+func (s *memoryRoleStore) FindByID(_ context.Context, id primitive.ObjectID) (models.Role, error) {
+	return s.find(func(role models.Role) bool { return role.ID == id })
+}
+
+func (s *memoryRoleStore) FindByName(_ context.Context, name string) (models.Role, error) {
+	return s.find(func(role models.Role) bool { return role.Name == name })
+}
+
+func (s *memoryRoleStore) Create(_ context.Context, role models.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if role.ID.IsZero() {
+		role.ID = primitive.NewObjectID()
+	}
+	s.roles = append(s.roles, role)
+	return nil
+}
+
+func (s *memoryRoleStore) Update(_ context.Context, id primitive.ObjectID, role models.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.roles {
+		if s.roles[i].ID == id {
+			role.ID = id
+			s.roles[i] = role
+		}
+	}
+	return nil
+}
+
+func (s *memoryRoleStore) Delete(_ context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.roles {
+		if s.roles[i].ID == id {
+			s.roles = append(s.roles[:i], s.roles[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryRoleStore) List(_ context.Context) ([]models.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]models.Role(nil), s.roles...), nil
+}
+
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions []models.Session
+}
+
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{}
+}
+
+func (s *memorySessionStore) Create(_ context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	s.sessions = append(s.sessions, session)
+	return nil
+}
+
+type memoryRoomStore struct {
+	mu    sync.RWMutex
+	rooms map[string]models.Room
+}
+
+func NewMemoryRoomStore() RoomStore {
+	return &memoryRoomStore{rooms: make(map[string]models.Room)}
+}
+
+func (s *memoryRoomStore) Create(_ context.Context, room models.Room) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.rooms[room.ID]; exists {
+		return ErrDuplicate
+	}
+	s.rooms[room.ID] = room
+	return nil
+}
+
+func (s *memoryRoomStore) Get(_ context.Context, id string) (models.Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room, ok := s.rooms[id]
+	if !ok {
+		return models.Room{}, ErrNotFound
+	}
+	return room, nil
+}
+
+func (s *memoryRoomStore) Update(_ context.Context, id string, fields map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[id]
+	if !ok {
+		return nil
+	}
+	if err := setFields(&room, fields); err != nil {
+		return err
+	}
+	room.UpdatedAt = time.Now().UTC()
+	s.rooms[id] = room
+	return nil
+}
+
+func (s *memoryRoomStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.rooms, id)
+	return nil
+}
+
+func (s *memoryRoomStore) ClaimSeat(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if room.Participants >= room.Capacity {
+		return ErrFull
+	}
+	room.Participants++
+	s.rooms[id] = room
+	return nil
+}
+
+func (s *memoryRoomStore) ReleaseSeat(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room, ok := s.rooms[id]; ok && room.Participants > 0 {
+		room.Participants--
+		s.rooms[id] = room
+	}
+	return nil
+}
+
+func (s *memoryRoomStore) Search(_ context.Context, query RoomQuery) ([]models.Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// before reports whether a sorts ahead of b, like the RethinkDB indexes
+	before := func(a, b RoomCursor) bool {
+		if a.Value != b.Value {
+			return (a.Value > b.Value) == query.Sort.Descending()
+		}
+		return a.ID != b.ID && (a.ID > b.ID) == query.Sort.Descending()
+	}
+	position := func(room models.Room) RoomCursor {
+		return RoomCursor{Value: query.Sort.Value(room), ID: room.ID}
+	}
+
+	var rooms []models.Room
+	for _, room := range s.rooms {
+		if !query.Match(room) {
+			continue
+		}
+		if query.After != nil && !before(*query.After, position(room)) {
+			continue
+		}
+		room.RoomPassword = ""
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return before(position(rooms[i]), position(rooms[j])) })
+	if len(rooms) > query.Limit {
+		rooms = rooms[:query.Limit]
+	}
+	return rooms, nil
+}
+
+func (s *memoryRoomStore) CountByGame(_ context.Context) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, room := range s.rooms {
+		counts[room.GameName]++
+	}
+	return counts, nil
+}
+
+type memoryGameStore struct {
+	mu    sync.Mutex
+	games map[string]models.Game
+}
+
+func NewMemoryGameStore() GameStore {
+	return &memoryGameStore{games: make(map[string]models.Game)}
+}
+
+func (s *memoryGameStore) Create(_ context.Context, game models.Game) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if game.ID == "" {
+		game.ID = newMemoryID()
+	}
+	s.games[game.ID] = game
+	return game.ID, nil
+}
+
+func (s *memoryGameStore) Finish(_ context.Context, id string, winnerID *string, matchID string) (models.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	game, ok := s.games[id]
+	if !ok || game.Status != "started" {
+		return models.Game{}, ErrNotFound
+	}
+	game.Status = "finished"
+	game.WinnerID = winnerID
+	game.MatchID = matchID
+	s.games[id] = game
+	return game, nil
+}
+
+func (s *memoryGameStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.games, id)
+	return nil
+}
+
+type memoryMatchStore struct {
+	mu      sync.Mutex
+	matches []models.Match
+}
+
+func NewMemoryMatchStore() MatchStore {
+	return &memoryMatchStore{}
+}
+
+func (s *memoryMatchStore) Create(_ context.Context, match models.Match) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if match.ID.IsZero() {
+		match.ID = primitive.NewObjectID()
+	}
+	s.matches = append(s.matches, match)
+	return nil
+}
+
+func (s *memoryMatchStore) ListByUser(_ context.Context, email, game string, before *MatchCursor, limit int) ([]models.Match, error) {
+	return s.list(func(match models.Match) bool {
+		if game != "" && match.Game != game {
+			return false
+		}
+		for _, player := range match.Players {
+			if player.Email == email {
+				return true
+			}
+		}
+		return false
+	}, before, limit), nil
+}
+
+func (s *memoryMatchStore) ListByGame(_ context.Context, game string, before *MatchCursor, limit int) ([]models.Match, error) {
+	return s.list(func(match models.Match) bool { return match.Game == game }, before, limit), nil
+}
+
+func (s *memoryMatchStore) list(keep func(models.Match) bool, before *MatchCursor, limit int) []models.Match {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matches []models.Match
+	for _, match := range s.matches {
+		if keep(match) && (before == nil || before.Before(match)) {
+			matches = append(matches, match)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return MatchCursor{EndedAt: matches[i].EndedAt, ID: matches[i].ID}.Before(matches[j])
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+type memoryRatingStore struct {
+	mu      sync.Mutex
+	changes []models.RatingChange
+}
+
+func NewMemoryRatingStore() RatingStore {
+	return &memoryRatingStore{}
+}
+
+func (s *memoryRatingStore) Create(_ context.Context, change models.RatingChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.changes = append(s.changes, change)
+	return nil
+}
+
+func (s *memoryRatingStore) ListByUser(_ context.Context, email, game string, before time.Time, limit int) ([]models.RatingChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []models.RatingChange
+	for _, change := range s.changes {
+		if change.Email == email && change.Game == game && (before.IsZero() || change.CreatedAt.Before(before)) {
+			changes = append(changes, change)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].CreatedAt.After(changes[j].CreatedAt)
+	})
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes, nil
+}
+
+type memoryMessageStore struct {
+	mu       sync.Mutex
+	messages []models.Message
+}
+
+func NewMemoryMessageStore() MessageStore {
+	return &memoryMessageStore{}
+}
+
+func (s *memoryMessageStore) Create(_ context.Context, message models.Message) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if message.ID == "" {
+		message.ID = newMemoryID()
+	}
+	s.messages = append(s.messages, message)
+	return message.ID, nil
+}
+
+func (s *memoryMessageStore) ListByRoom(_ context.Context, roomID string, before *MessageCursor, limit int) ([]models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []models.Message
+	for _, message := range s.messages {
+		if message.RoomID == roomID && (before == nil || before.Before(message)) {
+			messages = append(messages, message)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return MessageCursor{CreatedAt: messages[i].CreatedAt, ID: messages[i].ID}.Before(messages[j])
+	})
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+func (s *memoryMessageStore) DeleteByRoom(_ context.Context, roomID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.messages[:0]
+	for _, message := range s.messages {
+		if message.RoomID != roomID {
+			kept = append(kept, message)
+		}
+	}
+	s.messages = kept
+	return nil
+}
+
+type memoryParticipationStore struct {
+	mu             sync.Mutex
+	participations []models.Participation
+}
+
+func NewMemoryParticipationStore() ParticipationStore {
+	return &memoryParticipationStore{}
+}
+
+func (s *memoryParticipationStore) Create(_ context.Context, participation models.Participation) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if participation.ID == "" {
+		participation.ID = newMemoryID()
+	}
+	s.participations = append(s.participations, participation)
+	return participation.ID, nil
+}
+
+func (s *memoryParticipationStore) ListByRoom(_ context.Context, roomID string) ([]models.Participation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Kept in insertion order, which is the order users joined
+	var participations []models.Participation
+	for _, participation := range s.participations {
+		if participation.RoomID == roomID {
+			participations = append(participations, participation)
+		}
+	}
+	return participations, nil
+}
+
+func (s *memoryParticipationStore) Delete(_ context.Context, roomID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, participation := range s.participations {
+		if participation.RoomID == roomID && participation.UserID == userID {
+			s.participations = append(s.participations[:i], s.participations[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryParticipationStore) DeleteByRoom(_ context.Context, roomID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.participations[:0]
+	for _, participation := range s.participations {
+		if participation.RoomID != roomID {
+			kept = append(kept, participation)
+		}
+	}
+	s.participations = kept
+	return nil
+}
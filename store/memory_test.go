@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"norex/models"
+)
+
+func TestMemoryMessagePages(t *testing.T) {
+	ctx := context.Background()
+	messages := NewMemoryMessageStore()
+
+	// Five messages share a timestamp so a page boundary falls among them
+	sent := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 8; i++ {
+		at := sent
+		if i >= 5 {
+			at = sent.Add(time.Duration(i) * time.Second)
+		}
+		_, err := messages.Create(ctx, models.Message{ID: fmt.Sprintf("m%d", i), RoomID: "room", Content: "hi", CreatedAt: at})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages.Create(ctx, models.Message{ID: "other", RoomID: "elsewhere", CreatedAt: sent})
+
+	var got []string
+	var before *MessageCursor
+	for page := 0; page < 10; page++ {
+		list, err := messages.ListByRoom(ctx, "room", before, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, message := range list {
+			got = append(got, message.ID)
+		}
+		if len(list) < 3 {
+			break
+		}
+		last := list[len(list)-1]
+		before = &MessageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	want := []string{"m7", "m6", "m5", "m4", "m3", "m2", "m1", "m0"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("pages = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryMatchPages(t *testing.T) {
+	ctx := context.Background()
+	matches := NewMemoryMatchStore()
+
+	// Five matches end at once so a page boundary falls among them
+	ended := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var ids []primitive.ObjectID
+	for i := 0; i < 8; i++ {
+		at := ended
+		if i >= 5 {
+			at = ended.Add(time.Duration(i) * time.Second)
+		}
+		id := primitive.NewObjectID()
+		ids = append(ids, id)
+		if err := matches.Create(ctx, models.Match{ID: id, Game: "uno", EndedAt: at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	matches.Create(ctx, models.Match{Game: "chess", EndedAt: ended})
+
+	var got []primitive.ObjectID
+	var before *MatchCursor
+	for page := 0; page < 10; page++ {
+		list, err := matches.ListByGame(ctx, "uno", before, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range list {
+			got = append(got, match.ID)
+		}
+		if len(list) < 3 {
+			break
+		}
+		last := list[len(list)-1]
+		before = &MatchCursor{EndedAt: last.EndedAt, ID: last.ID}
+	}
+
+	// Object IDs grow, so the newest first is the reverse of creation
+	var want []primitive.ObjectID
+	for i := len(ids) - 1; i >= 0; i-- {
+		want = append(want, ids[i])
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("pages = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryUpdateFieldsIf(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserStore()
+	users.Create(ctx, models.User{Email: "a@example.com", Games: map[string]models.GameStats{"uno": {Level: 1}}})
+
+	tests := []struct {
+		name  string
+		match map[string]interface{}
+		set   float64
+		want  bool
+	}{
+		{"missing field matches nil", map[string]interface{}{"games.uno.rating": nil}, 1600, true},
+		{"stale value", map[string]interface{}{"games.uno.rating": nil}, 1700, false},
+		{"current value", map[string]interface{}{"games.uno.rating": 1600.0}, 1650, true},
+	}
+	for _, tt := range tests {
+		updated, err := users.UpdateFieldsIf(ctx, "a@example.com", tt.match, map[string]interface{}{"games.uno.rating": tt.set})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated != tt.want {
+			t.Errorf("%s: updated = %v, want %v", tt.name, updated, tt.want)
+		}
+	}
+
+	user, _ := users.FindByEmail(ctx, "a@example.com")
+	if got := user.Games["uno"].Rating; got != 1650 {
+		t.Fatalf("rating = %v, want 1650", got)
+	}
+}
+
+func TestMemoryRoomSearchPages(t *testing.T) {
+	ctx := context.Background()
+	rooms := NewMemoryRoomStore()
+
+	// Pairs of rooms tie on every sort value, so pages break among them
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		err := rooms.Create(ctx, models.Room{
+			ID:           fmt.Sprintf("r%d", i),
+			GameName:     "uno",
+			Capacity:     4,
+			Participants: 1 + i/2%3,
+			MinLevel:     i / 2,
+			RoomPassword: "secret",
+			CreatedAt:    created.Add(time.Duration(i/2) * time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rooms.Create(ctx, models.Room{ID: "other", GameName: "chess", Capacity: 2, CreatedAt: created})
+
+	tests := []struct {
+		sort RoomSort
+		want []string
+	}{
+		{SortNewest, []string{"r6", "r5", "r4", "r3", "r2", "r1", "r0"}},
+		{SortFullest, []string{"r4", "r5", "r2", "r3", "r0", "r1", "r6"}},
+		{SortLevel, []string{"r6", "r5", "r4", "r3", "r2", "r1", "r0"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.sort), func(t *testing.T) {
+			query := RoomQuery{GameName: "uno", Sort: tt.sort, Limit: 2}
+			var got []string
+			for page := 0; page < 10; page++ {
+				list, err := rooms.Search(ctx, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, room := range list {
+					if room.RoomPassword != "" {
+						t.Fatalf("%s: the password is listed", room.ID)
+					}
+					got = append(got, room.ID)
+				}
+				if len(list) < query.Limit {
+					break
+				}
+				last := list[len(list)-1]
+				query.After = &RoomCursor{Value: tt.sort.Value(last), ID: last.ID}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("pages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v6"
+	"gopkg.in/rethinkdb/rethinkdb-go.v6/encoding"
+	"norex/database"
+	"norex/models"
+)
+
+// legacyRoomFields maps the Go field names rooms used to be inserted with
+// to the keys of models.Room. RoomID was a second, unused room ID.
+var legacyRoomFields = map[string]string{
+	"GameName":     "gameName",
+	"IsLocked":     "isLocked",
+	"RoomPassword": "roomPassword",
+	"VoiceChatOn":  "voiceChatOn",
+	"TextChatOn":   "textChatOn",
+	"MinLevel":     "minLevel",
+	"Capacity":     "capacity",
+	"TimeControl":  "timeControl",
+	"UserEmail":    "userEmail",
+	"Avatar":       "avatar",
+	"Name":         "name",
+	"RoomID":       "",
+}
+
+// MigrateRooms rewrites rooms stored before models.Room in its shape, and
+// counts the seats of rooms stored before rooms kept that count. It returns
+// how many rooms were changed. Rooms already in the new shape are left
+// alone, so after the first run it does nothing.
+func MigrateRooms(ctx context.Context) (int, error) {
+	cursor, err := rethinkdb.Table("rooms").Run(database.GetRethinkSession(), runOpts(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close()
+
+	var docs []map[string]interface{}
+	if err := cursor.All(&docs); err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for _, doc := range docs {
+		_, counted := doc["participants"]
+		if !normalizeRoom(doc) && counted {
+			continue
+		}
+
+		var room models.Room
+		if err := encoding.Decode(&room, doc); err != nil {
+			return migrated, err
+		}
+		if room.CreatedAt.IsZero() {
+			room.CreatedAt = now
+		}
+		room.UpdatedAt = now
+		if !counted {
+			// Seats were only kept in the participated table
+			participations, err := NewRethinkParticipationStore().ListByRoom(ctx, room.ID)
+			if err != nil {
+				return migrated, err
+			}
+			room.Participants = len(participations)
+		}
+
+		_, err := rethinkdb.Table("rooms").Get(room.ID).Replace(room).RunWrite(database.GetRethinkSession(), runOpts(ctx))
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// normalizeRoom renames the legacy fields of a room document in place and
+// reports whether it needs to be rewritten. When a room has both spellings
+// of a field the camelCase one wins, since EditRoom wrote it after the
+// room was created.
+func normalizeRoom(doc map[string]interface{}) bool {
+	changed := false
+	for legacy, field := range legacyRoomFields {
+		value, ok := doc[legacy]
+		if !ok {
+			continue
+		}
+		if _, exists := doc[field]; field != "" && !exists {
+			doc[field] = value
+		}
+		delete(doc, legacy)
+		changed = true
+	}
+	if _, ok := doc["createdAt"]; !ok {
+		changed = true
+	}
+	return changed
+}
+
+// EnsureRoomIndexes creates the secondary indexes of the lobby search that
+// do not exist yet and waits until they are ready.
+func EnsureRoomIndexes(ctx context.Context) error {
+	session := database.GetRethinkSession()
+	cursor, err := rethinkdb.Table("rooms").IndexList().Run(session, runOpts(ctx))
+	if err != nil {
+		return err
+	}
+	var existing []string
+	err = cursor.All(&existing)
+	cursor.Close()
+	if err != nil {
+		return err
+	}
+
+	have := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		have[name] = true
+	}
+	for sort, index := range roomIndexes {
+		name := roomIndexName(sort)
+		if have[name] {
+			continue
+		}
+		if _, err := rethinkdb.Table("rooms").IndexCreateFunc(name, index).RunWrite(session, runOpts(ctx)); err != nil {
+			return err
+		}
+	}
+
+	cursor, err = rethinkdb.Table("rooms").IndexWait().Run(session, runOpts(ctx))
+	if err != nil {
+		return err
+	}
+	return cursor.Close()
+}
@@ -0,0 +1,234 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"norex/database"
+	"norex/models"
+)
+
+// mongoErr maps the driver's "no documents" error to ErrNotFound.
+func mongoErr(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+type mongoUserStore struct{}
+
+func NewMongoUserStore() UserStore {
+	return mongoUserStore{}
+}
+
+func (mongoUserStore) collection() *mongo.Collection {
+	return database.GetCollection("users")
+}
+
+func (s mongoUserStore) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	err := s.collection().FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	return user, mongoErr(err)
+}
+
+func (s mongoUserStore) Create(ctx context.Context, user models.User) error {
+	_, err := s.collection().InsertOne(ctx, user)
+	return err
+}
+
+func (s mongoUserStore) Update(ctx context.Context, email string, user models.User) error {
+	_, err := s.collection().UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": user})
+	return err
+}
+
+func (s mongoUserStore) UpdateFields(ctx context.Context, email string, fields map[string]interface{}) error {
+	_, err := s.collection().UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": fields})
+	return err
+}
+
+func (s mongoUserStore) IncrementFields(ctx context.Context, email string, fields map[string]int) error {
+	_, err := s.collection().UpdateOne(ctx, bson.M{"email": email}, bson.M{"$inc": fields})
+	return err
+}
+
+func (s mongoUserStore) UpdateFieldsIf(ctx context.Context, email string, match, fields map[string]interface{}) (bool, error) {
+	filter := bson.M{"email": email}
+	for key, value := range match {
+		filter[key] = value // nil also matches a missing field
+	}
+	res, err := s.collection().UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+type mongoRoleStore struct{}
+
+func NewMongoRoleStore() RoleStore {
+	return mongoRoleStore{}
+}
+
+func (mongoRoleStore) collection() *mongo.Collection {
+	return database.GetCollection("roles")
+}
+
+func (s mongoRoleStore) FindByID(ctx context.Context, id primitive.ObjectID) (models.Role, error) {
+	var role models.Role
+	err := s.collection().FindOne(ctx, bson.M{"_id": id}).Decode(&role)
+	return role, mongoErr(err)
+}
+
+func (s mongoRoleStore) FindByName(ctx context.Context, name string) (models.Role, error) {
+	var role models.Role
+	err := s.collection().FindOne(ctx, bson.M{"name": name}).Decode(&role)
+	return role, mongoErr(err)
+}
+
+func (s mongoRoleStore) Create(ctx context.Context, role models.Role) error {
+	_, err := s.collection().InsertOne(ctx, role)
+	return err
+}
+
+func (s mongoRoleStore) Update(ctx context.Context, id primitive.ObjectID, role models.Role) error {
+	_, err := s.collection().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": role})
+	return err
+}
+
+func (s mongoRoleStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.collection().DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (s mongoRoleStore) List(ctx context.Context) ([]models.Role, error) {
+	cursor, err := s.collection().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var roles []models.Role
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+type mongoSessionStore struct{}
+
+func NewMongoSessionStore() SessionStore {
+	return mongoSessionStore{}
+}
+
+func (mongoSessionStore) Create(ctx context.Context, session models.Session) error {
+	_, err := database.GetCollection("sessions").InsertOne(ctx, session)
+	return err
+}
+
+type mongoRatingStore struct{}
+
+func NewMongoRatingStore() RatingStore {
+	return mongoRatingStore{}
+}
+
+func (mongoRatingStore) collection() *mongo.Collection {
+	return database.GetCollection("rating_history")
+}
+
+func (s mongoRatingStore) Create(ctx context.Context, change models.RatingChange) error {
+	_, err := s.collection().InsertOne(ctx, change)
+	return err
+}
+
+func (s mongoRatingStore) ListByUser(ctx context.Context, email, game string, before time.Time, limit int) ([]models.RatingChange, error) {
+	filter := bson.M{"email": email, "game": game}
+	if !before.IsZero() {
+		filter["created_at"] = bson.M{"$lt": before}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := s.collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var changes []models.RatingChange
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+type mongoMatchStore struct{}
+
+func NewMongoMatchStore() MatchStore {
+	return mongoMatchStore{}
+}
+
+func (mongoMatchStore) collection() *mongo.Collection {
+	return database.GetCollection("matches")
+}
+
+func (s mongoMatchStore) Create(ctx context.Context, match models.Match) error {
+	_, err := s.collection().InsertOne(ctx, match)
+	return err
+}
+
+func (s mongoMatchStore) ListByUser(ctx context.Context, email, game string, before *MatchCursor, limit int) ([]models.Match, error) {
+	filter := bson.M{"players.email": email}
+	if game != "" {
+		filter["game"] = game
+	}
+	return s.list(ctx, filter, before, limit)
+}
+
+func (s mongoMatchStore) ListByGame(ctx context.Context, game string, before *MatchCursor, limit int) ([]models.Match, error) {
+	return s.list(ctx, bson.M{"game": game}, before, limit)
+}
+
+func (s mongoMatchStore) list(ctx context.Context, filter bson.M, before *MatchCursor, limit int) ([]models.Match, error) {
+	if before != nil {
+		filter["$or"] = bson.A{
+			bson.M{"ended_at": bson.M{"$lt": before.EndedAt}},
+			bson.M{"ended_at": before.EndedAt, "_id": bson.M{"$lt": before.ID}},
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "ended_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := s.collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var matches []models.Match
+	if err := cursor.All(ctx, &matches); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+func bsonMarshal(v interface{}) (bson.M, error) {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func bsonUnmarshal(doc bson.M, v interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, v)
+}
@@ -0,0 +1,357 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v6"
+	"gopkg.in/rethinkdb/rethinkdb-go.v6/encoding"
+	"norex/database"
+	"norex/models"
+)
+
+// runOpts attaches the caller's context to a RethinkDB query.
+func runOpts(ctx context.Context) rethinkdb.RunOpts {
+	return rethinkdb.RunOpts{Context: ctx}
+}
+
+// insertedKey returns the primary key RethinkDB generated for a single insert.
+func insertedKey(res rethinkdb.WriteResponse) string {
+	if len(res.GeneratedKeys) > 0 {
+		return res.GeneratedKeys[0]
+	}
+	return ""
+}
+
+// writeErr maps a failed write caused by an existing primary key to
+// ErrDuplicate.
+func writeErr(err error) error {
+	if err != nil && strings.Contains(err.Error(), "Duplicate primary key") {
+		return ErrDuplicate
+	}
+	return err
+}
+
+type rethinkRoomStore struct{}
+
+func NewRethinkRoomStore() RoomStore {
+	return rethinkRoomStore{}
+}
+
+func (rethinkRoomStore) Create(ctx context.Context, room models.Room) error {
+	_, err := rethinkdb.Table("rooms").Insert(room).RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	return writeErr(err)
+}
+
+func (rethinkRoomStore) Get(ctx context.Context, id string) (models.Room, error) {
+	cursor, err := rethinkdb.Table("rooms").Get(id).Run(database.GetRethinkSession(), runOpts(ctx))
+	if err != nil {
+		return models.Room{}, err
+	}
+	defer cursor.Close()
+
+	var room models.Room
+	if err := cursor.One(&room); err != nil {
+		if errors.Is(err, rethinkdb.ErrEmptyResult) {
+			return models.Room{}, ErrNotFound
+		}
+		return models.Room{}, err
+	}
+	return room, nil
+}
+
+func (rethinkRoomStore) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	update := make(map[string]interface{}, len(fields)+1)
+	for key, value := range fields {
+		update[key] = value
+	}
+	update["updatedAt"] = time.Now().UTC()
+
+	_, err := rethinkdb.Table("rooms").Get(id).Update(update).RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	return err
+}
+
+func (rethinkRoomStore) Delete(ctx context.Context, id string) error {
+	_, err := rethinkdb.Table("rooms").Get(id).Delete().RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	return err
+}
+
+func (rethinkRoomStore) ClaimSeat(ctx context.Context, id string) error {
+	res, err := rethinkdb.Table("rooms").Get(id).Update(func(row rethinkdb.Term) interface{} {
+		taken := row.Field("participants").Default(0)
+		// A full room is left unchanged
+		return rethinkdb.Branch(taken.Lt(row.Field("capacity")), map[string]interface{}{"participants": taken.Add(1)}, map[string]interface{}{})
+	}).RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	switch {
+	case err != nil:
+		return err
+	case res.Skipped > 0:
+		return ErrNotFound
+	case res.Replaced == 0:
+		return ErrFull
+	}
+	return nil
+}
+
+func (rethinkRoomStore) ReleaseSeat(ctx context.Context, id string) error {
+	_, err := rethinkdb.Table("rooms").Get(id).Update(func(row rethinkdb.Term) interface{} {
+		taken := row.Field("participants").Default(0)
+		return rethinkdb.Branch(taken.Gt(0), map[string]interface{}{"participants": taken.Sub(1)}, map[string]interface{}{})
+	}).RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	return err
+}
+
+// roomIndexes are the secondary indexes of the lobby search, one per sort
+// order. Each key is [gameName, sort value, id] so a page can resume right
+// after the last room of the previous one.
+var roomIndexes = map[RoomSort]func(row rethinkdb.Term) interface{}{
+	SortNewest: func(row rethinkdb.Term) interface{} {
+		return []interface{}{row.Field("gameName"), row.Field("createdAt").ToEpochTime(), row.Field("id")}
+	},
+	SortFullest: func(row rethinkdb.Term) interface{} {
+		return []interface{}{row.Field("gameName"), row.Field("capacity").Sub(row.Field("participants").Default(0)), row.Field("id")}
+	},
+	SortLevel: func(row rethinkdb.Term) interface{} {
+		return []interface{}{row.Field("gameName"), row.Field("minLevel").Default(0), row.Field("id")}
+	},
+}
+
+func roomIndexName(sort RoomSort) string {
+	return "lobby_" + string(sort)
+}
+
+func (rethinkRoomStore) Search(ctx context.Context, query RoomQuery) ([]models.Room, error) {
+	if _, ok := roomIndexes[query.Sort]; !ok {
+		return nil, fmt.Errorf("store: unknown room sort %q", query.Sort)
+	}
+	index := roomIndexName(query.Sort)
+
+	// Walk the index range of the game, starting after the cursor
+	lower := []interface{}{query.GameName, rethinkdb.MinVal, rethinkdb.MinVal}
+	upper := []interface{}{query.GameName, rethinkdb.MaxVal, rethinkdb.MaxVal}
+	opts := rethinkdb.BetweenOpts{Index: index}
+	switch {
+	case query.After != nil && query.Sort.Descending():
+		upper = []interface{}{query.GameName, query.After.Value, query.After.ID}
+		opts.RightBound = "open"
+	case query.After != nil:
+		lower = []interface{}{query.GameName, query.After.Value, query.After.ID}
+		opts.LeftBound = "open"
+	case query.Sort == SortFullest && query.FreeSeats:
+		lower = []interface{}{query.GameName, 1, rethinkdb.MinVal}
+	}
+	order := rethinkdb.Asc(index)
+	if query.Sort.Descending() {
+		order = rethinkdb.Desc(index)
+	}
+
+	cursor, err := rethinkdb.Table("rooms").
+		Between(lower, upper, opts).
+		OrderBy(rethinkdb.OrderByOpts{Index: order}).
+		Filter(roomFilter(query)).
+		Without("roomPassword"). // Exclude specific fields
+		Limit(query.Limit).
+		Run(database.GetRethinkSession(), runOpts(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var rooms []models.Room
+	if err := cursor.All(&rooms); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+// roomFilter is RoomQuery.Match as a ReQL predicate.
+func roomFilter(query RoomQuery) func(row rethinkdb.Term) rethinkdb.Term {
+	return func(row rethinkdb.Term) rethinkdb.Term {
+		match := rethinkdb.Expr(true)
+		if query.Locked != nil {
+			match = match.And(row.Field("isLocked").Eq(*query.Locked))
+		}
+		if query.FreeSeats {
+			match = match.And(row.Field("capacity").Sub(row.Field("participants").Default(0)).Gt(0))
+		}
+		if query.VoiceChat != nil {
+			match = match.And(row.Field("voiceChatOn").Eq(*query.VoiceChat))
+		}
+		if query.TextChat != nil {
+			match = match.And(row.Field("textChatOn").Eq(*query.TextChat))
+		}
+		if query.MinLevelFrom > 0 {
+			match = match.And(row.Field("minLevel").Default(0).Ge(query.MinLevelFrom))
+		}
+		if query.MinLevelTo > 0 {
+			match = match.And(row.Field("minLevel").Default(0).Le(query.MinLevelTo))
+		}
+		return match
+	}
+}
+
+func (rethinkRoomStore) CountByGame(ctx context.Context) (map[string]int, error) {
+	cursor, err := rethinkdb.Table("rooms").
+		Group("gameName").
+		Count().
+		Ungroup().
+		Run(database.GetRethinkSession(), runOpts(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var groups []struct {
+		GameName string `rethinkdb:"group"`
+		Count    int    `rethinkdb:"reduction"`
+	}
+	if err := cursor.All(&groups); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(groups))
+	for _, group := range groups {
+		counts[group.GameName] = group.Count
+	}
+	return counts, nil
+}
+
+type rethinkGameStore struct{}
+
+func NewRethinkGameStore() GameStore {
+	return rethinkGameStore{}
+}
+
+func (rethinkGameStore) Create(ctx context.Context, game models.Game) (string, error) {
+	res, err := rethinkdb.Table("games").Insert(game).RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	if err != nil {
+		return "", err
+	}
+	return insertedKey(res), nil
+}
+
+func (rethinkGameStore) Finish(ctx context.Context, id string, winnerID *string, matchID string) (models.Game, error) {
+	finished := map[string]interface{}{"status": "finished", "winnerId": winnerID, "matchId": matchID}
+	res, err := rethinkdb.Table("games").Get(id).
+		Update(func(game rethinkdb.Term) interface{} {
+			// Only a started game is finished, and only once
+			return rethinkdb.Branch(game.Field("status").Eq("started"), finished, map[string]interface{}{})
+		}, rethinkdb.UpdateOpts{ReturnChanges: true}).
+		RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	if err != nil {
+		return models.Game{}, err
+	}
+	if len(res.Changes) == 0 {
+		return models.Game{}, ErrNotFound
+	}
+	var game models.Game
+	err = encoding.Decode(&game, res.Changes[0].NewValue)
+	return game, err
+}
+
+func (rethinkGameStore) Delete(ctx context.Context, id string) error {
+	_, err := rethinkdb.Table("games").Get(id).Delete().RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	return err
+}
+
+type rethinkMessageStore struct{}
+
+func NewRethinkMessageStore() MessageStore {
+	return rethinkMessageStore{}
+}
+
+func (rethinkMessageStore) Create(ctx context.Context, message models.Message) (string, error) {
+	res, err := rethinkdb.Table("messages").Insert(message).RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	if err != nil {
+		return "", err
+	}
+	return insertedKey(res), nil
+}
+
+func (rethinkMessageStore) ListByRoom(ctx context.Context, roomID string, before *MessageCursor, limit int) ([]models.Message, error) {
+	filter := rethinkdb.Row.Field("roomID").Eq(roomID)
+	if before != nil {
+		filter = filter.And(rethinkdb.Row.Field("createdAt").Lt(before.CreatedAt).Or(
+			rethinkdb.Row.Field("createdAt").Eq(before.CreatedAt).And(rethinkdb.Row.Field("id").Lt(before.ID)),
+		))
+	}
+	cursor, err := rethinkdb.Table("messages").
+		Filter(filter).
+		OrderBy(rethinkdb.Desc("createdAt"), rethinkdb.Desc("id")).
+		Limit(limit).
+		Run(database.GetRethinkSession(), runOpts(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var messages []models.Message
+	if err := cursor.All(&messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (rethinkMessageStore) DeleteByRoom(ctx context.Context, roomID string) error {
+	_, err := rethinkdb.Table("messages").
+		Filter(rethinkdb.Row.Field("roomID").Eq(roomID)).
+		Delete().
+		RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	return err
+}
+
+type rethinkParticipationStore struct{}
+
+func NewRethinkParticipationStore() ParticipationStore {
+	return rethinkParticipationStore{}
+}
+
+func (rethinkParticipationStore) Create(ctx context.Context, participation models.Participation) (string, error) {
+	res, err := rethinkdb.Table("participated").Insert(participation).RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	if err != nil {
+		return "", err
+	}
+	return insertedKey(res), nil
+}
+
+func (rethinkParticipationStore) ListByRoom(ctx context.Context, roomID string) ([]models.Participation, error) {
+	cursor, err := rethinkdb.Table("participated").
+		Filter(rethinkdb.Row.Field("roomID").Eq(roomID)).
+		OrderBy("createdAt").
+		Run(database.GetRethinkSession(), runOpts(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var participations []models.Participation
+	if err := cursor.All(&participations); err != nil {
+		return nil, err
+	}
+	return participations, nil
+}
+
+func (rethinkParticipationStore) Delete(ctx context.Context, roomID, userID string) error {
+	res, err := rethinkdb.Table("participated").
+		Filter(rethinkdb.Row.Field("roomID").Eq(roomID).And(rethinkdb.Row.Field("userID").Eq(userID))).
+		Delete().
+		RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	if err != nil {
+		return err
+	}
+	if res.Deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (rethinkParticipationStore) DeleteByRoom(ctx context.Context, roomID string) error {
+	_, err := rethinkdb.Table("participated").
+		Filter(rethinkdb.Row.Field("roomID").Eq(roomID)).
+		Delete().
+		RunWrite(database.GetRethinkSession(), runOpts(ctx))
+	return err
+}
@@ -0,0 +1,307 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"norex/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested document does not exist.
+	ErrNotFound = errors.New("store: not found")
+	// ErrDuplicate is returned when a document with the same key exists.
+	ErrDuplicate = errors.New("store: duplicate key")
+	// ErrFull is returned when a room has no free seat left.
+	ErrFull = errors.New("store: room is full")
+)
+
+type UserStore interface {
+	FindByEmail(ctx context.Context, email string) (models.User, error)
+	Create(ctx context.Context, user models.User) error
+	// Update overwrites the stored user matched by email with every field of user.
+	Update(ctx context.Context, email string, user models.User) error
+	// UpdateFields sets only the given bson fields of the user matched by email.
+	UpdateFields(ctx context.Context, email string, fields map[string]interface{}) error
+	// IncrementFields adds to the given numeric bson fields of the user
+	// matched by email in a single atomic update.
+	IncrementFields(ctx context.Context, email string, fields map[string]int) error
+	// UpdateFieldsIf sets the given bson fields of the user matched by email
+	// only while every field of match still holds its value, a nil value
+	// matching a missing field. It reports whether the user was updated.
+	UpdateFieldsIf(ctx context.Context, email string, match, fields map[string]interface{}) (bool, error)
+}
+
+type RoleStore interface {
+	FindByID(ctx context.Context, id primitive.ObjectID) (models.Role, error)
+	FindByName(ctx context.Context, name string) (models.Role, error)
+	Create(ctx context.Context, role models.Role) error
+	Update(ctx context.Context, id primitive.ObjectID, role models.Role) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	List(ctx context.Context) ([]models.Role, error)
+}
+
+type SessionStore interface {
+	Create(ctx context.Context, session models.Session) error
+}
+
+// RoomStore keeps the real-time rooms.
+type RoomStore interface {
+	// Create inserts a room under its ID, or returns ErrDuplicate when the
+	// ID is already taken.
+	Create(ctx context.Context, room models.Room) error
+	Get(ctx context.Context, id string) (models.Room, error)
+	// Update sets the given fields, named by their rethinkdb tags, and
+	// bumps updatedAt.
+	Update(ctx context.Context, id string, fields map[string]interface{}) error
+	Delete(ctx context.Context, id string) error
+	// ClaimSeat takes one free seat of a room in a single atomic update,
+	// so two players can never get the same last seat. It returns ErrFull
+	// when every seat is taken.
+	ClaimSeat(ctx context.Context, id string) error
+	// ReleaseSeat gives back a seat taken with ClaimSeat.
+	ReleaseSeat(ctx context.Context, id string) error
+	// Search returns a page of the rooms of a game matching query, in the
+	// order of query.Sort, after query.After when it is set.
+	Search(ctx context.Context, query RoomQuery) ([]models.Room, error)
+	// CountByGame returns the number of open rooms per game name.
+	CountByGame(ctx context.Context) (map[string]int, error)
+}
+
+// RoomSort is the order of a room search.
+type RoomSort string
+
+const (
+	SortNewest  RoomSort = "newest"  // most recently created first
+	SortFullest RoomSort = "fullest" // fewest free seats first
+	SortLevel   RoomSort = "level"   // highest minLevel first
+)
+
+// Descending reports whether rooms are ordered by decreasing Value.
+func (s RoomSort) Descending() bool {
+	return s != SortFullest
+}
+
+// Value is what rooms are ordered by, ties being broken by room ID.
+// Creation times are kept to the millisecond, like RethinkDB does.
+func (s RoomSort) Value(room models.Room) float64 {
+	switch s {
+	case SortFullest:
+		return float64(room.FreeSeats())
+	case SortLevel:
+		return float64(room.MinLevel)
+	}
+	return float64(room.CreatedAt.UnixMilli()) / 1000
+}
+
+// RoomCursor is the position of the last room of a page.
+type RoomCursor struct {
+	Value float64 `json:"v"`
+	ID    string  `json:"id"`
+}
+
+// RoomQuery selects the rooms of one game. Nil and zero fields do not
+// filter.
+type RoomQuery struct {
+	GameName     string
+	Locked       *bool
+	FreeSeats    bool // only rooms with at least one free seat
+	VoiceChat    *bool
+	TextChat     *bool
+	MinLevelFrom int // lowest minLevel
+	MinLevelTo   int // highest minLevel, 0 for no bound
+	Sort         RoomSort
+	After        *RoomCursor
+	Limit        int
+}
+
+// Match reports whether a room passes the filters of the query.
+func (q RoomQuery) Match(room models.Room) bool {
+	switch {
+	case room.GameName != q.GameName:
+		return false
+	case q.Locked != nil && room.IsLocked != *q.Locked:
+		return false
+	case q.FreeSeats && room.FreeSeats() <= 0:
+		return false
+	case q.VoiceChat != nil && room.VoiceChatOn != *q.VoiceChat:
+		return false
+	case q.TextChat != nil && room.TextChatOn != *q.TextChat:
+		return false
+	case room.MinLevel < q.MinLevelFrom:
+		return false
+	case q.MinLevelTo > 0 && room.MinLevel > q.MinLevelTo:
+		return false
+	}
+	return true
+}
+
+type GameStore interface {
+	// Create inserts the game and returns its generated primary key.
+	Create(ctx context.Context, game models.Game) (string, error)
+	// Finish marks a started game as finished with its winner and match and
+	// returns it, or ErrNotFound when no such game is started.
+	Finish(ctx context.Context, id string, winnerID *string, matchID string) (models.Game, error)
+	// Delete removes a game, e.g. when it could not be dealt.
+	Delete(ctx context.Context, id string) error
+}
+
+// MatchStore keeps every finished game.
+type MatchStore interface {
+	Create(ctx context.Context, match models.Match) error
+	// ListByUser returns up to limit matches a user played, newest first,
+	// after the cursor; game filters them when not empty. A nil before
+	// starts from the newest.
+	ListByUser(ctx context.Context, email, game string, before *MatchCursor, limit int) ([]models.Match, error)
+	// ListByGame is ListByUser for every match of a game.
+	ListByGame(ctx context.Context, game string, before *MatchCursor, limit int) ([]models.Match, error)
+}
+
+// MatchCursor is the position of the last match of a page. Matches ended at
+// the same time are ordered by ID, so none is skipped between pages.
+type MatchCursor struct {
+	EndedAt time.Time          `json:"t"`
+	ID      primitive.ObjectID `json:"id"`
+}
+
+// Before reports whether match comes after the cursor, newest first.
+func (c MatchCursor) Before(match models.Match) bool {
+	if match.EndedAt.Equal(c.EndedAt) {
+		return match.ID.Hex() < c.ID.Hex()
+	}
+	return match.EndedAt.Before(c.EndedAt)
+}
+
+type MessageStore interface {
+	// Create inserts the message and returns its generated primary key.
+	Create(ctx context.Context, message models.Message) (string, error)
+	// ListByRoom returns up to limit messages of a room sent before the
+	// cursor, newest first. A nil before starts from the latest message.
+	ListByRoom(ctx context.Context, roomID string, before *MessageCursor, limit int) ([]models.Message, error)
+	DeleteByRoom(ctx context.Context, roomID string) error
+}
+
+// MessageCursor is the position of the last message of a page. Messages
+// sent at the same time are ordered by ID, so none is skipped between pages.
+type MessageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// Before reports whether message comes after the cursor, newest first.
+func (c MessageCursor) Before(message models.Message) bool {
+	if message.CreatedAt.Equal(c.CreatedAt) {
+		return message.ID < c.ID
+	}
+	return message.CreatedAt.Before(c.CreatedAt)
+}
+
+// ParticipationStore keeps the users seated in each room.
+type ParticipationStore interface {
+	// Create inserts the participation and returns its generated primary key.
+	Create(ctx context.Context, participation models.Participation) (string, error)
+	// ListByRoom returns the participants of a room in the order they joined.
+	ListByRoom(ctx context.Context, roomID string) ([]models.Participation, error)
+	// Delete removes a user from a room, or returns ErrNotFound.
+	Delete(ctx context.Context, roomID, userID string) error
+	DeleteByRoom(ctx context.Context, roomID string) error
+}
+
+// RatingStore keeps the rating history of every player.
+type RatingStore interface {
+	Create(ctx context.Context, change models.RatingChange) error
+	// ListByUser returns up to limit changes of a user in a game, newest
+	// first, created before before. A zero before starts from the newest.
+	ListByUser(ctx context.Context, email, game string, before time.Time, limit int) ([]models.RatingChange, error)
+}
+
+// Stores groups every store the handlers depend on.
+type Stores struct {
+	Users          UserStore
+	Roles          RoleStore
+	Sessions       SessionStore
+	Rooms          RoomStore
+	Games          GameStore
+	Messages       MessageStore
+	Participations ParticipationStore
+	Ratings        RatingStore
+	Matches        MatchStore
+}
+
+// NewDatabaseStores returns the MongoDB and RethinkDB backed stores. The
+// database connections are looked up on every call, so it is safe to build
+// them before database.Connect and database.ConnectRethinkDB have run.
+func NewDatabaseStores() Stores {
+	return Stores{
+		Users:          NewMongoUserStore(),
+		Roles:          NewMongoRoleStore(),
+		Sessions:       NewMongoSessionStore(),
+		Rooms:          NewRethinkRoomStore(),
+		Games:          NewRethinkGameStore(),
+		Messages:       NewRethinkMessageStore(),
+		Participations: NewRethinkParticipationStore(),
+		Ratings:        NewMongoRatingStore(),
+		Matches:        NewMongoMatchStore(),
+	}
+}
+
+// NewMemoryStores returns stores that keep everything in process memory.
+// They are meant for tests and local development without any database.
+func NewMemoryStores() Stores {
+	return Stores{
+		Users:          NewMemoryUserStore(),
+		Roles:          NewMemoryRoleStore(),
+		Sessions:       NewMemorySessionStore(),
+		Rooms:          NewMemoryRoomStore(),
+		Games:          NewMemoryGameStore(),
+		Messages:       NewMemoryMessageStore(),
+		Participations: NewMemoryParticipationStore(),
+		Ratings:        NewMemoryRatingStore(),
+		Matches:        NewMemoryMatchStore(),
+	}
+}
+
+var active Stores
+
+// Use sets the stores returned by the accessors below.
+func Use(stores Stores) {
+	active = stores
+}
+
+func Users() UserStore {
+	return active.Users
+}
+
+func Roles() RoleStore {
+	return active.Roles
+}
+
+func Sessions() SessionStore {
+	return active.Sessions
+}
+
+func Rooms() RoomStore {
+	return active.Rooms
+}
+
+func Games() GameStore {
+	return active.Games
+}
+
+func Messages() MessageStore {
+	return active.Messages
+}
+
+func Participations() ParticipationStore {
+	return active.Participations
+}
+
+func Ratings() RatingStore {
+	return active.Ratings
+}
+
+func Matches() MatchStore {
+	return active.Matches
+}